@@ -15,9 +15,13 @@
 package sequence
 
 import (
+	"encoding/gob"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/willf/bitset"
@@ -73,6 +77,16 @@ type Analyzer struct {
 	nodeCount []int
 
 	mu sync.RWMutex
+
+	// patterns are the unique patterns returned by Analyze, along with the number
+	// of messages that matched each
+	patterns map[string]*analyzerPattern
+	pmu      sync.Mutex
+}
+
+type analyzerPattern struct {
+	Pattern Pattern
+	Count   int
 }
 
 type analyzerNode struct {
@@ -102,8 +116,9 @@ func (this *stackAnalyzerNode) String() string {
 
 func NewAnalyzer() *Analyzer {
 	tree := &Analyzer{
-		root: newAnalyzerNode(),
-		leaf: newAnalyzerNode(),
+		root:     newAnalyzerNode(),
+		leaf:     newAnalyzerNode(),
+		patterns: make(map[string]*analyzerPattern),
 	}
 
 	tree.root.level = -1
@@ -118,11 +133,175 @@ func newAnalyzerNode() *analyzerNode {
 	}
 }
 
+// copy returns a copy of the node without its parents and children.
+func (this *analyzerNode) copy() *analyzerNode {
+	n := newAnalyzerNode()
+	n.Token = this.Token
+	n.index = this.index
+	n.level = this.level
+	n.isKey = this.isKey
+	n.isValue = this.isValue
+
+	return n
+}
+
 func (this *analyzerNode) String() string {
 	return fmt.Sprintf("%d/%d: %s %t %t %t\n--%s\n--%s\n", this.level, this.index, this.Token.String(),
 		this.isKey, this.isValue, this.leaf, this.parents.DumpAsBits(), this.children.DumpAsBits())
 }
 
+// Save writes the analysis tree to w, so the analysis of a large body of messages
+// can be checkpointed and later resumed using LoadAnalyzer. The tree can be saved
+// both before and after Finalize() is called.
+func (this *Analyzer) Save(w io.Writer) error {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	this.pmu.Lock()
+	defer this.pmu.Unlock()
+
+	state := analyzerState{
+		Root:      this.root.state(),
+		Leaf:      this.leaf.state(),
+		Levels:    make([][]analyzerNodeState, len(this.levels)),
+		Litmaps:   this.litmaps,
+		NodeCount: this.nodeCount,
+		Patterns:  this.patterns,
+	}
+
+	for i, level := range this.levels {
+		state.Levels[i] = make([]analyzerNodeState, len(level))
+
+		for j, n := range level {
+			switch n {
+			case nil:
+				state.Levels[i][j].Empty = true
+			case this.leaf:
+				state.Levels[i][j].Shared = true
+			default:
+				state.Levels[i][j] = n.state()
+			}
+		}
+	}
+
+	return gob.NewEncoder(w).Encode(&state)
+}
+
+// LoadAnalyzer reads an analysis tree written by Save from r.
+func LoadAnalyzer(r io.Reader) (*Analyzer, error) {
+	var state analyzerState
+
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("Error loading analyzer: %v", err)
+	}
+
+	this := &Analyzer{
+		root:      state.Root.node(),
+		leaf:      state.Leaf.node(),
+		levels:    make([][]*analyzerNode, len(state.Levels)),
+		litmaps:   state.Litmaps,
+		nodeCount: state.NodeCount,
+		patterns:  state.Patterns,
+	}
+
+	if this.patterns == nil {
+		this.patterns = make(map[string]*analyzerPattern)
+	}
+
+	for i, level := range state.Levels {
+		this.levels[i] = make([]*analyzerNode, len(level))
+
+		for j, n := range level {
+			if n.Shared {
+				this.levels[i][j] = this.leaf
+			} else {
+				this.levels[i][j] = n.node()
+			}
+		}
+
+		// gob doesn't distinguish empty maps from missing ones
+		if this.litmaps[i] == nil {
+			this.litmaps[i] = make(map[string]int)
+		}
+	}
+
+	return this, nil
+}
+
+// analyzerState is the analysis tree in a form that can be encoded by gob.
+type analyzerState struct {
+	Root      analyzerNodeState
+	Leaf      analyzerNodeState
+	Levels    [][]analyzerNodeState
+	Litmaps   []map[string]int
+	NodeCount []int
+	Patterns  map[string]*analyzerPattern
+}
+
+// analyzerNodeState is a single node of the analysis tree. Empty marks the nodes
+// that have been merged away, and Shared marks the leaf node all levels share.
+type analyzerNodeState struct {
+	Type    TokenType
+	Tag     TagType
+	Value   string
+	KeyTok  bool
+	ValTok  bool
+	Index   int
+	Level   int
+	IsKey   bool
+	IsValue bool
+	Leaf    bool
+	Empty   bool
+	Shared  bool
+
+	Parents  *bitset.BitSet
+	Children *bitset.BitSet
+}
+
+func (this *analyzerNode) state() analyzerNodeState {
+	return analyzerNodeState{
+		Type:     this.Type,
+		Tag:      this.Tag,
+		Value:    this.Value,
+		KeyTok:   this.Token.isKey,
+		ValTok:   this.Token.isValue,
+		Index:    this.index,
+		Level:    this.level,
+		IsKey:    this.isKey,
+		IsValue:  this.isValue,
+		Leaf:     this.leaf,
+		Parents:  this.parents,
+		Children: this.children,
+	}
+}
+
+func (this analyzerNodeState) node() *analyzerNode {
+	if this.Empty {
+		return nil
+	}
+
+	n := &analyzerNode{
+		Token:    Token{Type: this.Type, Tag: this.Tag, Value: this.Value, isKey: this.KeyTok, isValue: this.ValTok},
+		index:    this.Index,
+		level:    this.Level,
+		isKey:    this.IsKey,
+		isValue:  this.IsValue,
+		leaf:     this.Leaf,
+		parents:  this.Parents,
+		children: this.Children,
+	}
+
+	if n.parents == nil {
+		n.parents = bitset.New(1)
+	}
+
+	if n.children == nil {
+		n.children = bitset.New(1)
+	}
+
+	return n
+}
+
 // Analyze analyzes the message sequence supplied, and returns the unique pattern
 // that will match this message.
 func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
@@ -136,14 +315,68 @@ func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
 
 	var seq2 Sequence
 
+	// The nodes are shared by concurrent calls, so the tokens are copied
 	for i, n := range path {
-		n.Token.Value, n.Token.isKey, n.Token.isValue = seq[i].Value, seq[i].isKey, seq[i].isValue
-		seq2 = append(seq2, n.Token)
+		tok := n.Token
+		tok.Value, tok.isKey, tok.isValue = seq[i].Value, seq[i].isKey, seq[i].isValue
+		seq2 = append(seq2, tok)
 	}
 
 	//glog.Debugf("%s", seq2.PrintTokens())
 
-	return analyzeSequence(seq2), nil
+	seq2 = analyzeSequence(seq2)
+	this.addPattern(seq2.String())
+
+	return seq2, nil
+}
+
+// Patterns returns the unique patterns that Analyze has returned so far, sorted
+// by the number of messages that matched each, most matched first. The patterns
+// can be added to a Parser directly using Parser.AddPattern, so the patterns
+// discovered don't have to be written to a pattern file and read back.
+func (this *Analyzer) Patterns() []Pattern {
+	this.pmu.Lock()
+	defer this.pmu.Unlock()
+
+	stats := make(analyzerPatterns, 0, len(this.patterns))
+	for _, p := range this.patterns {
+		stats = append(stats, p)
+	}
+
+	sort.Sort(stats)
+
+	pats := make([]Pattern, len(stats))
+	for i, p := range stats {
+		pats[i] = p.Pattern
+	}
+
+	return pats
+}
+
+type analyzerPatterns []*analyzerPattern
+
+func (this analyzerPatterns) Len() int      { return len(this) }
+func (this analyzerPatterns) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this analyzerPatterns) Less(i, j int) bool {
+	if this[i].Count != this[j].Count {
+		return this[i].Count > this[j].Count
+	}
+	return this[i].Pattern.Text < this[j].Pattern.Text
+}
+
+func (this *Analyzer) addPattern(text string) {
+	this.pmu.Lock()
+	defer this.pmu.Unlock()
+
+	if p, ok := this.patterns[text]; ok {
+		p.Count++
+		return
+	}
+
+	this.patterns[text] = &analyzerPattern{
+		Pattern: Pattern{Text: text, Origin: OriginAnalyzer, Created: time.Now().UTC().Truncate(time.Second)},
+		Count:   1,
+	}
 }
 
 // Add adds a single message sequence to the analysis tree. It will not determine
@@ -156,24 +389,15 @@ func (this *Analyzer) Add(seq Sequence) error {
 	seq = markSequenceKV(seq)
 
 	// Add enough levels to support the depth of the token list
-	if l := len(seq) - len(this.levels) + 1; l > 0 {
-		newlevels := make([][]*analyzerNode, l)
-		// the maps are used to hash literals to see if they exist
-		newmaps := make([]map[string]int, l)
-
-		for i := 0; i < l; i++ {
-			newlevels[i] = make([]*analyzerNode, allTypesCount)
-			newlevels[i][0] = this.leaf
-			newmaps[i] = make(map[string]int)
-		}
-
-		this.levels = append(this.levels, newlevels...)
-		this.litmaps = append(this.litmaps, newmaps...)
-	}
+	this.grow(len(seq) + 1)
 
 	parent := this.root
 
 	for i, token := range seq {
+		// The nodes keep the token, but not the text around it in the pattern or
+		// message it came from, which is only used by Reconstruct
+		token.kept = nil
+
 		vl := len(token.Value)
 		//more, rest := false, false
 
@@ -262,6 +486,132 @@ func (this *Analyzer) Add(seq Sequence) error {
 	return nil
 }
 
+// grow adds levels to the tree until it has at least n levels.
+func (this *Analyzer) grow(n int) {
+	if l := n - len(this.levels); l > 0 {
+		newlevels := make([][]*analyzerNode, l)
+		// the maps are used to hash literals to see if they exist
+		newmaps := make([]map[string]int, l)
+
+		for i := 0; i < l; i++ {
+			newlevels[i] = make([]*analyzerNode, allTypesCount)
+			newlevels[i][0] = this.leaf
+			newmaps[i] = make(map[string]int)
+		}
+
+		this.levels = append(this.levels, newlevels...)
+		this.litmaps = append(this.litmaps, newmaps...)
+	}
+}
+
+// Merge adds the messages that were added to other to the analysis tree, as if
+// they were added after the messages already in it. This way a large body of
+// messages can be split into chunks that are added to analyzers of their own
+// concurrently, and merged once they're done. Merging the analyzers of
+// consecutive chunks in order builds the same tree as adding all the messages to
+// a single analyzer. Neither analyzer can be finalized, and other is not changed.
+func (this *Analyzer) Merge(other *Analyzer) error {
+	if this == other {
+		return fmt.Errorf("Invalid merge: an analyzer can't be merged into itself")
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	// Finalize merges and compacts the nodes, after which the literals are no
+	// longer found by their value
+	if this.nodeCount != nil || other.nodeCount != nil {
+		return fmt.Errorf("Invalid merge: analyzers can only be merged before they're finalized")
+	}
+
+	this.grow(len(other.levels))
+
+	// index maps the index of each node of other to the index of the same node in
+	// this tree, level by level. The leaf, tag and type nodes have fixed indexes,
+	// and the literals not in this tree yet are added after its own, in the order
+	// they were first added to other.
+	index := make([][]int, len(other.levels))
+
+	for i, level := range other.levels {
+		index[i] = make([]int, len(level))
+
+		for j, n := range level {
+			if j < allTypesCount {
+				index[i][j] = j
+
+				if n != nil && n != other.leaf && this.levels[i][j] == nil {
+					this.levels[i][j] = n.copy()
+				}
+
+				continue
+			}
+
+			if n == nil {
+				continue
+			}
+
+			k, ok := this.litmaps[i][n.Value]
+			if !ok {
+				this.levels[i] = append(this.levels[i], n.copy())
+				k = len(this.levels[i]) - 1
+				this.levels[i][k].index = k
+				this.litmaps[i][n.Value] = k
+			}
+
+			index[i][j] = k
+		}
+	}
+
+	for k, e := other.root.children.NextSet(0); e; k, e = other.root.children.NextSet(k + 1) {
+		this.root.children.Set(uint(index[0][k]))
+	}
+
+	for i, level := range other.levels {
+		for j, n := range level {
+			if n == nil || n == other.leaf {
+				continue
+			}
+
+			cur := this.levels[i][index[i][j]]
+
+			// The parent of the nodes at the top level is the root
+			for k, e := n.parents.NextSet(0); e; k, e = n.parents.NextSet(k + 1) {
+				if i > 0 {
+					cur.parents.Set(uint(index[i-1][k]))
+				} else {
+					cur.parents.Set(k)
+				}
+			}
+
+			for k, e := n.children.NextSet(0); e; k, e = n.children.NextSet(k + 1) {
+				cur.children.Set(uint(index[i+1][k]))
+			}
+
+			cur.leaf = cur.leaf || n.leaf
+		}
+	}
+
+	this.pmu.Lock()
+	defer this.pmu.Unlock()
+
+	other.pmu.Lock()
+	defer other.pmu.Unlock()
+
+	for text, p := range other.patterns {
+		if q, ok := this.patterns[text]; ok {
+			q.Count += p.Count
+		} else {
+			q := *p
+			this.patterns[text] = &q
+		}
+	}
+
+	return nil
+}
+
 // Finalize will go through the analysis tree and determine which tokens share common
 // parent and child, merge all the nodes that share at least 1 parent and 1 child,
 // and finally compact the tree and remove all dead nodes.
@@ -705,6 +1055,30 @@ func markSequenceKV(seq Sequence) Sequence {
 	return seq
 }
 
+// isQueueID returns true if s looks like a mail queue ID, e.g., "4BCDE1A2B3" for
+// postfix or "t9EF45aB012345" for sendmail, which are 6 to 20 letters and digits,
+// with at least one of each.
+func isQueueID(s string) bool {
+	if len(s) < 6 || len(s) > 20 {
+		return false
+	}
+
+	var digits, letters int
+
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			letters++
+		default:
+			return false
+		}
+	}
+
+	return digits > 0 && letters > 0
+}
+
 func analyzeSequence(seq Sequence) Sequence {
 	l := len(seq)
 	var fexists = make([]bool, TagTypesCount)
@@ -712,7 +1086,7 @@ func analyzeSequence(seq Sequence) Sequence {
 	defer func() {
 		// Step 7: try to see if we can find any srcport and dstport tags
 		for i, tok := range seq {
-			if tok.Type == token__host__ || tok.Type == token__email__ {
+			if tok.Type == token__email__ {
 				seq[i].Type = TokenString
 			}
 
@@ -768,7 +1142,7 @@ func analyzeSequence(seq Sequence) Sequence {
 				if strings.Index(tok.Value, "@") > 0 {
 					seq[i].Type = token__email__
 				} else if strings.Index(tok.Value, ".") > 0 {
-					seq[i].Type = token__host__
+					seq[i].Type = TokenHost
 				}
 			}
 		}
@@ -785,7 +1159,7 @@ func analyzeSequence(seq Sequence) Sequence {
 	// - "Oct 11 22:14:15 mymachine su: ..."
 	// - "Aug 24 05:34:00 CST 1987 mymachine myproc[10]: ..."
 	if len(seq) >= 6 && seq[0].Type == TokenInteger && seq[1].Type == TokenTime &&
-		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == token__host__ || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
+		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == TokenHost || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		seq[3].Type == TokenLiteral &&
 		(seq[4].Type == TokenInteger || (seq[4].Type == TokenLiteral && seq[4].Value == "-")) &&
 		(seq[5].Type == TokenLiteral) {
@@ -801,7 +1175,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[2].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[2].Tag = TagAppHost
 		}
 
@@ -823,7 +1197,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[5].Type = seq[5].Tag.TokenType()
 		fexists[seq[5].Tag] = true
 	} else if len(seq) >= 4 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == ":") {
 
@@ -838,7 +1212,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -850,7 +1224,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[2].Type = seq[2].Tag.TokenType()
 		fexists[seq[2].Tag] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == "[") &&
 		(seq[4].Type == TokenInteger) &&
@@ -868,7 +1242,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -885,7 +1259,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[4].Type = seq[4].Tag.TokenType()
 		fexists[seq[4].Tag] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		seq[2].Value == "last" {
 
 		// "jan 12 06:49:56 irc last message repeated 6 times"
@@ -899,7 +1273,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -907,6 +1281,26 @@ func analyzeSequence(seq Sequence) Sequence {
 		fexists[seq[1].Tag] = true
 	}
 
+	// Mail servers, e.g., postfix and sendmail, log the queue ID of the message right
+	// after the syslog header, e.g., "postfix/qmgr[1236]: 4BCDE1A2B3: removed". The
+	// queue ID is the same for all the messages of a mail transaction, so it's
+	// tagged to allow them to be correlated.
+	if fexists[TagAppName] {
+		for i := 1; i < l-2; i++ {
+			if seq[i].Type != TokenLiteral || seq[i].Value != ":" {
+				continue
+			}
+
+			if seq[i+1].Type == TokenLiteral && seq[i+1].Tag == TagUnknown && seq[i+2].Value == ":" && isQueueID(seq[i+1].Value) {
+				seq[i+1].Tag = TagQueueID
+				seq[i+1].Type = seq[i+1].Tag.TokenType()
+				fexists[seq[i+1].Tag] = true
+			}
+
+			break
+		}
+	}
+
 	// glog.Debugf("3. %s", seq)
 
 	// Step 5: identify the likely tags by their prekeys (literals that usually
@@ -975,7 +1369,7 @@ LOOP:
 				case TagSrcHost, TagDstHost, TagSrcEmail, TagDstEmail:
 					for k := i + 1; k < l && k < i+distance; k++ {
 						if !fexists[f] && seq[k].Tag == TagUnknown && !seq[k].isKey &&
-							(seq[k].Type == token__host__ && (f == TagSrcHost || f == TagDstHost)) ||
+							(seq[k].Type == TokenHost && (f == TagSrcHost || f == TagDstHost)) ||
 							(seq[k].Type == token__email__ && (f == TagSrcEmail || f == TagDstEmail)) {
 
 							seq[k].Tag = f
@@ -1081,7 +1475,7 @@ LOOP:
 					fexists[TagDstIP] = true
 				}
 
-			case token__host__:
+			case TokenHost:
 				if !fexists[TagSrcHost] {
 					seq[i].Tag = TagSrcHost
 					seq[i].Type = seq[i].Tag.TokenType()
@@ -15,7 +15,9 @@
 package sequence
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -274,3 +276,177 @@ func TestAnalyzerMatchPatterns(t *testing.T) {
 		require.Equal(t, tc.pat, seq.String(), tc.msg+"\n"+seq.PrintTokens())
 	}
 }
+
+func TestAnalyzerPatterns(t *testing.T) {
+	atree := NewAnalyzer()
+	scanner := NewScanner()
+
+	for _, tc := range analyzerSshTests {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), tc.msg)
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	counts := make(map[string]int)
+
+	for _, tc := range analyzerSshTests {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err)
+		_, err = atree.Analyze(seq)
+		require.NoError(t, err, tc.msg)
+		counts[tc.pat]++
+	}
+
+	pats := atree.Patterns()
+	require.Equal(t, len(counts), len(pats))
+
+	// Promote the discovered patterns into a parser
+	parser := NewParser()
+
+	for i, pat := range pats {
+		require.Equal(t, OriginAnalyzer, pat.Origin)
+		require.False(t, pat.Created.IsZero())
+		require.NoError(t, parser.AddPattern(pat), pat.Text)
+
+		if i > 0 {
+			require.True(t, counts[pats[i-1].Text] >= counts[pat.Text])
+		}
+	}
+
+	for _, tc := range analyzerSshTests {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err)
+		_, pat, err := parser.Match(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, OriginAnalyzer, pat.Origin, tc.msg)
+	}
+}
+
+func TestAnalyzerMerge(t *testing.T) {
+	scanner := NewScanner()
+
+	var msgs []string
+	for _, tc := range analyzerSshTests {
+		msgs = append(msgs, tc.msg)
+	}
+	for _, tc := range analyzerKVTests {
+		msgs = append(msgs, tc.msg)
+	}
+	msgs = append(msgs, analyzerSshdSamples...)
+
+	add := func(atree *Analyzer, msgs []string) {
+		for _, msg := range msgs {
+			seq, err := scanner.Scan(msg)
+			require.NoError(t, err)
+			require.NoError(t, atree.Add(seq), msg)
+		}
+	}
+
+	serial := NewAnalyzer()
+	add(serial, msgs)
+
+	// The analyzers of consecutive chunks, merged in order, build the same tree
+	merged := NewAnalyzer()
+	for _, chunk := range [][]string{msgs[:2], msgs[2:5], msgs[5:]} {
+		atree := NewAnalyzer()
+		add(atree, chunk)
+		require.NoError(t, merged.Merge(atree))
+	}
+
+	require.Error(t, merged.Merge(merged))
+	require.NoError(t, serial.Finalize())
+	require.NoError(t, merged.Finalize())
+	require.Error(t, merged.Merge(NewAnalyzer()))
+
+	for _, msg := range msgs {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err)
+		expected, err := serial.Analyze(seq)
+		require.NoError(t, err, msg)
+
+		seq, err = scanner.Scan(msg)
+		require.NoError(t, err)
+		actual, err := merged.Analyze(seq)
+		require.NoError(t, err, msg)
+
+		require.Equal(t, expected.String(), actual.String(), msg)
+	}
+
+	expected, actual := serial.Patterns(), merged.Patterns()
+	require.Equal(t, len(expected), len(actual))
+
+	for i := range expected {
+		require.Equal(t, expected[i].Text, actual[i].Text)
+	}
+}
+
+func TestAnalyzerSaveLoad(t *testing.T) {
+	atree := NewAnalyzer()
+	scanner := NewScanner()
+
+	// Checkpoint halfway through adding the messages, and resume from the copy
+	for i, tc := range analyzerSshTests {
+		if i == len(analyzerSshTests)/2 {
+			var buf bytes.Buffer
+			require.NoError(t, atree.Save(&buf))
+
+			var err error
+			atree, err = LoadAnalyzer(&buf)
+			require.NoError(t, err)
+		}
+
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), tc.msg)
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	var buf bytes.Buffer
+	require.NoError(t, atree.Save(&buf))
+
+	atree, err := LoadAnalyzer(&buf)
+	require.NoError(t, err)
+
+	for _, tc := range analyzerSshTests {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err)
+		seq, err = atree.Analyze(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pat, seq.String(), tc.msg+"\n"+seq.PrintTokens())
+	}
+
+	_, err = LoadAnalyzer(strings.NewReader("garbage"))
+	require.Error(t, err)
+}
+
+func TestAnalyzerQueueID(t *testing.T) {
+	for _, tc := range []struct {
+		msg string
+		pat string
+	}{
+		{
+			"Oct 14 15:04:06 mail postfix/qmgr[1236]: 4BCDE1A2B3: removed",
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %queueid% : %action%",
+		},
+		{
+			"Oct 14 15:04:06 mail sendmail[1234]: t9EF45aB012345: lost input channel",
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %queueid% : lost input channel",
+		},
+		{
+			"Oct 14 15:04:06 mail kernel[0]: warning: lost input channel",
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : warning : lost input channel",
+		},
+	} {
+		seq, err := NewScanner().Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pat, analyzeSequence(seq).String(), tc.msg)
+	}
+
+	require.True(t, isQueueID("4BCDE1A2B3"))
+	require.False(t, isQueueID("warning"))
+	require.False(t, isQueueID("usb1"))
+	require.False(t, isQueueID("pam_unix1"))
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	AnomalyNew   = "new"   // The pattern was not seen in the previous intervals
+	AnomalySpike = "spike" // The pattern matched many more messages than its baseline
+	AnomalyDrop  = "drop"  // The pattern matched many fewer messages than its baseline, or none
+)
+
+// minBaseline is the baseline rate below which a pattern is forgotten, so the
+// baselines of patterns that are no longer seen don't accumulate.
+const minBaseline = 0.01
+
+// Anomaly is a pattern whose number of messages in an interval deviates sharply
+// from its baseline.
+type Anomaly struct {
+	Pattern  string  // Pattern identifies the pattern, e.g., its file and line.
+	Kind     string  // Kind is one of AnomalyNew, AnomalySpike and AnomalyDrop.
+	Count    int     // Count is the number of messages of the pattern in the interval.
+	Baseline float64 // Baseline is the expected number of messages in an interval.
+	Score    float64 // Score is the number of standard deviations Count is from Baseline.
+}
+
+// RateBaseline learns the baseline number of messages each pattern matches in an
+// interval, e.g., a minute, as an exponentially weighted moving average, and flags
+// the patterns whose number of messages in an interval deviates sharply from it:
+// new patterns, patterns bursting, and patterns that go quiet, e.g., because their
+// source stopped sending. It's safe to use concurrently.
+type RateBaseline struct {
+	mu sync.Mutex
+
+	// alpha is the weight of the latest interval in the averages, threshold is the
+	// score beyond which a count is an anomaly, and no anomalies are reported for
+	// the first warmup intervals
+	alpha     float64
+	threshold float64
+	warmup    int
+
+	intervals int
+	counts    map[string]int
+	rates     map[string]*patternRate
+}
+
+// patternRate is the moving average and variance of the number of messages of a
+// pattern in an interval.
+type patternRate struct {
+	mean     float64
+	variance float64
+}
+
+// NewRateBaseline returns a RateBaseline that weighs the latest interval by alpha,
+// between 0 and 1, reports the counts more than threshold standard deviations from
+// the baseline, and reports no anomalies until warmup intervals have been seen.
+func NewRateBaseline(alpha, threshold float64, warmup int) *RateBaseline {
+	return &RateBaseline{
+		alpha:     alpha,
+		threshold: threshold,
+		warmup:    warmup,
+		counts:    make(map[string]int),
+		rates:     make(map[string]*patternRate),
+	}
+}
+
+// Add counts a message of the pattern in the current interval.
+func (this *RateBaseline) Add(pattern string) {
+	this.mu.Lock()
+	this.counts[pattern]++
+	this.mu.Unlock()
+}
+
+// Tick ends the current interval, and returns the anomalies of the interval,
+// sorted by pattern, before adding its counts to the baselines.
+func (this *RateBaseline) Tick() []Anomaly {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	patterns := make([]string, 0, len(this.rates)+len(this.counts))
+	for pattern := range this.rates {
+		patterns = append(patterns, pattern)
+	}
+	for pattern := range this.counts {
+		if _, ok := this.rates[pattern]; !ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+
+	var anomalies []Anomaly
+
+	report := this.intervals >= this.warmup
+
+	for _, pattern := range patterns {
+		count := this.counts[pattern]
+
+		rate, ok := this.rates[pattern]
+		if !ok {
+			if report {
+				anomalies = append(anomalies, Anomaly{Pattern: pattern, Kind: AnomalyNew, Count: count})
+			}
+
+			this.rates[pattern] = &patternRate{mean: float64(count)}
+			continue
+		}
+
+		// counts are at least as variable as a poisson process with the same mean,
+		// and a single message is never an anomaly by itself
+		score := (float64(count) - rate.mean) / math.Sqrt(math.Max(math.Max(rate.variance, rate.mean), 1))
+
+		if report && score >= this.threshold {
+			anomalies = append(anomalies, Anomaly{Pattern: pattern, Kind: AnomalySpike, Count: count, Baseline: rate.mean, Score: score})
+		} else if report && score <= -this.threshold {
+			anomalies = append(anomalies, Anomaly{Pattern: pattern, Kind: AnomalyDrop, Count: count, Baseline: rate.mean, Score: score})
+		}
+
+		diff := float64(count) - rate.mean
+		incr := this.alpha * diff
+		rate.mean += incr
+		rate.variance = (1 - this.alpha) * (rate.variance + diff*incr)
+
+		if rate.mean < minBaseline {
+			delete(this.rates, pattern)
+		}
+	}
+
+	this.intervals++
+	this.counts = make(map[string]int)
+
+	return anomalies
+}
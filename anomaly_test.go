@@ -0,0 +1,62 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateBaseline(t *testing.T) {
+	rb := NewRateBaseline(0.1, 3, 5)
+
+	add := func(pattern string, n int) {
+		for i := 0; i < n; i++ {
+			rb.Add(pattern)
+		}
+	}
+
+	// Nothing is reported while warming up, steady rates are never reported, and
+	// neither are single messages of rare patterns
+	for i := 0; i < 20; i++ {
+		add("a", 10+i%3)
+		add("b", 20)
+
+		if i == 2 {
+			add("c", 1)
+		}
+
+		require.Equal(t, 0, len(rb.Tick()), "interval %d", i)
+	}
+
+	add("a", 100)
+	add("d", 5)
+
+	anomalies := rb.Tick()
+	require.Equal(t, 3, len(anomalies))
+
+	require.Equal(t, "a", anomalies[0].Pattern)
+	require.Equal(t, AnomalySpike, anomalies[0].Kind)
+	require.Equal(t, 100, anomalies[0].Count)
+	require.InDelta(t, 11, anomalies[0].Baseline, 1)
+
+	require.Equal(t, "b", anomalies[1].Pattern)
+	require.Equal(t, AnomalyDrop, anomalies[1].Kind)
+	require.Equal(t, 0, anomalies[1].Count)
+	require.True(t, anomalies[1].Score < -3)
+
+	require.Equal(t, Anomaly{Pattern: "d", Kind: AnomalyNew, Count: 5}, anomalies[2])
+}
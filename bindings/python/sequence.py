@@ -0,0 +1,207 @@
+# Copyright (c) 2014 Dataence, LLC. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Python bindings of sequence, using the C shared library built from
+cmd/libsequence, e.g.,
+
+    import sequence
+
+    sequence.read_config("sequence.toml")
+
+    parser = sequence.Parser()
+    parser.read_patterns("patterns/sshd.txt")
+    msg = parser.parse("Jan 12 06:49:42 irc sshd[7034]: Accepted password for root from 218.161.87.156 port 4709 ssh2")
+    msg["fields"]["srcip"]
+
+The library is loaded from $SEQUENCE_LIBRARY, or libsequence.so (libsequence.dylib
+on macOS) next to this file. Messages are scanned in the format given, one of
+general, json, kv, columns, haproxy or auto, the same as the --format of the sequence
+program. The results are dicts in the format of its json output. Parsers and
+analyzers can be shared by threads, the calls to an analyzer run one at a time.
+"""
+
+import ctypes
+import json
+import os
+import sys
+
+__all__ = ["SequenceError", "read_config", "read_config_data", "scan", "Parser", "Analyzer"]
+
+
+class SequenceError(Exception):
+    """The error returned by the library."""
+
+
+def _load():
+    path = os.environ.get("SEQUENCE_LIBRARY")
+    if not path:
+        ext = ".dylib" if sys.platform == "darwin" else ".so"
+        path = os.path.join(os.path.dirname(os.path.abspath(__file__)), "libsequence" + ext)
+
+    lib = ctypes.CDLL(path)
+
+    # The strings returned are declared as void pointers rather than c_char_p, so
+    # ctypes doesn't copy them and lose the pointer that has to be freed
+    results = {
+        "sequence_read_config": [ctypes.c_char_p],
+        "sequence_read_config_data": [ctypes.c_char_p],
+        "sequence_scan": [ctypes.c_char_p, ctypes.c_char_p],
+        "sequence_parser_read_patterns": [ctypes.c_int64, ctypes.c_char_p],
+        "sequence_parser_add_pattern": [ctypes.c_int64, ctypes.c_char_p],
+        "sequence_parser_parse": [ctypes.c_int64, ctypes.c_char_p, ctypes.c_char_p],
+        "sequence_analyzer_add": [ctypes.c_int64, ctypes.c_char_p, ctypes.c_char_p],
+        "sequence_analyzer_finalize": [ctypes.c_int64],
+        "sequence_analyzer_analyze": [ctypes.c_int64, ctypes.c_char_p, ctypes.c_char_p],
+        "sequence_analyzer_patterns": [ctypes.c_int64],
+    }
+
+    for name, argtypes in results.items():
+        fn = getattr(lib, name)
+        fn.argtypes = argtypes
+        fn.restype = ctypes.c_void_p
+
+    for name in ("sequence_parser_new", "sequence_analyzer_new"):
+        fn = getattr(lib, name)
+        fn.argtypes = []
+        fn.restype = ctypes.c_int64
+
+    for name in ("sequence_parser_free", "sequence_analyzer_free"):
+        fn = getattr(lib, name)
+        fn.argtypes = [ctypes.c_int64]
+        fn.restype = None
+
+    lib.sequence_free.argtypes = [ctypes.c_void_p]
+    lib.sequence_free.restype = None
+
+    return lib
+
+
+_lib = _load()
+
+
+def _call(fn, *args):
+    """Calls the library function, and returns its result, or raises its error."""
+    args = [a.encode("utf-8") if isinstance(a, str) else a for a in args]
+
+    ptr = fn(*args)
+    try:
+        result = json.loads(ctypes.string_at(ptr).decode("utf-8"))
+    finally:
+        _lib.sequence_free(ptr)
+
+    if isinstance(result, dict) and "error" in result:
+        raise SequenceError(result["error"])
+
+    return result
+
+
+def read_config(path):
+    """Reads the TOML-formatted config file, e.g., sequence.toml. It must be read
+    before anything else."""
+    _call(_lib.sequence_read_config, os.fspath(path))
+
+
+def read_config_data(data):
+    """Reads the TOML-formatted config."""
+    _call(_lib.sequence_read_config_data, data)
+
+
+def scan(msg, format="general"):
+    """Returns the message and its tokens."""
+    return _call(_lib.sequence_scan, format, msg)
+
+
+class Parser(object):
+    """Parses messages with the patterns added to it."""
+
+    def __init__(self, *paths):
+        self._h = _lib.sequence_parser_new()
+        for path in paths:
+            self.read_patterns(path)
+
+    def close(self):
+        if self._h:
+            _lib.sequence_parser_free(self._h)
+            self._h = 0
+
+    def __del__(self):
+        self.close()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def read_patterns(self, path):
+        """Adds the patterns in the pattern file, and returns the number added."""
+        return _call(_lib.sequence_parser_read_patterns, self._h, os.fspath(path))["patterns"]
+
+    def add_pattern(self, text):
+        """Adds the pattern, e.g., one found by an Analyzer."""
+        _call(_lib.sequence_parser_add_pattern, self._h, text)
+
+    def parse(self, msg, format="general"):
+        """Returns the message, its tokens, the pattern that matched, and the values
+        of the tagged tokens in "fields". Raises SequenceError if no pattern
+        matches."""
+        return _call(_lib.sequence_parser_parse, self._h, format, msg)
+
+
+class Analyzer(object):
+    """Finds the patterns of messages. All the messages are added, the analyzer is
+    finalized, and then each message is analyzed to get its pattern."""
+
+    def __init__(self):
+        self._h = _lib.sequence_analyzer_new()
+
+    def close(self):
+        if self._h:
+            _lib.sequence_analyzer_free(self._h)
+            self._h = 0
+
+    def __del__(self):
+        self.close()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def add(self, msg, format="general"):
+        _call(_lib.sequence_analyzer_add, self._h, format, msg)
+
+    def finalize(self):
+        _call(_lib.sequence_analyzer_finalize, self._h)
+
+    def analyze(self, msg, format="general"):
+        """Returns the message, its tokens and its pattern."""
+        return _call(_lib.sequence_analyzer_analyze, self._h, format, msg)
+
+    def patterns(self):
+        """Returns the patterns of the messages analyzed so far, most matched
+        first."""
+        return _call(_lib.sequence_analyzer_patterns, self._h)["patterns"]
+
+    def fit(self, msgs, format="general"):
+        """Adds the messages, finalizes the analyzer, analyzes the messages, and
+        returns their patterns, most matched first."""
+        msgs = list(msgs)
+        for msg in msgs:
+            self.add(msg, format)
+        self.finalize()
+        for msg in msgs:
+            self.analyze(msg, format)
+        return self.patterns()
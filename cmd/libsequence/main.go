@@ -0,0 +1,476 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// libsequence exports the scanner, parser and analyzer of sequence as a C shared
+// library, so they can be used from other languages, e.g., Python with ctypes,
+// without running the sequence program. It's built with
+//
+//	go build -buildmode=c-shared -o libsequence.so ./cmd/libsequence
+//
+// which also writes libsequence.h with the declarations of the functions.
+//
+// The strings passed in are NUL-terminated UTF-8, and are not kept. The functions
+// that return a char * return a JSON object, which the caller owns and must
+// release with sequence_free. If the call failed, the object is {"error": "..."}.
+// Parsers and analyzers are referred to by handles, which are released with
+// sequence_parser_free and sequence_analyzer_free. A handle can be used from
+// several threads.
+//
+// sequence_read_config or sequence_read_config_data must be called before anything
+// else, and not while the other functions are running, since the config is global.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	mu         sync.Mutex
+	configured bool
+	handles    = make(map[int64]interface{})
+	lastHandle int64
+)
+
+// lockedAnalyzer is an analyzer with the lock of the calls using it, since the
+// calls can come from several threads, e.g., Python threads, as ctypes releases
+// the GIL during the calls, and analyzers are not safe to use concurrently. Parsers
+// are.
+type lockedAnalyzer struct {
+	mu       sync.Mutex
+	analyzer *sequence.Analyzer
+}
+
+// jsonMessage is a scanned, parsed or analyzed message, in the same format as the
+// json output of the sequence program, with the tagged values in fields.
+type jsonMessage struct {
+	Message string            `json:"message"`
+	Pattern string            `json:"pattern,omitempty"`
+	Tokens  []jsonToken       `json:"tokens"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// jsonToken is a single token of a jsonMessage. Offset is the byte offset of the
+// token in the message, or -1 if the value doesn't appear as is in the message.
+// Layout is the time format time tokens are parsed with, if any.
+type jsonToken struct {
+	Tag    string `json:"tag"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Offset int    `json:"offset"`
+	Layout string `json:"layout,omitempty"`
+}
+
+// jsonError is the result of a call that failed.
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+func main() {}
+
+// sequence_free releases a string returned by the library.
+//
+//export sequence_free
+func sequence_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// sequence_read_config reads the TOML-formatted config file, e.g., sequence.toml.
+//
+//export sequence_read_config
+func sequence_read_config(file *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		return readConfig(func() error { return sequence.ReadConfig(C.GoString(file)) })
+	})
+}
+
+// sequence_read_config_data reads the TOML-formatted config.
+//
+//export sequence_read_config_data
+func sequence_read_config_data(data *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		return readConfig(func() error { return sequence.ReadConfigData([]byte(C.GoString(data))) })
+	})
+}
+
+// sequence_scan scans the message in the format, one of general (or empty), json,
+// kv, columns, haproxy or auto, and returns its tokens.
+//
+//export sequence_scan
+func sequence_scan(format, msg *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		m := C.GoString(msg)
+
+		seq, err := scan(C.GoString(format), m)
+		if err != nil {
+			return nil, err
+		}
+
+		return newMessage(m, "", seq, false), nil
+	})
+}
+
+// sequence_parser_new returns the handle of a new parser with no patterns.
+//
+//export sequence_parser_new
+func sequence_parser_new() int64 {
+	return newHandle(sequence.NewParser())
+}
+
+// sequence_parser_free releases the parser.
+//
+//export sequence_parser_free
+func sequence_parser_free(h int64) {
+	freeHandle(h)
+}
+
+// sequence_parser_read_patterns adds the patterns in the pattern file to the parser,
+// and returns the number added, e.g., {"patterns": 12}.
+//
+//export sequence_parser_read_patterns
+func sequence_parser_read_patterns(h int64, file *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		parser, err := getParser(h)
+		if err != nil {
+			return nil, err
+		}
+
+		pats, err := sequence.ReadPatterns(C.GoString(file))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pat := range pats {
+			if err := parser.AddPattern(pat); err != nil {
+				return nil, fmt.Errorf("Error adding pattern %s: %v", pat, err)
+			}
+		}
+
+		return map[string]int{"patterns": len(pats)}, nil
+	})
+}
+
+// sequence_parser_add_pattern adds the pattern text, e.g., one returned by
+// sequence_analyzer_patterns, to the parser.
+//
+//export sequence_parser_add_pattern
+func sequence_parser_add_pattern(h int64, text *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		parser, err := getParser(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := parser.AddPattern(sequence.Pattern{Text: C.GoString(text)}); err != nil {
+			return nil, err
+		}
+
+		return map[string]int{"patterns": 1}, nil
+	})
+}
+
+// sequence_parser_parse scans the message in the format and parses it, and returns
+// its tokens, the pattern that matched, and the values of the tagged tokens by tag.
+//
+//export sequence_parser_parse
+func sequence_parser_parse(h int64, format, msg *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		parser, err := getParser(h)
+		if err != nil {
+			return nil, err
+		}
+
+		m := C.GoString(msg)
+
+		seq, err := scan(C.GoString(format), m)
+		if err != nil {
+			return nil, err
+		}
+
+		seq, pat, err := parser.Match(seq)
+		if err != nil {
+			return nil, err
+		}
+
+		var pattern string
+		if pat != nil {
+			pattern = pat.Text
+		}
+
+		return newMessage(m, pattern, seq, true), nil
+	})
+}
+
+// sequence_analyzer_new returns the handle of a new analyzer.
+//
+//export sequence_analyzer_new
+func sequence_analyzer_new() int64 {
+	return newHandle(&lockedAnalyzer{analyzer: sequence.NewAnalyzer()})
+}
+
+// sequence_analyzer_free releases the analyzer.
+//
+//export sequence_analyzer_free
+func sequence_analyzer_free(h int64) {
+	freeHandle(h)
+}
+
+// sequence_analyzer_add scans the message in the format and adds it to the
+// analyzer. All the messages are added before the analyzer is finalized.
+//
+//export sequence_analyzer_add
+func sequence_analyzer_add(h int64, format, msg *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		analyzer, unlock, err := getAnalyzer(h)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		seq, err := scan(C.GoString(format), C.GoString(msg))
+		if err != nil {
+			return nil, err
+		}
+
+		return struct{}{}, analyzer.Add(seq)
+	})
+}
+
+// sequence_analyzer_finalize finalizes the analyzer, after which messages can be
+// analyzed but no more can be added.
+//
+//export sequence_analyzer_finalize
+func sequence_analyzer_finalize(h int64) *C.char {
+	return result(func() (interface{}, error) {
+		analyzer, unlock, err := getAnalyzer(h)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		return struct{}{}, analyzer.Finalize()
+	})
+}
+
+// sequence_analyzer_analyze scans the message in the format and analyzes it with
+// the finalized analyzer, and returns its tokens and the pattern that matches it.
+//
+//export sequence_analyzer_analyze
+func sequence_analyzer_analyze(h int64, format, msg *C.char) *C.char {
+	return result(func() (interface{}, error) {
+		analyzer, unlock, err := getAnalyzer(h)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		m := C.GoString(msg)
+
+		seq, err := scan(C.GoString(format), m)
+		if err != nil {
+			return nil, err
+		}
+
+		seq, err = analyzer.Analyze(seq)
+		if err != nil {
+			return nil, err
+		}
+
+		return newMessage(m, seq.String(), seq, false), nil
+	})
+}
+
+// sequence_analyzer_patterns returns the patterns of the messages analyzed so far,
+// most matched first, e.g., {"patterns": ["%msgtime% ...", ...]}.
+//
+//export sequence_analyzer_patterns
+func sequence_analyzer_patterns(h int64) *C.char {
+	return result(func() (interface{}, error) {
+		analyzer, unlock, err := getAnalyzer(h)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		pats := analyzer.Patterns()
+		texts := make([]string, len(pats))
+		for i, pat := range pats {
+			texts[i] = pat.Text
+		}
+
+		return map[string][]string{"patterns": texts}, nil
+	})
+}
+
+// result returns the value returned by fn as a JSON C string, or the error. Panics
+// are returned as errors too, since they would otherwise take down the program
+// the library is loaded in.
+func result(fn func() (interface{}, error)) (s *C.char) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = marshal(jsonError{Error: fmt.Sprint(r)})
+		}
+	}()
+
+	v, err := fn()
+	if err != nil {
+		return marshal(jsonError{Error: err.Error()})
+	}
+
+	return marshal(v)
+}
+
+func marshal(v interface{}) *C.char {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		buf, _ = json.Marshal(jsonError{Error: err.Error()})
+	}
+
+	return C.CString(string(buf))
+}
+
+func readConfig(read func() error) (interface{}, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := read(); err != nil {
+		return nil, err
+	}
+
+	configured = true
+
+	return struct{}{}, nil
+}
+
+// scan scans the message in the format, the same way the sequence program does
+// with --format. The w3c format is not supported, since it depends on the lines
+// scanned before the message.
+func scan(format, msg string) (sequence.Sequence, error) {
+	mu.Lock()
+	ok := configured
+	mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid call: no config read, call sequence_read_config first")
+	}
+
+	// The text is kept so the rest of the messages matched by prefix patterns is as is
+	scanner := sequence.NewScanner()
+	scanner.SetKeepText(true)
+
+	switch format {
+	case "", "general":
+		return scanner.Scan(msg)
+
+	case "json":
+		return scanner.ScanJson(msg)
+
+	case "kv":
+		return scanner.ScanKV(msg)
+
+	case "columns":
+		return scanner.ScanColumns(msg)
+
+	case "haproxy":
+		return scanner.ScanHAProxy(msg)
+
+	case "auto":
+		return scanner.ScanAuto(msg)
+	}
+
+	return nil, fmt.Errorf("Invalid format %q: expecting general, json, kv, columns, haproxy or auto", format)
+}
+
+// newMessage returns the message and its tokens, with the values of the tagged
+// tokens by tag if fields is true.
+func newMessage(msg, pattern string, seq sequence.Sequence, fields bool) *jsonMessage {
+	offsets := seq.Offsets(msg)
+
+	m := &jsonMessage{
+		Message: msg,
+		Pattern: pattern,
+		Tokens:  make([]jsonToken, len(seq)),
+	}
+
+	if fields {
+		m.Fields = make(map[string]string)
+	}
+
+	for i, t := range seq {
+		m.Tokens[i] = jsonToken{Tag: t.Tag.String(), Type: t.Type.String(), Value: t.Value, Offset: offsets[i]}
+
+		if t.Type == sequence.TokenTime {
+			m.Tokens[i].Layout, _ = t.TimeLayout()
+		}
+
+		if fields && t.Tag != sequence.TagUnknown {
+			m.Fields[t.Tag.String()] = t.Value
+		}
+	}
+
+	return m
+}
+
+func newHandle(v interface{}) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastHandle++
+	handles[lastHandle] = v
+
+	return lastHandle
+}
+
+func freeHandle(h int64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(handles, h)
+}
+
+func getParser(h int64) (*sequence.Parser, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if parser, ok := handles[h].(*sequence.Parser); ok {
+		return parser, nil
+	}
+
+	return nil, fmt.Errorf("Invalid parser handle %d", h)
+}
+
+// getAnalyzer returns the analyzer of the handle, locked for the call, and the
+// function to unlock it.
+func getAnalyzer(h int64) (*sequence.Analyzer, func(), error) {
+	mu.Lock()
+	la, ok := handles[h].(*lockedAnalyzer)
+	mu.Unlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("Invalid analyzer handle %d", h)
+	}
+
+	la.mu.Lock()
+
+	return la.analyzer, la.mu.Unlock, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/trustpath/sequence"
+)
+
+const (
+	// anomalyAlpha is the weight of the latest interval in the pattern baselines,
+	// and anomalyWarmup the number of intervals learned before reporting anomalies
+	anomalyAlpha  = 0.1
+	anomalyWarmup = 10
+
+	// anomalyUnmatched is the pattern of the messages that don't match any
+	anomalyUnmatched = "unmatched"
+)
+
+var (
+	anomalyfile      string
+	anomalyinterval  time.Duration
+	anomalythreshold float64
+)
+
+// anomalyWatcher learns the baseline number of messages each pattern matches in
+// every anomaly interval of a long running parse, e.g., of a named pipe, and writes
+// the patterns that deviate sharply from it, such as bursts of new patterns or
+// sources going quiet, as json events to the anomalies file.
+type anomalyWatcher struct {
+	baseline *sequence.RateBaseline
+	w        io.WriteCloser
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// anomalyEvent is an anomaly written to the anomalies file.
+type anomalyEvent struct {
+	Time     time.Time `json:"time"`
+	Pattern  string    `json:"pattern"`
+	Kind     string    `json:"kind"`
+	Count    int       `json:"count"`
+	Baseline float64   `json:"baseline"`
+	Score    float64   `json:"score"`
+}
+
+// startAnomalies starts watching the pattern rates, or returns nil if there's no
+// anomalies file.
+func startAnomalies() *anomalyWatcher {
+	if anomalyfile == "" {
+		return nil
+	}
+
+	if anomalyinterval <= 0 || anomalythreshold <= 0 {
+		log.Fatalf("Invalid anomaly interval %s and threshold %g: expecting positive values", anomalyinterval, anomalythreshold)
+	}
+
+	this := &anomalyWatcher{
+		baseline: sequence.NewRateBaseline(anomalyAlpha, anomalythreshold, anomalyWarmup),
+		w:        openOutput(anomalyfile),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(this.done)
+
+		ticker := time.NewTicker(anomalyinterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				this.report(now)
+
+			case <-this.quit:
+				return
+			}
+		}
+	}()
+
+	return this
+}
+
+// Add counts a message matched by the pattern, or unmatched if pat is nil.
+func (this *anomalyWatcher) Add(pat *sequence.Pattern) {
+	if pat == nil {
+		this.baseline.Add(anomalyUnmatched)
+	} else {
+		this.baseline.Add(pat.String())
+	}
+}
+
+// Stop stops watching the pattern rates, and closes the anomalies file. The last,
+// partial, interval is not reported.
+func (this *anomalyWatcher) Stop() {
+	close(this.quit)
+	<-this.done
+
+	if err := this.w.Close(); err != nil {
+		warnf("Error writing anomalies to %s: %v", anomalyfile, err)
+	}
+}
+
+func (this *anomalyWatcher) report(now time.Time) {
+	anomalies := this.baseline.Tick()
+
+	for _, a := range anomalies {
+		warnf("Pattern %s anomaly, %s: %d messages, baseline %.2f.", a.Pattern, a.Kind, a.Count, a.Baseline)
+
+		buf, err := json.Marshal(anomalyEvent{Time: now, Pattern: a.Pattern, Kind: a.Kind, Count: a.Count, Baseline: a.Baseline, Score: a.Score})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := this.w.Write(append(buf, '\n')); err != nil {
+			warnf("Error writing anomalies to %s: %v", anomalyfile, err)
+		}
+	}
+
+	setMetric("sequence_stream_pattern_anomalies", "Number of patterns whose rate deviated from their baseline in the last anomaly interval.", float64(len(anomalies)))
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/trustpath/sequence"
+)
+
+// tarSeparator separates the name of a tar archive from the name of one of its
+// members in an input file name, e.g., "logs.tgz!var/log/syslog", which is also
+// the source of the records of the member in the output.
+const tarSeparator = "!"
+
+var (
+	tarmembers string
+
+	// tarPositions are the positions of the headers of the tar members expanded by
+	// expandTarFiles in their archives, by input file name, and tarLast is the last
+	// member expanded of each archive
+	tarPositions = make(map[string]int)
+	tarLast      = make(map[string]string)
+
+	// tarParked are the archives left right after the member read last, so the
+	// next member is read from there, and the members of an archive read in order
+	// cost a single pass over it
+	tarParked = make(map[string]*tarArchive)
+	tarMu     sync.Mutex
+)
+
+// tarArchive is a tar archive opened to read its members, and pos is the number of
+// its headers read so far.
+type tarArchive struct {
+	tr  *tar.Reader
+	c   io.Closer
+	pos int
+}
+
+// isTarFile returns true if the file is a tar archive, possibly gzipped.
+func isTarFile(fname string) bool {
+	return strings.HasSuffix(fname, ".tar") || strings.HasSuffix(fname, ".tar.gz") || strings.HasSuffix(fname, ".tgz")
+}
+
+// splitTarName returns the archive and the member of the input file name of a tar
+// member, or empty strings if it's not one.
+func splitTarName(fname string) (string, string) {
+	for i := strings.Index(fname, tarSeparator); i != -1; {
+		if isTarFile(fname[:i]) {
+			return fname[:i], fname[i+len(tarSeparator):]
+		}
+
+		k := strings.Index(fname[i+1:], tarSeparator)
+		if k == -1 {
+			break
+		}
+		i += 1 + k
+	}
+
+	return "", ""
+}
+
+// isTarInput returns true if the input file is a tar archive or one of its members.
+func isTarInput(fname string) bool {
+	archive, _ := splitTarName(fname)
+	return archive != "" || isTarFile(fname)
+}
+
+// matchTarMember returns true if the name of the tar member matches the tar members
+// glob, either as a whole, e.g., "var/log/*.log", or just its base name, e.g.,
+// "*.log". All members match if no glob is specified.
+func matchTarMember(name string) bool {
+	if tarmembers == "" {
+		return true
+	}
+
+	if ok, _ := path.Match(tarmembers, name); ok {
+		return true
+	}
+
+	ok, _ := path.Match(tarmembers, path.Base(name))
+	return ok
+}
+
+// expandTarFiles replaces the tar archives in the input files with the input file
+// names of their regular members that match the tar members glob, so each member
+// is processed as a separate input file. The other files are kept as is.
+func expandTarFiles(files []string) []string {
+	if _, err := path.Match(tarmembers, ""); err != nil {
+		log.Fatalf("Invalid tar members %q: %v", tarmembers, err)
+	}
+
+	expanded := make([]string, 0, len(files))
+
+	for _, file := range files {
+		if !isTarFile(file) {
+			expanded = append(expanded, file)
+			continue
+		}
+
+		tr, c := openTar(file)
+
+		n := len(expanded)
+
+		for pos := 0; ; pos++ {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Fatalf("Error reading tar archive %s: %v", file, err)
+			}
+
+			if isTarRegular(hdr) && matchTarMember(hdr.Name) {
+				name := file + tarSeparator + hdr.Name
+
+				tarMu.Lock()
+				tarPositions[name], tarLast[file] = pos, name
+				tarMu.Unlock()
+
+				expanded = append(expanded, name)
+			}
+		}
+
+		c.Close()
+
+		if len(expanded) == n {
+			warnf("No members of tar archive %s match %q, skipping it.", file, tarmembers)
+		} else {
+			debugf("Found %d members of tar archive %s.", len(expanded)-n, file)
+		}
+	}
+
+	return expanded
+}
+
+// openTarInput opens an input file that's either a tar archive, in which case the
+// members that match the tar members glob are read one after the other, or a
+// member of one, which is read from where the member before it was, if it was the
+// last read, rather than from the start of the archive.
+func openTarInput(fname string) (io.Reader, io.Closer) {
+	archive, member := splitTarName(fname)
+
+	if archive == "" {
+		tr, c := openTar(fname)
+		return &inputErrReader{r: &tarMemberReader{ar: &tarArchive{tr: tr, c: c}, match: matchTarMember}, fname: fname}, c
+	}
+
+	r := &tarMemberReader{
+		ar:    takeTarArchive(archive, fname),
+		match: func(name string) bool { return name == member },
+		once:  true,
+	}
+
+	return &inputErrReader{r: r, fname: fname}, &tarMemberCloser{r: r, archive: archive, fname: fname}
+}
+
+// takeTarArchive returns the archive parked before the tar member, or opens it
+// again if it's not.
+func takeTarArchive(archive, fname string) *tarArchive {
+	tarMu.Lock()
+	ar := tarParked[archive]
+	if pos, ok := tarPositions[fname]; ar != nil && ok && ar.pos <= pos {
+		delete(tarParked, archive)
+		tarMu.Unlock()
+		return ar
+	}
+	tarMu.Unlock()
+
+	tr, c := openTar(archive)
+
+	return &tarArchive{tr: tr, c: c}
+}
+
+// tarMemberCloser parks the archive of the tar member once the member is read, if
+// there are members after it, or closes it.
+type tarMemberCloser struct {
+	r       *tarMemberReader
+	archive string
+	fname   string
+}
+
+func (this *tarMemberCloser) Close() error {
+	tarMu.Lock()
+	defer tarMu.Unlock()
+
+	if !this.r.done || tarLast[this.archive] == this.fname {
+		return this.r.ar.c.Close()
+	}
+
+	if ar := tarParked[this.archive]; ar != nil {
+		ar.c.Close()
+	}
+
+	tarParked[this.archive] = this.r.ar
+
+	return nil
+}
+
+// openTar opens the tar archive, decompressing it if it's gzipped.
+func openTar(archive string) (*tar.Reader, io.Closer) {
+	f, err := os.Open(archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := progressReader(f, archive)
+
+	if !strings.HasSuffix(archive, ".tar") {
+		gunzip, err := sequence.NewGzipReader(r)
+		if err != nil {
+			log.Fatalf("Error reading tar archive %s: %v", archive, err)
+		}
+
+		r = gunzip
+	}
+
+	return tar.NewReader(r), f
+}
+
+func isTarRegular(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA
+}
+
+// tarMemberReader reads the contents of the regular members of a tar archive that
+// match, one after the other, or only the first if once is true, after which done
+// is true. Gzipped members, e.g., rotated logs, are decompressed, and a line break
+// is added after members that don't end with one, so the last record of a member
+// isn't joined with the first of the next.
+type tarMemberReader struct {
+	ar    *tarArchive
+	match func(string) bool
+	once  bool
+	done  bool
+
+	// cur is the reader of the current member, if any, and last is the last byte
+	// read from the members
+	cur  io.Reader
+	last byte
+}
+
+func (this *tarMemberReader) Read(p []byte) (int, error) {
+	for len(p) > 0 {
+		if this.cur == nil {
+			if this.last != 0 && this.last != '\n' {
+				p[0], this.last = '\n', '\n'
+				return 1, nil
+			}
+
+			if this.done {
+				return 0, io.EOF
+			}
+
+			hdr, err := this.ar.tr.Next()
+			if err != nil {
+				return 0, err
+			}
+
+			this.ar.pos++
+
+			if !isTarRegular(hdr) || !this.match(hdr.Name) {
+				continue
+			}
+
+			this.cur = this.ar.tr
+
+			if strings.HasSuffix(hdr.Name, ".gz") {
+				gunzip, err := sequence.NewGzipReader(this.ar.tr)
+				if err != nil {
+					return 0, fmt.Errorf("Invalid tar member %s: %v", hdr.Name, err)
+				}
+
+				this.cur = gunzip
+			}
+		}
+
+		n, err := this.cur.Read(p)
+		if n > 0 {
+			this.last = p[n-1]
+		}
+
+		if err == io.EOF {
+			this.cur, this.done, err = nil, this.once, nil
+		}
+
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+
+	return 0, nil
+}
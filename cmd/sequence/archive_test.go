@@ -0,0 +1,95 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarMembers(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "logs.tgz")
+
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	for _, m := range []struct{ name, data string }{
+		{"a.log", "a1\na2\n"},
+		{"skip.txt", "skipped\n"},
+		{"b.log", "b1"},
+		{"c.log", "c1\n"},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0600, Size: int64(len(m.data)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(m.data))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, f.Close())
+
+	defer func(m string) { tarmembers = m }(tarmembers)
+	tarmembers = "*.log"
+
+	files := expandTarFiles([]string{archive})
+	require.Equal(t, []string{archive + "!a.log", archive + "!b.log", archive + "!c.log"}, files)
+
+	read := func(fname string) (string, *tarArchive) {
+		r, c := openTarInput(fname)
+		defer c.Close()
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+
+		return string(data), r.(*inputErrReader).r.(*tarMemberReader).ar
+	}
+
+	// The members read in order are read from the same pass over the archive, and
+	// the archive is closed after the last one
+	a, ar := read(files[0])
+	require.Equal(t, "a1\na2\n", a)
+	require.True(t, tarParked[archive] == ar)
+
+	b, br := read(files[1])
+	require.Equal(t, "b1\n", b)
+	require.True(t, br == ar)
+
+	c, cr := read(files[2])
+	require.Equal(t, "c1\n", c)
+	require.True(t, cr == ar)
+	require.Nil(t, tarParked[archive])
+
+	// The members read out of order are read from the start of the archive again
+	b, br = read(files[1])
+	require.Equal(t, "b1\n", b)
+	require.True(t, br != ar)
+
+	a, ar = read(files[0])
+	require.Equal(t, "a1\na2\n", a)
+	require.True(t, ar != br)
+	require.True(t, tarParked[archive] == ar)
+
+	tarParked[archive].c.Close()
+	delete(tarParked, archive)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	sweepworkers string
+)
+
+// runBench runs fn on each of the lines using the number of workers, each with its
+// own scanner, and returns the time it took.
+func runBench(lines []string, workers int, fn func(*sequence.Scanner, string)) time.Duration {
+	now := time.Now()
+
+	if workers == 1 {
+		scanner := newScanner()
+
+		for _, line := range lines {
+			fn(scanner, line)
+		}
+
+		return time.Since(now)
+	}
+
+	var wg sync.WaitGroup
+	msgpipe := make(chan string, 10000)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scanner := newScanner()
+
+			for line := range msgpipe {
+				fn(scanner, line)
+			}
+		}()
+	}
+
+	for _, line := range lines {
+		msgpipe <- line
+	}
+	close(msgpipe)
+
+	wg.Wait()
+
+	return time.Since(now)
+}
+
+// parseWorkers parses a comma separated list of worker counts, e.g., "1,2,4,8".
+func parseWorkers(s string) ([]int, error) {
+	var counts []int
+
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid worker count %q in %q: expecting a positive integer", f, s)
+		}
+		counts = append(counts, n)
+	}
+
+	return counts, nil
+}
+
+// sweepBench runs the benchmark at each of the worker counts of the sweep workers
+// flag, and writes a table of the throughput at each count, along with the speedup
+// and the efficiency relative to the first count, so it's easy to see where adding
+// workers stops paying off.
+func sweepBench(lines []string, size int, fn func(*sequence.Scanner, string)) {
+	counts, err := parseWorkers(sweepworkers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	w := tabwriter.NewWriter(ofile, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "workers\tsecs\tmsgs/sec\tMB/sec\tspeedup\tefficiency\t\n")
+
+	var base float64
+
+	for _, n := range counts {
+		secs := runBench(lines, n, fn).Seconds()
+		rate := float64(len(lines)) / secs
+
+		if base == 0 {
+			base = rate
+		}
+
+		speedup := rate / base
+		efficiency := speedup / (float64(n) / float64(counts[0]))
+
+		fmt.Fprintf(w, "%d\t%.2f\t%.2f\t%.2f\t%.2fx\t%.0f%%\t\n", n, secs, rate, float64(size)/float64(mbyte)/secs, speedup, efficiency*100)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// version is the version of the program, set when it's built using
+	// -ldflags "-X main.version=1.2.3"
+	version = "dev"
+
+	// components are the optional parts of the program included in the build,
+	// each registered by the file that implements it
+	components []string
+)
+
+// buildInfo writes the version of the program, how it was built, and the optional
+// components included in the build.
+func buildInfo(cmd *cobra.Command, args []string) {
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	cgo := "unknown"
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "CGO_ENABLED" {
+				cgo = s.Value
+			}
+		}
+	}
+
+	sort.Strings(components)
+
+	fmt.Fprintf(ofile, "version:     %s\n", version)
+	fmt.Fprintf(ofile, "go:          %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(ofile, "cgo:         %s\n", cgo)
+	fmt.Fprintf(ofile, "components:  %s\n", strings.Join(components, ", "))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"os"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	ckptfile  string
+	ckptevery int
+)
+
+// checkpoint is the progress of analyze, saved periodically so the analysis of a
+// huge file can be resumed after an interruption instead of starting over.
+type checkpoint struct {
+	Pass     int   // Pass is 1 while adding messages, and 2 while collecting patterns.
+	Offset   int64 // Offset is the position of the last message processed in the pass.
+	Messages int   // Messages is the number of messages collected in the 2nd pass.
+	Analyzer []byte
+
+	Parsed   map[string]checkpointStat
+	Analyzed map[string]checkpointStat
+}
+
+type checkpointStat struct {
+	Example string
+	Count   int
+}
+
+// loadCheckpoint reads the checkpoint file, if any. It returns nil if there's no
+// checkpoint to resume from.
+func loadCheckpoint() *checkpoint {
+	if ckptfile == "" {
+		return nil
+	}
+
+	f, err := os.Open(ckptfile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	ckpt := &checkpoint{}
+
+	if err := gob.NewDecoder(f).Decode(ckpt); err != nil {
+		log.Fatalf("Error reading checkpoint %s: %v", ckptfile, err)
+	}
+
+	infof("Resuming pass %d of analysis after offset %d from checkpoint %s.", ckpt.Pass, ckpt.Offset, ckptfile)
+
+	return ckpt
+}
+
+// analyzer returns the analyzer saved in the checkpoint.
+func (this *checkpoint) analyzer() *sequence.Analyzer {
+	analyzer, err := sequence.LoadAnalyzer(bytes.NewReader(this.Analyzer))
+	if err != nil {
+		log.Fatalf("Error reading checkpoint %s: %v", ckptfile, err)
+	}
+
+	return analyzer
+}
+
+// saveCheckpoint writes the checkpoint file, replacing the previous one only once
+// the new one is completely written, so an interruption while saving doesn't lose
+// the previous checkpoint.
+func saveCheckpoint(pass int, pos sequence.Position, n int, analyzer *sequence.Analyzer, pmap, amap map[string]pMapStruct) {
+	var buf bytes.Buffer
+
+	if err := analyzer.Save(&buf); err != nil {
+		log.Fatal(err)
+	}
+
+	ckpt := checkpoint{
+		Pass:     pass,
+		Offset:   pos.Offset,
+		Messages: n,
+		Analyzer: buf.Bytes(),
+		Parsed:   fromStats(pmap),
+		Analyzed: fromStats(amap),
+	}
+
+	tmpfile := ckptfile + ".tmp"
+
+	f, err := os.OpenFile(tmpfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := gob.NewEncoder(f).Encode(&ckpt); err != nil {
+		log.Fatalf("Error writing checkpoint %s: %v", ckptfile, err)
+	}
+
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.Rename(tmpfile, ckptfile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// removeCheckpoint removes the checkpoint file once the analysis is complete.
+func removeCheckpoint() {
+	if ckptfile == "" {
+		return
+	}
+
+	if err := os.Remove(ckptfile); err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+}
+
+func fromStats(m map[string]pMapStruct) map[string]checkpointStat {
+	stats := make(map[string]checkpointStat, len(m))
+
+	for pat, stat := range m {
+		stats[pat] = checkpointStat{Example: stat.ex, Count: stat.cnt}
+	}
+
+	return stats
+}
+
+func toStats(stats map[string]checkpointStat) map[string]pMapStruct {
+	m := make(map[string]pMapStruct, len(stats))
+
+	for pat, stat := range stats {
+		m[pat] = pMapStruct{ex: stat.Example, cnt: stat.Count}
+	}
+
+	return m
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	chunksize int
+)
+
+// chunk is a run of consecutive records of an input file, which is processed by
+// one of the workers of analyze.
+type chunk struct {
+	index int
+
+	// header is the block of comment lines in effect at the start of the chunk,
+	// e.g., the fields of a W3C log, which the worker's scanner has to see first
+	header []string
+
+	lines []string
+	pos   []sequence.Position
+
+	// n is the number of messages, the lines that are not comments or empty
+	n int
+}
+
+// each calls fn for each of the messages of the chunk, skipping the comments and
+// empty lines.
+func (this *chunk) each(scanner *sequence.Scanner, fn func(line string, pos sequence.Position)) {
+	for _, line := range this.header {
+		skipLine(scanner, line)
+	}
+
+	for i, line := range this.lines {
+		if !skipLine(scanner, line) {
+			fn(line, this.pos[i])
+		}
+	}
+}
+
+// last returns the position of the last record of the chunk.
+func (this *chunk) last() sequence.Position {
+	return this.pos[len(this.pos)-1]
+}
+
+type chunkResult struct {
+	chunk  *chunk
+	result interface{}
+}
+
+// forEachChunk reads the records of the files, in order, in chunks of chunksize
+// records, and calls work for each chunk on one of fworkers workers, each with a
+// scanner of its own. done is called with each chunk and the result of its work
+// in the order of the chunks, so the results can be merged in the same order the
+// records would be processed in by a single worker. The messages at or before the
+// offset are skipped, e.g., those processed before a checkpoint.
+func forEachChunk(files []string, offset int64, work func(c *chunk, scanner *sequence.Scanner) interface{}, done func(c *chunk, result interface{})) {
+	if chunksize < 1 {
+		log.Fatalf("Invalid chunk size %d: expecting a positive number of messages", chunksize)
+	}
+
+	workers := fworkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan *chunk, workers)
+	results := make(chan chunkResult, workers)
+
+	// inflight limits the chunks read but not done yet, so a slow chunk doesn't
+	// let the chunks after it pile up in memory
+	inflight := make(chan struct{}, 2*workers)
+
+	go func() {
+		defer close(jobs)
+
+		index := 0
+
+		send := func(c *chunk) {
+			inflight <- struct{}{}
+			jobs <- c
+			index++
+		}
+
+		for _, file := range files {
+			iscan, ifile := openInputFile(file)
+
+			var (
+				header   []string
+				inHeader bool
+			)
+
+			c := &chunk{index: index}
+
+			for iscan.Scan() {
+				line := iscan.Text()
+				comment := len(line) > 0 && line[0] == '#'
+
+				if comment && format == "w3c" {
+					if !inHeader {
+						header, inHeader = nil, true
+					}
+					header = append(header, line)
+				} else if len(line) > 0 {
+					inHeader = false
+				}
+
+				if !comment && offset > 0 && iscan.Position().Offset <= offset {
+					continue
+				}
+
+				c.lines = append(c.lines, line)
+				c.pos = append(c.pos, iscan.Position())
+
+				if len(line) > 0 && !comment {
+					c.n++
+				}
+
+				if len(c.lines) >= chunksize {
+					send(c)
+					c = &chunk{index: index, header: header}
+				}
+			}
+
+			if len(c.lines) > 0 {
+				send(c)
+			}
+
+			ifile.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			scanner := newScanner()
+
+			for c := range jobs {
+				results <- chunkResult{chunk: c, result: work(c, scanner)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]chunkResult)
+	next := 0
+
+	for res := range results {
+		pending[res.chunk.index] = res
+
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			done(res.chunk, res.result)
+			<-inflight
+			next++
+		}
+	}
+}
+
+// chunkStats are the patterns of the messages of a chunk, with the number of
+// messages and the last example of each.
+type chunkStats struct {
+	pmap, amap map[string]pMapStruct
+}
+
+// addStat adds cnt messages of the pattern to the stats, of which ex is the last.
+func addStat(m map[string]pMapStruct, pat, ex string, cnt int) {
+	stat := m[pat]
+	stat.ex = ex
+	stat.cnt += cnt
+	m[pat] = stat
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+// extractCorpus writes one example message for each structurally distinct pattern found
+// in the input file, one message per line, so the output can be used directly as
+// a regression corpus or fuzzing seed file.
+func extractCorpus(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	corpus := sequence.NewCorpus(buildParser())
+	scanner := newScanner()
+
+	iscan, ifile := openInputFile(infile)
+
+	for iscan.Scan() {
+		line := iscan.Text()
+		if skipLine(scanner, line) {
+			continue
+		}
+
+		if err := corpus.Add(scanMessage(scanner, line)); err != nil {
+			log.Fatalf("Error (%s) adding %s: %s", err, iscan.Position(), line)
+		}
+	}
+
+	ifile.Close()
+
+	if err := corpus.Finalize(); err != nil {
+		log.Fatal(err)
+	}
+
+	iscan, ifile = openInputFile(infile)
+	defer ifile.Close()
+
+	n := 0
+	capper := newErrorCapper(maxerrors)
+
+	for iscan.Scan() {
+		line := iscan.Text()
+		if skipLine(scanner, line) {
+			continue
+		}
+		n++
+
+		if err := corpus.Collect(line, scanMessage(scanner, line)); err != nil && capper.Allow(err.Error()) {
+			errorf("Error (%s) collecting %s: %s", err, iscan.Position(), line)
+		}
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	capper.Summarize()
+
+	entries := corpus.Entries()
+
+	for _, e := range entries {
+		fmt.Fprintf(ofile, "%s\n", e.Example)
+	}
+
+	infof("Extracted %d examples from %d messages.", len(entries), n)
+	logSummary()
+}
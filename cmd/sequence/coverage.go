@@ -0,0 +1,89 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+// coverage parses the input file and reports, for each pattern, the number of
+// log messages it matched along with where the pattern came from, so unused or
+// unowned patterns in a shared pattern repository are easy to spot.
+func coverage(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	pats := loadPatterns()
+	parser := sequence.NewParser()
+
+	for _, pat := range pats {
+		if err := parser.AddPattern(pat); err != nil {
+			log.Fatalf("Error adding pattern %s: %v", pat, err)
+		}
+	}
+
+	scanner := newScanner()
+
+	iscan, ifile := openInputFile(infile)
+	defer ifile.Close()
+
+	counts := make(map[string]int, len(pats))
+	n, unmatched := 0, 0
+
+	for iscan.Scan() {
+		line := iscan.Text()
+		if skipLine(scanner, line) {
+			continue
+		}
+		n++
+
+		_, pat, err := parser.Match(scanMessage(scanner, line))
+		if err != nil {
+			unmatched++
+		} else if pat != nil {
+			counts[pat.String()]++
+		}
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	for _, pat := range pats {
+		owner, created := pat.Owner, "unknown"
+
+		if owner == "" {
+			owner = "unowned"
+		}
+
+		if !pat.Created.IsZero() {
+			created = pat.Created.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(ofile, "# %d log messages matched\n# %s, origin=%s, owner=%s, created=%s\n%s\n\n", counts[pat.String()], pat, pat.Origin, owner, created, pat.Text)
+	}
+
+	infof("Parsed %d messages, %d matched, %d unmatched, using %d patterns.", n, n-unmatched, unmatched, len(pats))
+	setMetric("sequence_run_messages", "Number of messages processed by the run.", float64(n))
+	setMetric("sequence_run_unmatched_messages", "Number of messages that didn't match any pattern.", float64(unmatched))
+	logSummary()
+}
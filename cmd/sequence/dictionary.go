@@ -0,0 +1,54 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	dictfields string
+	dictmax    int
+)
+
+// newValueDictionary returns the dictionary that learns the values of the fields
+// of the new patterns found by analyze, or nil if there are no fields to learn.
+func newValueDictionary() *sequence.ValueDictionary {
+	if dictfields == "" {
+		return nil
+	}
+
+	if dictmax <= 0 {
+		log.Fatalf("Invalid maximum number of values %d: expecting a positive value", dictmax)
+	}
+
+	return sequence.NewValueDictionary(dictmax, strings.Split(dictfields, ",")...)
+}
+
+// enumerationComments returns the comments of the pattern that record the values
+// of its fields that are enumerations, e.g., "action ∈ {ACCEPT (120), DENY (30)}",
+// so they can be promoted into the pattern by hand.
+func enumerationComments(dict *sequence.ValueDictionary, pattern string) []string {
+	var comments []string
+
+	for _, enum := range dict.Enumerations(pattern) {
+		comments = append(comments, enum.String())
+	}
+
+	return comments
+}
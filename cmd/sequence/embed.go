@@ -0,0 +1,32 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noembed
+// +build !noembed
+
+package main
+
+import (
+	_ "embed"
+)
+
+// defaultConfig is the config used if no config file is found, so the program
+// runs as a single binary, e.g., in a scratch container.
+//
+//go:embed sequence.toml
+var defaultConfig []byte
+
+func init() {
+	components = append(components, "embedded-config")
+}
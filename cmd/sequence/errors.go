@@ -0,0 +1,97 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	maxerrors     int
+	unmatchedfile string
+)
+
+// errorCapper caps the number of errors logged for each failure reason, so a run
+// where thousands of messages fail for the same reason doesn't flood the log. The
+// errors that are not logged are counted, and summarized at the end of the run.
+type errorCapper struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int
+	keys   []string // keys are the failure reasons, in the order first seen
+}
+
+func newErrorCapper(max int) *errorCapper {
+	return &errorCapper{
+		max:    max,
+		counts: make(map[string]int),
+	}
+}
+
+// Allow counts an error for the failure reason, and returns true if it should be
+// logged, i.e., fewer than the maximum errors for the reason have been logged. A
+// maximum of 0 or less means all errors are logged.
+func (this *errorCapper) Allow(key string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, ok := this.counts[key]; !ok {
+		this.keys = append(this.keys, key)
+	}
+	this.counts[key]++
+
+	return this.max <= 0 || this.counts[key] <= this.max
+}
+
+// Summarize logs the number of errors that were not logged for each failure reason.
+func (this *errorCapper) Summarize() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, key := range this.keys {
+		if n := this.counts[key] - this.max; this.max > 0 && n > 0 {
+			infof("Suppressed %s similar errors: %s", formatCount(n), key)
+		}
+	}
+}
+
+// formatCount returns n with thousands separators, e.g., 12,345.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+
+	return s
+}
+
+// writeUnmatched writes the message that didn't match to the unmatched file, with
+// its position, the error and the details as comments, so the file can be read
+// back as input, e.g., to analyze the unmatched messages.
+func writeUnmatched(w io.Writer, pos sequence.Position, err error, details []string, msg string) {
+	fmt.Fprintf(w, "# %s: %s\n", pos, err)
+
+	for _, d := range details {
+		fmt.Fprintf(w, "# %s\n", d)
+	}
+
+	fmt.Fprintf(w, "%s\n", msg)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	maxmemory  string
+	maxruntime time.Duration
+)
+
+// startLimits starts watching the memory used and the time spent by the run, and
+// aborts the run with a summary and a non-zero exit status once either exceeds
+// its maximum, so a runaway job doesn't take over a shared host.
+func startLimits() {
+	if maxmemory == "" && maxruntime == 0 {
+		return
+	}
+
+	var maxmem uint64
+
+	if maxmemory != "" {
+		var err error
+		if maxmem, err = parseSize(maxmemory); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if maxruntime < 0 {
+		log.Fatalf("Invalid maximum runtime %s: expecting a positive duration", maxruntime)
+	}
+
+	start := time.Now()
+
+	go func() {
+		var ms runtime.MemStats
+
+		for range time.Tick(100 * time.Millisecond) {
+			if maxruntime > 0 && time.Since(start) > maxruntime {
+				abort(start, fmt.Sprintf("maximum runtime of %s exceeded", maxruntime))
+			}
+
+			if maxmem > 0 {
+				runtime.ReadMemStats(&ms)
+
+				if ms.Sys > maxmem {
+					abort(start, fmt.Sprintf("%.2f MB of memory in use, maximum is %s", float64(ms.Sys)/float64(mbyte), maxmemory))
+				}
+			}
+		}
+	}()
+}
+
+func abort(start time.Time, reason string) {
+	warnf("Aborting after %.2f secs, %s.", float64(time.Since(start))/float64(time.Second), reason)
+	setMetric("sequence_run_success", "Whether the run completed, 1 if it did, 0 if it was aborted.", 0)
+	logSummary()
+	flushOutputs()
+
+	pprof.StopCPUProfile()
+	os.Exit(1)
+}
+
+// parseSize parses a size of the format "N", "NKB", "NMB" or "NGB" and returns
+// the number of bytes.
+func parseSize(s string) (uint64, error) {
+	n, unit := strings.ToUpper(strings.TrimSpace(s)), uint64(1)
+
+	for _, u := range []struct {
+		suffix string
+		size   uint64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(n, u.suffix) {
+			n, unit = strings.TrimSpace(n[:len(n)-len(u.suffix)]), u.size
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(n, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("Invalid size %q: expecting a positive size, e.g., 64KB or 4GB", s)
+	}
+
+	return uint64(size * float64(unit)), nil
+}
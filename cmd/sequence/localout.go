@@ -0,0 +1,413 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	noreader      string
+	readertimeout time.Duration
+	spoolfile     string
+	spoolmax      string
+)
+
+// The policies for the records written to a local output while it has no reader.
+const (
+	readerBlock = "block" // Wait for a reader up to the reader timeout, then drop
+	readerDrop  = "drop"  // Drop the records
+	readerSpool = "spool" // Append the records to the spool, and write them once there's a reader
+)
+
+// localRetry is the minimum time between the attempts to reach the reader of a
+// local output.
+const localRetry = 100 * time.Millisecond
+
+// localConn is the connection to the reader of a local output, a named pipe or a
+// Unix socket.
+type localConn interface {
+	io.WriteCloser
+	SetWriteDeadline(t time.Time) error
+}
+
+// isLocalOutput returns true if the output file is a Unix socket, e.g.,
+// "unix:/run/consumer.sock", or an existing named pipe.
+func isLocalOutput(fname string) bool {
+	switch prefix, _ := splitSocketName(fname); prefix {
+	case socketUnix, socketUnixgram:
+		return true
+
+	case "":
+		fi, err := os.Stat(fname)
+		return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+	}
+
+	return false
+}
+
+// localWriter writes the records to a named pipe or a Unix socket of a local
+// consumer, which may not be there. Opening a named pipe for writing blocks until
+// it has a reader, and connecting to a socket fails if it's not listened on, so
+// the pipe is opened without blocking, and what happens to the records while the
+// reader is absent is up to the policy. The reader is tried again on the next
+// write, at most every localRetry, and the records that are spooled are written
+// to it first. Each call to Write is one record.
+type localWriter struct {
+	name    string
+	open    func() (localConn, error)
+	conn    localConn
+	policy  string
+	timeout time.Duration
+
+	// tried is when the reader was last tried, gaveUp is whether the block policy
+	// gave up waiting for it, and warned is whether its absence was logged
+	tried  time.Time
+	gaveUp bool
+	warned bool
+
+	// dropped is the number of records dropped since the reader was last there
+	dropped int
+
+	// partial is the rest of the record the reader stopped reading in the middle
+	// of, which is written before the next record, so the record is neither cut
+	// short nor written again in full
+	partial []byte
+
+	// spool holds the records while there's no reader, octet counted as in RFC
+	// 6587, so they're written one at a time, and spooled is its size
+	spool    *os.File
+	spooled  int64
+	spoolMax int64
+	full     bool
+}
+
+// openLocalOutput returns the writer of the local output, using the reader policy,
+// reader timeout and spool flags.
+func openLocalOutput(fname string) *localWriter {
+	this := &localWriter{name: fname, policy: noreader, timeout: readertimeout}
+
+	switch prefix, path := splitSocketName(fname); prefix {
+	case "":
+		this.open = func() (localConn, error) { return openFifo(fname) }
+
+	case socketUnix, socketUnixgram:
+		network := prefix[:len(prefix)-1]
+		this.open = func() (localConn, error) {
+			conn, err := net.Dial(network, path)
+			if err != nil {
+				return nil, err
+			}
+			return conn.(localConn), nil
+		}
+
+		fname = path
+
+	default:
+		log.Fatalf("Invalid output %q: only Unix sockets and named pipes are supported", this.name)
+	}
+
+	if readertimeout < 0 {
+		log.Fatalf("Invalid reader timeout %s: expecting a positive duration", readertimeout)
+	}
+
+	switch noreader {
+	case readerBlock, readerDrop:
+
+	case readerSpool:
+		size, err := parseSize(spoolmax)
+		if err != nil {
+			log.Fatal(err)
+		}
+		this.spoolMax = int64(size)
+
+		name := spoolfile
+		if name == "" {
+			name = fname + ".spool"
+		}
+
+		// Records left in the spool by an earlier run are written first
+		if this.spool, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600); err != nil {
+			log.Fatal(err)
+		}
+
+		fi, err := this.spool.Stat()
+		if err != nil {
+			log.Fatal(err)
+		}
+		this.spooled = fi.Size()
+
+	default:
+		log.Fatalf("Invalid reader policy %q", noreader)
+	}
+
+	return this
+}
+
+// openFifo opens the named pipe for writing without blocking, which fails if it
+// has no reader.
+func openFifo(fname string) (localConn, error) {
+	return os.OpenFile(fname, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+}
+
+func (this *localWriter) Write(p []byte) (int, error) {
+	// The reader timeout is for the record, however many times the reader is
+	// reached but fails to read it
+	deadline := this.deadline()
+
+	for this.conn != nil || this.connect(deadline) {
+		if this.write(p) == nil {
+			return len(p), nil
+		}
+	}
+
+	if this.spool != nil {
+		return len(p), this.spoolRecord(p)
+	}
+
+	this.dropped++
+
+	return len(p), nil
+}
+
+func (this *localWriter) Close() error {
+	// Give the rest of the record written last one more chance
+	if this.conn != nil && len(this.partial) > 0 {
+		this.write(nil)
+	}
+
+	// Give the records still spooled one more chance
+	if this.conn == nil && this.spooled > 0 {
+		this.tried = time.Time{}
+		this.connect(this.deadline())
+	}
+
+	this.logDropped()
+
+	if this.spool != nil {
+		if this.spooled > 0 {
+			infof("Left %d bytes of records in the spool %s, to be written once output %s has a reader.", this.spooled, this.spool.Name(), this.name)
+		}
+		this.spool.Close()
+	}
+
+	if this.conn != nil {
+		return this.conn.Close()
+	}
+
+	return nil
+}
+
+// deadline returns when the block policy stops waiting for the reader to read a
+// record written now, or the zero time if it waits for as long as it takes.
+func (this *localWriter) deadline() time.Time {
+	if this.policy != readerBlock || this.timeout == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(this.timeout)
+}
+
+// connect connects to the reader, and writes the records spooled to it. It returns
+// true if there's a reader. With the block policy, it waits for one up to the
+// deadline, and then gives up until the reader is back.
+func (this *localWriter) connect(deadline time.Time) bool {
+	wait := this.policy == readerBlock && !this.gaveUp
+
+	for {
+		if since := time.Since(this.tried); since < localRetry {
+			if !wait {
+				return false
+			}
+			time.Sleep(localRetry - since)
+		}
+
+		if wait && !deadline.IsZero() && time.Now().After(deadline) {
+			warnf("No reader on output %s after %s, dropping records until it has one.", this.name, this.timeout)
+			this.gaveUp = true
+			return false
+		}
+
+		this.tried = time.Now()
+
+		conn, err := this.open()
+		if err == nil {
+			this.conn, this.gaveUp, this.warned = conn, false, false
+			this.logDropped()
+
+			if this.replay() {
+				return true
+			}
+		} else if !this.warned {
+			this.warned = true
+			warnf("No reader on output %s, applying reader policy %q: %v", this.name, this.policy, err)
+		}
+
+		if !wait {
+			return false
+		}
+	}
+}
+
+// write writes the record to the reader, after the rest of the record the reader
+// stopped reading in the middle of, if any. The reader is taken to be gone if the
+// write fails, or if the reader doesn't read any of the record within the reader
+// timeout. If it stops in the middle of the record, the record is taken to be
+// written, and the rest of it is kept to be written first the next time, since
+// writing it again in full, e.g., to the reader of the same named pipe, would
+// have the reader get it cut short and then again.
+func (this *localWriter) write(p []byte) error {
+	if len(this.partial) > 0 {
+		if _, err := this.send(this.partial); err != nil {
+			warnf("Reader of output %s stopped in the middle of a record, which is cut short.", this.name)
+			this.disconnect(err)
+			return err
+		}
+
+		this.partial = nil
+	}
+
+	n, err := this.send(p)
+	if err != nil && n > 0 && os.IsTimeout(err) {
+		this.partial = append([]byte(nil), p[n:]...)
+		return nil
+	}
+
+	if err != nil {
+		this.disconnect(err)
+	}
+
+	return err
+}
+
+// send writes p to the reader for as long as the reader keeps reading some of it
+// within the reader timeout, and returns the number of bytes written.
+func (this *localWriter) send(p []byte) (int, error) {
+	written := 0
+
+	for {
+		if this.timeout > 0 {
+			this.conn.SetWriteDeadline(time.Now().Add(this.timeout))
+		}
+
+		n, err := this.conn.Write(p[written:])
+		written += n
+
+		if err == nil || n == 0 || !os.IsTimeout(err) {
+			return written, err
+		}
+	}
+}
+
+// disconnect closes the connection to the reader, which is taken to be gone.
+func (this *localWriter) disconnect(err error) {
+	warnf("Error writing to output %s, taking its reader to be gone: %v", this.name, err)
+
+	this.conn.Close()
+	this.conn = nil
+	this.partial = nil
+	this.tried = time.Now()
+}
+
+// spoolRecord appends the record to the spool, unless it's full, in which case
+// the record is dropped.
+func (this *localWriter) spoolRecord(p []byte) error {
+	frame := fmt.Sprintf("%d %s", len(p), p)
+
+	if this.spooled+int64(len(frame)) > this.spoolMax {
+		if !this.full {
+			this.full = true
+			warnf("Spool %s of output %s is full, dropping records until it has a reader.", this.spool.Name(), this.name)
+		}
+
+		this.dropped++
+		return nil
+	}
+
+	n, err := io.WriteString(this.spool, frame)
+	this.spooled += int64(n)
+
+	return err
+}
+
+// replay writes the records spooled to the reader, and returns true if all of
+// them were written. The records that were not are kept in the spool.
+func (this *localWriter) replay() bool {
+	if this.spooled == 0 {
+		return true
+	}
+
+	data := make([]byte, this.spooled)
+	if _, err := this.spool.ReadAt(data, 0); err != nil {
+		errorf("Error reading spool %s, discarding it: %v", this.spool.Name(), err)
+		this.truncateSpool(nil)
+		return true
+	}
+
+	split := sequence.SplitRecords(sequence.SeparatorOctet)
+
+	for off := 0; off < len(data); {
+		n, rec, err := split(data[off:], true)
+		if err != nil || n == 0 {
+			errorf("Error reading spool %s, discarding the rest of it: %v", this.spool.Name(), err)
+			break
+		}
+
+		if rec != nil && this.write(rec) != nil {
+			this.truncateSpool(data[off:])
+			return false
+		}
+
+		off += n
+	}
+
+	debugf("Wrote %d bytes of spooled records to output %s.", len(data), this.name)
+
+	this.truncateSpool(nil)
+	return true
+}
+
+// truncateSpool replaces the records in the spool with rest.
+func (this *localWriter) truncateSpool(rest []byte) {
+	this.spooled, this.full = 0, false
+
+	if err := this.spool.Truncate(0); err != nil {
+		errorf("Error truncating spool %s: %v", this.spool.Name(), err)
+		return
+	}
+
+	n, err := this.spool.Write(rest)
+	if err != nil {
+		errorf("Error writing spool %s: %v", this.spool.Name(), err)
+	}
+
+	this.spooled = int64(n)
+}
+
+// logDropped logs the number of records dropped since the reader was last there.
+func (this *localWriter) logDropped() {
+	if this.dropped > 0 {
+		warnf("Dropped %d records written to output %s while it had no reader.", this.dropped, this.name)
+		this.dropped = 0
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLocalOutput(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "out.fifo")
+	require.NoError(t, syscall.Mkfifo(fifo, 0600))
+
+	require.True(t, isLocalOutput(fifo))
+	require.True(t, isLocalOutput("unix:/run/consumer.sock"))
+	require.True(t, isLocalOutput("unixgram:/run/consumer.dgram"))
+	require.False(t, isLocalOutput("zmq-sub:tcp://127.0.0.1:5556"))
+	require.False(t, isLocalOutput("zmq-pull:ipc:///run/logs.ipc"))
+	require.False(t, isLocalOutput(filepath.Join(t.TempDir(), "out.log")))
+}
+
+func TestLocalWriterSlowReader(t *testing.T) {
+	defer func(policy string, timeout time.Duration) {
+		noreader, readertimeout = policy, timeout
+	}(noreader, readertimeout)
+
+	noreader, readertimeout = readerDrop, 50*time.Millisecond
+
+	fifo := filepath.Join(t.TempDir(), "out.fifo")
+	require.NoError(t, syscall.Mkfifo(fifo, 0600))
+
+	r, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	w := openLocalOutput(fifo)
+
+	// The record doesn't fit in the pipe, and isn't read until after the reader
+	// timeout, so the reader stops in the middle of it
+	big := append(bytes.Repeat([]byte("x"), 1<<20), '\n')
+
+	_, err = w.Write(big)
+	require.NoError(t, err)
+	require.NotNil(t, w.conn)
+	require.True(t, len(w.partial) > 0 && len(w.partial) < len(big))
+
+	read := make(chan []byte)
+
+	go func() {
+		var (
+			buf   bytes.Buffer
+			chunk = make([]byte, 16*1024)
+		)
+
+		for {
+			n, err := r.Read(chunk)
+			buf.Write(chunk[:n])
+			if err == io.EOF {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		read <- buf.Bytes()
+	}()
+
+	_, err = w.Write([]byte("next\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// The slow reader gets the record once, in full, followed by the next one
+	got := <-read
+	require.Equal(t, len(big)+5, len(got))
+	require.True(t, bytes.Equal(append(big, "next\n"...), got))
+}
+
+// brokenConn is a reader that's reached, but fails every write.
+type brokenConn struct{}
+
+func (brokenConn) Write(p []byte) (int, error)        { return 0, errors.New("broken pipe") }
+func (brokenConn) Close() error                       { return nil }
+func (brokenConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestLocalWriterBlockTimeout(t *testing.T) {
+	w := &localWriter{
+		name:    "broken",
+		open:    func() (localConn, error) { return brokenConn{}, nil },
+		policy:  readerBlock,
+		timeout: 300 * time.Millisecond,
+	}
+
+	written := make(chan time.Duration)
+
+	go func() {
+		start := time.Now()
+		w.Write([]byte("record\n"))
+		written <- time.Since(start)
+	}()
+
+	// The reader is reached again and again, but the record is dropped once the
+	// reader timeout is up
+	select {
+	case since := <-written:
+		require.True(t, since >= w.timeout)
+		require.True(t, w.gaveUp)
+		require.Equal(t, 1, w.dropped)
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write didn't give up on the reader after the reader timeout")
+	}
+}
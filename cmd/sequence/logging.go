@@ -0,0 +1,122 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	levelFatal = "fatal" // The run can't continue, always logged
+	levelWarn  = "warn"  // Something went wrong that needs attention, always logged
+	levelError = "error" // A single message couldn't be processed, not logged with --quiet
+	levelInfo  = "info"  // The summary of the run, not logged with --quiet
+	levelDebug = "debug" // The details of the run, only logged with --verbose
+)
+
+var (
+	quiet     bool
+	verbose   bool
+	logformat string
+
+	logjson *jsonLogWriter
+)
+
+// setupLogging checks the logging flags, and sets up the json log format if it's
+// requested. Messages logged directly using the log package, e.g., log.Fatal, are
+// logged at the fatal level.
+func setupLogging() {
+	if quiet && verbose {
+		log.Fatal("Invalid logging flags: --quiet and --verbose can't be used together")
+	}
+
+	switch logformat {
+	case "text":
+	case "json":
+		logjson = &jsonLogWriter{w: os.Stderr}
+		log.SetFlags(0)
+		log.SetOutput(logjson)
+	default:
+		log.Fatalf("Invalid log format %q", logformat)
+	}
+}
+
+func warnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(levelError, format, args...) }
+func infof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func debugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+
+// logf logs the message at the level, unless the level is turned off by --quiet
+// or --verbose.
+func logf(level, format string, args ...interface{}) {
+	switch level {
+	case levelError, levelInfo:
+		if quiet {
+			return
+		}
+
+	case levelDebug:
+		if !verbose {
+			return
+		}
+	}
+
+	if logjson != nil {
+		logjson.writeLevel(level, fmt.Sprintf(format, args...))
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+// jsonLogWriter writes each log message as a single line json object with the
+// time, the level and the message, so the diagnostics can be read by other tools.
+type jsonLogWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write writes the messages of the log package at the fatal level.
+func (this *jsonLogWriter) Write(p []byte) (int, error) {
+	if err := this.writeLevel(levelFatal, string(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (this *jsonLogWriter) writeLevel(level, msg string) error {
+	buf, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().UTC().Format(time.RFC3339Nano), level, strings.TrimRight(msg, "\n")})
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	_, err = this.w.Write(append(buf, '\n'))
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	metricsfile  string
+	pushgateway  string
+	pushattempts int
+	pushbackoff  time.Duration
+
+	// runcmd and runstart are the command being run, e.g., "parse", and when it started
+	runcmd   string
+	runstart time.Time
+
+	metrics   = make(map[string]metric)
+	metricsMu sync.Mutex
+)
+
+// metric is a single gauge of the run, written in the Prometheus text format.
+type metric struct {
+	help  string
+	value float64
+}
+
+// startMetrics records the command being run and when it started.
+func startMetrics(cmd string) {
+	runcmd = strings.TrimPrefix(cmd, "sequence ")
+	runstart = time.Now()
+
+	setMetric("sequence_run_success", "Whether the run completed, 1 if it did, 0 if it was aborted.", 1)
+}
+
+// setMetric sets the value of the run metric, which is a gauge, so it's reported at
+// the end of the run. The name must follow the Prometheus metric naming rules.
+func setMetric(name, help string, value float64) {
+	metricsMu.Lock()
+	metrics[name] = metric{help: help, value: value}
+	metricsMu.Unlock()
+}
+
+// writeMetrics writes the run metrics to the textfile collector file, and pushes
+// them to the Pushgateway, if either is specified, so scheduled batch runs show up
+// in the existing monitoring. Errors are logged, but don't fail the run.
+func writeMetrics(records, binaries int) {
+	if metricsfile == "" && pushgateway == "" {
+		return
+	}
+
+	finish := time.Now()
+
+	setMetric("sequence_run_duration_seconds", "Time taken by the run in seconds.", finish.Sub(runstart).Seconds())
+	setMetric("sequence_run_finish_time_seconds", "Unix time the run finished at.", float64(finish.UnixNano())/float64(time.Second))
+	setMetric("sequence_run_records", "Number of input records read by the run.", float64(records))
+	setMetric("sequence_run_binary_records", "Number of input records with NUL or invalid UTF-8 bytes.", float64(binaries))
+
+	publishMetrics()
+}
+
+// publishMetrics writes the current metrics to the textfile collector file, and
+// pushes them to the Pushgateway, if either is specified.
+func publishMetrics() {
+	if metricsfile == "" && pushgateway == "" {
+		return
+	}
+
+	data := formatMetrics()
+
+	if metricsfile != "" {
+		if err := writeMetricsFile(metricsfile, data); err != nil {
+			warnf("Error writing metrics to %s: %v", metricsfile, err)
+		}
+	}
+
+	if pushgateway != "" {
+		err := retry(pushattempts, pushbackoff, "pushing metrics to "+pushgateway, func() error {
+			return pushMetrics(pushgateway, data)
+		})
+
+		if err != nil {
+			warnf("Error pushing metrics to %s, dropping them: %v", pushgateway, err)
+		}
+	}
+}
+
+// formatMetrics returns the run metrics in the Prometheus text format, sorted by
+// name, labeled with the command.
+func formatMetrics() []byte {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s{command=%q} %g\n", name, m.help, name, name, runcmd, m.value)
+	}
+
+	return buf.Bytes()
+}
+
+// writeMetricsFile writes the metrics to a temporary file first, and then renames
+// it, so the textfile collector never reads a partially written file.
+func writeMetricsFile(file string, data []byte) error {
+	tmpfile := file + ".tmp"
+
+	if err := ioutil.WriteFile(tmpfile, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpfile, file)
+}
+
+// pushMetrics replaces the metrics of the sequence job, grouped by command, on
+// the Pushgateway at url, e.g., http://localhost:9091. Connection errors and 5xx
+// and 429 responses are returned as a retryableError.
+func pushMetrics(url string, data []byte) error {
+	url = fmt.Sprintf("%s/metrics/job/sequence/command/%s", strings.TrimRight(url, "/"), strings.Replace(runcmd, " ", "_", -1))
+
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("Invalid response from Pushgateway: %s", resp.Status)
+
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			return retryableError{err}
+		}
+
+		return err
+	}
+
+	return nil
+}
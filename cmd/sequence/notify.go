@@ -0,0 +1,115 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemdNotifier tells systemd when a long running parse, e.g., of a named pipe
+// written to by a log shipper, is ready and when it's stopping, and pings the
+// watchdog, so sequence can run as a Type=notify service with WatchdogSec set.
+// See sd_notify(3).
+type systemdNotifier struct {
+	addr *net.UnixAddr
+	quit chan struct{}
+	done chan struct{}
+}
+
+// startNotify notifies systemd that the run is ready, and starts pinging the
+// watchdog if it's enabled, or returns nil if sequence is not run by systemd with
+// a notification socket.
+func startNotify() *systemdNotifier {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+
+	// abstract sockets start with a NUL byte, which systemd writes as @
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	this := &systemdNotifier{addr: &net.UnixAddr{Name: name, Net: "unixgram"}}
+
+	this.notify("READY=1")
+
+	if interval := watchdogInterval(); interval > 0 {
+		this.quit = make(chan struct{})
+		this.done = make(chan struct{})
+
+		go func() {
+			defer close(this.done)
+
+			// systemd recommends pinging at half the watchdog timeout
+			ticker := time.NewTicker(interval / 2)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					this.notify("WATCHDOG=1")
+
+				case <-this.quit:
+					return
+				}
+			}
+		}()
+	}
+
+	return this
+}
+
+// Stop stops pinging the watchdog, and notifies systemd that the run is stopping.
+func (this *systemdNotifier) Stop() {
+	if this.quit != nil {
+		close(this.quit)
+		<-this.done
+	}
+
+	this.notify("STOPPING=1")
+}
+
+// notify sends the state to systemd. Errors are logged, but don't fail the run.
+func (this *systemdNotifier) notify(state string) {
+	conn, err := net.DialUnix("unixgram", nil, this.addr)
+	if err != nil {
+		warnf("Error notifying systemd of %s: %v", state, err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		warnf("Error notifying systemd of %s: %v", state, err)
+	}
+}
+
+// watchdogInterval returns the watchdog timeout set by systemd for this process,
+// or 0 if the watchdog is not enabled.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
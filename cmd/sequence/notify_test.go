@@ -0,0 +1,70 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustpath/sequence"
+)
+
+func TestParseNotify(t *testing.T) {
+	dir := t.TempDir()
+
+	sock := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", sock)
+
+	in, pats, out := filepath.Join(dir, "in.log"), filepath.Join(dir, "patterns.txt"), filepath.Join(dir, "out.log")
+	require.NoError(t, ioutil.WriteFile(in, []byte("Jan 12 06:49:42 irc dnsmasq[7034]: query[A] example.com from 10.1.1.1\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(pats, []byte("%msgtime% %apphost% %appname% [ %sessionid% ] : query [ %qtype% ] %domain% from %srcip%\n"), 0600))
+
+	defer func(i, o, p, f, b, bp string, w int, fl time.Duration) {
+		infile, outfile, patfile, outformat, outbuffer, binpolicy, pworkers, outflush = i, o, p, f, b, bp, w, fl
+	}(infile, outfile, patfile, outformat, outbuffer, binpolicy, pworkers, outflush)
+
+	infile, outfile, patfile, outformat, outbuffer, binpolicy, pworkers, outflush = in, out, pats, outputText, "64KB", sequence.BinaryReplace, 1, time.Second
+
+	quit, done = make(chan struct{}), make(chan struct{})
+
+	// parse returns, rather than exits, once it's done, after its deferred calls
+	parse(nil, nil)
+
+	var states []string
+
+	buf := make([]byte, 64)
+	for len(states) < 2 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		states = append(states, string(buf[:n]))
+	}
+
+	require.Equal(t, []string{"READY=1", "STOPPING=1"}, states)
+
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(data), "example.com"))
+}
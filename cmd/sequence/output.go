@@ -0,0 +1,148 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/trustpath/sequence"
+)
+
+const (
+	outputText = "text" // Tokens are written using PrintTokens, for people to read
+	outputJson = "json" // Each message is written as a json object, for other tools to read
+)
+
+var (
+	outformat  string
+	printstyle string
+	colormode  string
+)
+
+// jsonMessage is a scanned or parsed message written in the json output format.
+type jsonMessage struct {
+	Position string      `json:"position,omitempty"`
+	Message  string      `json:"message"`
+	Pattern  string      `json:"pattern,omitempty"`
+	Tokens   []jsonToken `json:"tokens"`
+}
+
+// jsonToken is a single token of a jsonMessage. Offset is the byte offset of the
+// token in the message, or -1 if the value doesn't appear as is in the message.
+// Layout is the time format time tokens are parsed with, if any.
+type jsonToken struct {
+	Tag    string `json:"tag"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Offset int    `json:"offset"`
+	Layout string `json:"layout,omitempty"`
+}
+
+// checkOutputFormat exits if the output format flag is not one of the known formats.
+func checkOutputFormat() {
+	switch outformat {
+	case outputText, outputJson:
+	default:
+		log.Fatalf("Invalid output format %q", outformat)
+	}
+}
+
+// tokenStyle returns the style and the coloring of the tokens written in the text
+// output format. With the auto color mode, the tokens are only colored when they
+// are written to a terminal.
+func tokenStyle() (sequence.PrintStyle, bool) {
+	var style sequence.PrintStyle
+
+	switch printstyle {
+	case "full":
+		style = sequence.PrintFull
+	case "compact":
+		style = sequence.PrintCompact
+	case "table":
+		style = sequence.PrintTable
+	default:
+		log.Fatalf("Invalid print style %q", printstyle)
+	}
+
+	switch colormode {
+	case "always":
+		return style, true
+	case "never":
+		return style, false
+	case "auto":
+		fi, err := os.Stdout.Stat()
+		return style, outfile == "" && err == nil && fi.Mode()&os.ModeCharDevice != 0
+	default:
+		log.Fatalf("Invalid color mode %q", colormode)
+	}
+
+	return style, false
+}
+
+// formatJson returns the message and its tokens as a single line json object. The
+// position and the pattern are left out if they are empty.
+func formatJson(pos, msg, pattern string, seq sequence.Sequence) string {
+	offsets := seq.Offsets(msg)
+
+	m := jsonMessage{
+		Position: pos,
+		Message:  msg,
+		Pattern:  pattern,
+		Tokens:   make([]jsonToken, len(seq)),
+	}
+
+	for i, t := range seq {
+		m.Tokens[i] = jsonToken{Tag: source.FieldName(t.Tag), Type: t.Type.String(), Value: t.Value, Offset: offsets[i]}
+
+		if t.Type == sequence.TokenTime {
+			m.Tokens[i].Layout, _ = t.TimeLayout()
+		}
+	}
+
+	buf, err := json.Marshal(&m)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return string(buf)
+}
+
+// formatScan returns the scanned message in the output format.
+func formatScan(pos, msg string, seq sequence.Sequence) string {
+	if outformat == outputJson {
+		return formatJson(pos, msg, "", seq) + "\n"
+	}
+
+	style, color := tokenStyle()
+
+	return fmt.Sprintf("%s\n\n", seq.PrintTokensStyle(style, color))
+}
+
+// formatParse returns the parsed message in the output format.
+func formatParse(pos, msg string, pat *sequence.Pattern, seq sequence.Sequence) string {
+	if outformat == outputJson {
+		var pattern string
+		if pat != nil {
+			pattern = pat.String()
+		}
+
+		return formatJson(pos, msg, pattern, seq) + "\n"
+	}
+
+	return fmt.Sprintf("# %s\n%s\n%s\n\n", pos, msg, source.PrintTokens(seq))
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+var (
+	signkey     string
+	trustedkeys string
+	shadowfile  string
+)
+
+// unmatchedText is the pattern text reported for messages that match no pattern.
+const unmatchedText = "(unmatched)"
+
+// packPatterns writes the pattern files in the patterns directory, along with a
+// manifest of their checksums, to the output as a single bundle.
+func packPatterns(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if patfile == "" {
+		log.Fatal("Invalid patterns directory specified")
+	}
+
+	db, err := sequence.NewPatternDB(patfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(db.Files) == 0 {
+		log.Fatalf("Invalid patterns directory %s: no pattern files found", patfile)
+	}
+
+	if signkey != "" {
+		key, err := sequence.ReadSigningKey(signkey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := db.Sign(key); err != nil {
+			log.Fatalf("Error signing %s: %v", patfile, err)
+		}
+	}
+
+	ofile := openOutput(outfile)
+	defer ofile.Close()
+
+	if err := db.Pack(ofile); err != nil {
+		log.Fatalf("Error packing %s: %v", patfile, err)
+	}
+
+	infof("Packed %d files from %s, version %d.", len(db.Files), patfile, db.Version)
+	logSummary()
+}
+
+// unpackPatterns unpacks the bundle in the input file into the output directory,
+// replacing the pattern database in the directory, if any, once the bundle has
+// been verified.
+func unpackPatterns(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	if outfile == "" {
+		log.Fatal("Invalid output directory specified")
+	}
+
+	f, err := os.Open(infile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	db, err := sequence.UnpackPatternDB(f, outfile, readTrustedKeys()...)
+	if err != nil {
+		log.Fatalf("Error unpacking %s: %v", infile, err)
+	}
+
+	pats, err := db.Patterns()
+	if err != nil {
+		log.Fatalf("Error unpacking %s: %v", infile, err)
+	}
+
+	infof("Unpacked %d files with %d patterns into %s, version %d.", len(db.Files), len(pats), outfile, db.Version)
+	logSummary()
+}
+
+// keygenPatterns generates a new key pair for signing pattern databases, and
+// writes the private key to the output file and the public key to the same file
+// with a ".pub" extension.
+func keygenPatterns(cmd *cobra.Command, args []string) {
+	if outfile == "" {
+		log.Fatal("Invalid output file specified")
+	}
+
+	priv, pub, err := sequence.GenerateSigningKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(outfile, priv, 0600); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(outfile+".pub", pub, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	infof("Wrote signing key to %s, and the public key to %s.pub.", outfile, outfile)
+}
+
+// verifyPatternDB checks that the pattern database is signed by one of the keys
+// in the trusted keys file, if any.
+func verifyPatternDB(db *sequence.PatternDB) {
+	if trustedkeys == "" {
+		return
+	}
+
+	if err := db.VerifySignature(readTrustedKeys()...); err != nil {
+		log.Fatal(err)
+	}
+
+	debugf("Verified signature of pattern database %s.", db.Dir)
+}
+
+// readTrustedKeys reads the keys in the trusted keys file, if any.
+func readTrustedKeys() []ed25519.PublicKey {
+	if trustedkeys == "" {
+		return nil
+	}
+
+	keys, err := sequence.ReadTrustedKeys(trustedkeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return keys
+}
+
+// patternMove is the number of messages matched by one pattern with the first set
+// of patterns and by another with the second, along with an example message.
+type patternMove struct {
+	from, to string
+	count    int
+	example  string
+}
+
+// diffPatterns parses the input with the patterns in each of the two pattern
+// directories, and reports the share of messages matched by each, along with the
+// messages that are matched by a different pattern, or by none, with the second
+// directory, so a change to a pattern set can be evaluated before it's rolled out.
+// Patterns are compared by their text, since they may be in different files.
+func diffPatterns(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if len(args) != 2 {
+		log.Fatal("Invalid pattern directories specified, expecting two")
+	}
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	parsers := make([]*sequence.Parser, 2)
+
+	for i, dir := range args {
+		parsers[i] = sequence.NewParser()
+
+		for _, pat := range loadPatternsFrom(dir) {
+			if err := parsers[i].AddPattern(pat); err != nil {
+				log.Fatalf("Error adding pattern %s: %v", pat, err)
+			}
+		}
+	}
+
+	var (
+		n       int
+		matched [2]int
+		moves   = make(map[[2]string]*patternMove)
+	)
+
+	for _, file := range inputFiles(infile) {
+		scanner := newScanner()
+
+		iscan, ifile := openInputFile(file)
+
+		for iscan.Scan() {
+			line := iscan.Text()
+			if skipLine(scanner, line) {
+				continue
+			}
+			n++
+
+			var texts [2]string
+
+			for i, parser := range parsers {
+				_, pat, err := parser.Match(scanMessage(scanner, line))
+				if err == nil {
+					matched[i]++
+				}
+
+				texts[i] = matchedText(pat, err)
+			}
+
+			if texts[0] == texts[1] {
+				continue
+			}
+
+			m, ok := moves[texts]
+			if !ok {
+				m = &patternMove{from: texts[0], to: texts[1], example: line}
+				moves[texts] = m
+			}
+			m.count++
+		}
+
+		ifile.Close()
+	}
+
+	list := make([]*patternMove, 0, len(moves))
+	for _, m := range moves {
+		list = append(list, m)
+	}
+
+	sort.Sort(patternMoves(list))
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	for i, dir := range args {
+		fmt.Fprintf(ofile, "# %s matched %d of %d messages (%.2f%%)\n", dir, matched[i], n, percent(matched[i], n))
+	}
+	fmt.Fprintf(ofile, "# %d messages matched a different pattern\n\n", sumMoves(list))
+
+	for _, m := range list {
+		fmt.Fprintf(ofile, "# %d messages, e.g., %s\n- %s\n+ %s\n\n", m.count, m.example, m.from, m.to)
+	}
+
+	infof("Parsed %d messages, %d matched with %s, %d matched with %s, %d matched a different pattern.", n, matched[0], args[0], matched[1], args[1], sumMoves(list))
+	setMetric("sequence_run_messages", "Number of messages processed by the run.", float64(n))
+	logSummary()
+}
+
+// patternMoves sorts the moves by the number of messages, most first, and then by
+// the patterns.
+type patternMoves []*patternMove
+
+func (this patternMoves) Len() int      { return len(this) }
+func (this patternMoves) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this patternMoves) Less(i, j int) bool {
+	if this[i].count != this[j].count {
+		return this[i].count > this[j].count
+	}
+	return this[i].from+"\x00"+this[i].to < this[j].from+"\x00"+this[j].to
+}
+
+func sumMoves(moves []*patternMove) int {
+	var n int
+	for _, m := range moves {
+		n += m.count
+	}
+	return n
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// matchedText returns the text of the pattern a message matched, or unmatchedText
+// if it didn't match any.
+func matchedText(pat *sequence.Pattern, err error) string {
+	if err != nil || pat == nil {
+		return unmatchedText
+	}
+	return pat.Text
+}
+
+// buildShadowParser returns the parser of the shadow patterns, or nil if there are
+// none, so candidate patterns can be evaluated against the messages being parsed.
+func buildShadowParser() *sequence.Parser {
+	if shadowfile == "" {
+		return nil
+	}
+
+	parser := sequence.NewParser()
+
+	for _, pat := range loadPatternsFrom(shadowfile) {
+		if err := parser.AddPattern(pat); err != nil {
+			log.Fatalf("Error adding shadow pattern %s: %v", pat, err)
+		}
+	}
+
+	return parser
+}
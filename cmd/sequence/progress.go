@@ -0,0 +1,70 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/trustpath/sequence"
+)
+
+var progressinterval time.Duration
+
+// progressReader returns r, which reads the input file fname, wrapped so the share
+// of the file read so far is logged every progress interval, or r as is if no
+// interval is specified. For compressed files, r must read the compressed bytes,
+// so the progress is relative to the size of the file.
+func progressReader(r io.Reader, fname string) io.Reader {
+	if progressinterval <= 0 {
+		return r
+	}
+
+	fi, err := os.Stat(fname)
+	if err != nil || fi.Size() == 0 {
+		return r
+	}
+
+	size := fi.Size()
+	last := time.Now()
+
+	return sequence.NewProgressReader(r, func(n int64) {
+		if now := time.Now(); now.Sub(last) >= progressinterval || n == size {
+			last = now
+			infof("Read %.1f%% of %s, %.2f of %.2f MB.", float64(n)*100/float64(size), fname, float64(n)/mbyte, float64(size)/mbyte)
+		}
+	})
+}
+
+// inputErrReader logs the first error reading the input file, other than io.EOF,
+// e.g., a corrupt gzip member, since the record scanners stop at the error the
+// same as at the end of the file.
+type inputErrReader struct {
+	r      io.Reader
+	fname  string
+	logged bool
+}
+
+func (this *inputErrReader) Read(p []byte) (int, error) {
+	n, err := this.r.Read(p)
+
+	if err != nil && err != io.EOF && !this.logged {
+		this.logged = true
+		errorf("Error reading input file %s, stopping at the error: %v", this.fname, err)
+	}
+
+	return n, err
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimiter is a token bucket. Tokens are refilled at rate per second, up to
+// burst tokens. It's not safe to use concurrently.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// newOutputLimiter returns the rate limiter of the rate limit and burst flags, or
+// nil if there's no rate limit.
+func newOutputLimiter() *rateLimiter {
+	if ratelimit == "" {
+		return nil
+	}
+
+	rate, err := parseRate(ratelimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return newRateLimiter(rate, rateburst)
+}
+
+// Wait consumes a token, blocking until the next token becomes available if the
+// bucket is empty.
+func (this *rateLimiter) Wait() {
+	now := time.Now()
+	this.tokens += now.Sub(this.last).Seconds() * this.rate
+	this.last = now
+
+	if this.tokens > this.burst {
+		this.tokens = this.burst
+	}
+
+	if this.tokens < 1 {
+		wait := time.Duration((1 - this.tokens) / this.rate * float64(time.Second))
+		time.Sleep(wait)
+		this.tokens = 1
+		this.last = time.Now()
+	}
+
+	this.tokens--
+}
+
+// rateLimitedWriter is a rate limiter in front of an output. Each call to Write is
+// one record, so writing a record consumes one token. The limiter can be shared by
+// several outputs, e.g., the files of a split output, so the rate is for all of
+// them.
+type rateLimitedWriter struct {
+	w     io.WriteCloser
+	limit *rateLimiter
+}
+
+func (this *rateLimitedWriter) Write(p []byte) (int, error) {
+	this.limit.Wait()
+
+	return this.w.Write(p)
+}
+
+func (this *rateLimitedWriter) Close() error {
+	return this.w.Close()
+}
+
+// parseRate parses a rate limit of the format "N/s", "N/m" or "N/h" and returns
+// the number of records per second. A bare "N" is treated as "N/s".
+func parseRate(s string) (float64, error) {
+	n, unit := s, "s"
+
+	if i := strings.Index(s, "/"); i != -1 {
+		n, unit = s[:i], s[i+1:]
+	}
+
+	r, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if err != nil || r <= 0 {
+		return 0, fmt.Errorf("Invalid rate limit %q: expecting a positive number", s)
+	}
+
+	switch strings.TrimSpace(unit) {
+	case "s", "sec":
+		return r, nil
+	case "m", "min":
+		return r / 60, nil
+	case "h", "hour":
+		return r / 3600, nil
+	}
+
+	return 0, fmt.Errorf("Invalid rate limit %q: unknown unit %q", s, unit)
+}
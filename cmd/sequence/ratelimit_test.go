@@ -0,0 +1,105 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		rate float64
+		ok   bool
+	}{
+		{"10", 10, true},
+		{"10/s", 10, true},
+		{"10/sec", 10, true},
+		{" 10 / s ", 10, true},
+		{"0.5/s", 0.5, true},
+		{"120/m", 2, true},
+		{"120/min", 2, true},
+		{"7200/h", 2, true},
+		{"7200/hour", 2, true},
+		{"", 0, false},
+		{"/s", 0, false},
+		{"abc/s", 0, false},
+		{"10/d", 0, false},
+		{"10/", 0, false},
+		{"0", 0, false},
+		{"0/s", 0, false},
+		{"-5/s", 0, false},
+	} {
+		rate, err := parseRate(tc.s)
+		if !tc.ok {
+			require.Error(t, err, tc.s)
+			continue
+		}
+
+		require.NoError(t, err, tc.s)
+		require.Equal(t, tc.rate, rate, tc.s)
+	}
+}
+
+// nopWriteCloser counts the records written.
+type nopWriteCloser struct {
+	n int
+}
+
+func (this *nopWriteCloser) Write(p []byte) (int, error) { this.n++; return len(p), nil }
+func (this *nopWriteCloser) Close() error                { return nil }
+
+func TestRateLimitedWriter(t *testing.T) {
+	w := &nopWriteCloser{}
+	rw := &rateLimitedWriter{w: w, limit: newRateLimiter(20, 5)}
+
+	// The burst is written right away
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		rw.Write([]byte("record\n"))
+	}
+	require.True(t, time.Since(start) < 40*time.Millisecond)
+
+	// The rest is written at the rate, 50ms apart
+	start = time.Now()
+	for i := 0; i < 4; i++ {
+		rw.Write([]byte("record\n"))
+	}
+	since := time.Since(start)
+	require.True(t, since >= 190*time.Millisecond, since.String())
+	require.True(t, since < 400*time.Millisecond, since.String())
+
+	// The bucket refills while it's not written to, but only up to the burst
+	time.Sleep(500 * time.Millisecond)
+
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		rw.Write([]byte("record\n"))
+	}
+	require.True(t, time.Since(start) < 40*time.Millisecond)
+
+	start = time.Now()
+	rw.Write([]byte("record\n"))
+	since = time.Since(start)
+	require.True(t, since >= 40*time.Millisecond, since.String())
+
+	require.Equal(t, 15, w.n)
+
+	// A burst of less than 1 is a burst of 1
+	require.Equal(t, float64(1), newRateLimiter(20, 0).burst)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+var (
+	speed     float64
+	inferyear string
+)
+
+// replay re-emits the messages of a log file to the output, pacing them by the
+// difference between the timestamps found in consecutive messages. The pace can
+// be changed with the speed multiplier, e.g., --speed 10 replays 10x faster.
+// Messages without a timestamp are written immediately.
+func replay(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	if speed <= 0 {
+		log.Fatal("Invalid speed specified, must be greater than 0")
+	}
+
+	scanner := newScanner()
+	years := newYearInferrer(infile)
+
+	iscan, ifile := openInputFile(infile)
+	defer ifile.Close()
+
+	// each message is written as it's replayed, rather than when the output buffer
+	// is flushed, so the output keeps the original timing
+	outbatch = 1
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	var (
+		prev   time.Time
+		n      int
+		paused time.Duration
+	)
+
+	now := time.Now()
+
+	for iscan.Scan() {
+		line := iscan.Text()
+		if skipLine(scanner, line) {
+			continue
+		}
+		n++
+
+		if t, ok := messageTime(scanMessage(scanner, line), years); ok {
+			if !prev.IsZero() && t.After(prev) {
+				d := time.Duration(float64(t.Sub(prev)) / speed)
+				time.Sleep(d)
+				paused += d
+			}
+
+			prev = t
+		}
+
+		fmt.Fprintf(ofile, "%s\n", line)
+	}
+
+	since := time.Since(now)
+	infof("Replayed %d messages in %.2f secs (%.2f secs paused)", n, float64(since)/float64(time.Second), float64(paused)/float64(time.Second))
+	logSummary()
+}
+
+// messageTime returns the time of the first time token in the sequence, with the
+// year inferred by years, if it's not nil.
+func messageTime(seq sequence.Sequence, years *sequence.YearInferrer) (time.Time, bool) {
+	for _, tok := range seq {
+		if tok.Type == sequence.TokenTime {
+			if t, err := sequence.ParseTime(tok.Value); err == nil {
+				if years != nil {
+					t = years.Infer(t)
+				}
+
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// newYearInferrer returns the inferrer of the years of the times without one in
+// the input file, according to --infer-year, or nil if no years are inferred. The
+// years are inferred relative to the modification time of the file for "mtime",
+// to the current time for "now", or so the first time is in the year given, e.g.,
+// "2014".
+func newYearInferrer(file string) *sequence.YearInferrer {
+	switch inferyear {
+	case "none":
+		return nil
+
+	case "now":
+		return sequence.NewYearInferrer(time.Now())
+
+	case "mtime":
+		// messages received on a socket are current
+		if isSocketInput(file) {
+			return sequence.NewYearInferrer(time.Now())
+		}
+
+		// tar members take the modification time of the archive
+		if archive, _ := splitTarName(file); archive != "" {
+			file = archive
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return sequence.NewYearInferrer(fi.ModTime())
+	}
+
+	year, err := strconv.Atoi(inferyear)
+	if err != nil || year <= 0 {
+		log.Fatalf("Invalid year inference %q: expecting mtime, now, none or a year", inferyear)
+	}
+
+	return sequence.NewYearInferrer(time.Date(year, time.December, 31, 23, 59, 59, 0, time.UTC))
+}
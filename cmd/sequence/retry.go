@@ -0,0 +1,61 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// maxBackoff is the longest time waited between two attempts.
+const maxBackoff = 30 * time.Second
+
+// retryableError is an error of a network output that's worth retrying, e.g., a
+// connection error or a 5xx response. Other errors, e.g., a 4xx response, fail
+// the same way on every attempt, so they are not retried.
+type retryableError struct {
+	error
+}
+
+// retry calls fn until it succeeds, returns an error that's not a retryableError,
+// or it has been called attempts times, and returns the last error. The time
+// waited between attempts is random, up to backoff, which doubles after each
+// attempt up to maxBackoff, so many runs failing at once don't retry in lockstep.
+func retry(attempts int, backoff time.Duration, what string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		rerr, ok := err.(retryableError)
+		if !ok {
+			return err
+		}
+
+		if attempt >= attempts {
+			return rerr.error
+		}
+
+		var wait time.Duration
+		if backoff > 0 {
+			wait = time.Duration(rand.Int63n(int64(backoff))) + 1
+		}
+
+		debugf("Error %s, attempt %d of %d, retrying in %s: %v", what, attempt, attempts, wait, rerr.error)
+		time.Sleep(wait)
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+// inferSchema reads a json log file and reports the union schema of its messages,
+// one key per line, along with the types of its values, the percentage of messages
+// it's present in and a few example values.
+func inferSchema(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	schema := sequence.NewSchema()
+
+	iscan, ifile := openInputFile(infile)
+	defer ifile.Close()
+
+	n := 0
+
+	for iscan.Scan() {
+		line := iscan.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		n++
+
+		if err := schema.Add(line); err != nil {
+			errorf("Error (%s) adding %s: %s", err, iscan.Position(), line)
+		}
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	fields := schema.Fields()
+
+	for _, f := range fields {
+		fmt.Fprintf(ofile, "%s %s %.1f%% %s\n", f.Key, strings.Join(f.Types, "|"), f.Presence*100, strings.Join(f.Examples, ", "))
+	}
+
+	infof("Inferred %d keys from %d messages, %d of them invalid.", len(fields), n, n-schema.Len())
+	logSummary()
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/trustpath/sequence"
+)
+
+// selftestSample is a message of the built-in sample corpus, the pattern that
+// parses it, and some of the values it's expected to be parsed into.
+type selftestSample struct {
+	msg    string
+	pat    string
+	values map[string]string
+}
+
+var selftestSamples = []selftestSample{
+	{
+		msg:    "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+		pat:    "%msgtime% %apphost% %appname% [ %sessionid% ] : Failed %method% for %srcuser% from %srcip% port %srcport% ssh2",
+		values: map[string]string{"appname": "sshd", "sessionid": "7034", "srcuser": "root", "srcip": "218.161.81.238", "srcport": "4228"},
+	},
+	{
+		msg:    "Jan 12 06:49:42 irc sshd[7034]: Accepted publickey for admin from 10.0.0.1 port 52100 ssh2",
+		pat:    "%msgtime% %apphost% %appname% [ %sessionid% ] : Accepted %method% for %srcuser% from %srcip% port %srcport% ssh2",
+		values: map[string]string{"method": "publickey", "srcuser": "admin", "srcip": "10.0.0.1", "srcport": "52100"},
+	},
+	{
+		msg:    "2014-01-12T06:49:42Z kernel: connection from 192.168.1.10 to 10.0.0.2 closed after 120 bytes",
+		pat:    "%msgtime% %appname% : connection from %srcip% to %dstip% closed after %bytessent% bytes",
+		values: map[string]string{"appname": "kernel", "srcip": "192.168.1.10", "dstip": "10.0.0.2", "bytessent": "120"},
+	},
+}
+
+// selftestReport collects the results of the checks of the self test, and writes
+// each as a line of the report.
+type selftestReport struct {
+	w      io.Writer
+	failed int
+	total  int
+}
+
+func (this *selftestReport) result(check string, err error, format string, args ...interface{}) {
+	this.total++
+
+	if err != nil {
+		this.failed++
+		fmt.Fprintf(this.w, "FAIL  %-9s %v\n", check, err)
+		return
+	}
+
+	fmt.Fprintf(this.w, "PASS  %-9s %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (this *selftestReport) skip(check, reason string) {
+	fmt.Fprintf(this.w, "SKIP  %-9s %s\n", check, reason)
+}
+
+// selftest validates the config file, loads the patterns, checks the input can be
+// read and the outputs can be written, and parses a built-in sample corpus, and
+// writes a pass/fail report of each check to the output. It exits with an error if
+// any of the checks failed, so it can be used as a container startup probe or a
+// pre-deploy check.
+func selftest(cmd *cobra.Command, args []string) {
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	report := &selftestReport{w: ofile}
+
+	err := findConfig()
+	if err == nil {
+		err = loadConfig()
+	}
+	report.result("config", err, "read %s", configName())
+
+	if err == nil {
+		readConfig()
+
+		if patfile == "" {
+			report.skip("patterns", "no patterns specified")
+		} else {
+			n, err := selftestPatterns()
+			report.result("patterns", err, "added %d patterns from %s", n, patfile)
+		}
+
+		n, err := selftestCorpus()
+		report.result("samples", err, "parsed %d sample messages", n)
+	} else {
+		report.skip("patterns", "no valid config")
+		report.skip("samples", "no valid config")
+	}
+
+	if infile == "" {
+		report.skip("input", "no input specified")
+	} else {
+		n, err := selftestInput(infile)
+		report.result("input", err, "opened %d input files of %s", n, infile)
+	}
+
+	for _, out := range []struct{ check, file string }{
+		{"output", outfile},
+		{"metrics", metricsfile},
+	} {
+		if out.file != "" {
+			report.result(out.check, selftestOutput(out.file), "can write to %s", filepath.Dir(out.file))
+		}
+	}
+
+	if pushgateway != "" {
+		report.result("push", selftestPushgateway(pushgateway), "reached %s", pushgateway)
+	}
+
+	logSummary()
+
+	if report.failed > 0 {
+		ofile.Close()
+		log.Fatalf("Self test failed %d of %d checks", report.failed, report.total)
+	}
+
+	infof("Self test passed %d checks.", report.total)
+}
+
+// selftestPatterns reads the patterns and adds them to a parser, and returns the
+// number of patterns added.
+func selftestPatterns() (int, error) {
+	var (
+		pats []sequence.Pattern
+		err  error
+	)
+
+	if sequence.IsPatternDB(patfile) {
+		var db *sequence.PatternDB
+		if db, err = sequence.OpenPatternDB(patfile); err != nil {
+			return 0, err
+		}
+
+		if trustedkeys != "" {
+			keys, err := sequence.ReadTrustedKeys(trustedkeys)
+			if err != nil {
+				return 0, err
+			}
+
+			if err := db.VerifySignature(keys...); err != nil {
+				return 0, err
+			}
+		}
+
+		pats, err = db.Patterns()
+	} else if fi, serr := os.Stat(patfile); serr != nil {
+		return 0, serr
+	} else if fi.IsDir() {
+		pats, err = sequence.ReadPatterns(getDirOfFiles(patfile)...)
+	} else {
+		pats, err = sequence.ReadPatterns(patfile)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	parser := sequence.NewParser()
+
+	for _, pat := range pats {
+		if err := parser.AddPattern(pat); err != nil {
+			return 0, fmt.Errorf("Error adding pattern %s: %v", pat, err)
+		}
+	}
+
+	return len(pats), nil
+}
+
+// selftestCorpus parses the built-in sample corpus with its own patterns, and
+// checks the values of the parsed messages, and returns the number of messages
+// parsed.
+func selftestCorpus() (int, error) {
+	parser := sequence.NewParser()
+	scanner := sequence.NewScanner()
+
+	for _, s := range selftestSamples {
+		if err := parser.AddPattern(sequence.Pattern{Text: s.pat}); err != nil {
+			return 0, fmt.Errorf("Error adding sample pattern %q: %v", s.pat, err)
+		}
+	}
+
+	for _, s := range selftestSamples {
+		seq, err := scanner.Scan(s.msg)
+		if err != nil {
+			return 0, fmt.Errorf("Error scanning sample %q: %v", s.msg, err)
+		}
+
+		seq, _, err = parser.Match(seq)
+		if err != nil {
+			return 0, fmt.Errorf("Error parsing sample %q: %v", s.msg, err)
+		}
+
+		for name, value := range s.values {
+			var got string
+			for _, tok := range seq {
+				if tok.Tag.String() == name {
+					got = tok.Value
+					break
+				}
+			}
+
+			if got != value {
+				return 0, fmt.Errorf("Invalid %s of sample %q: expecting %q, got %q", name, s.msg, value, got)
+			}
+		}
+	}
+
+	return len(selftestSamples), nil
+}
+
+// selftestInput opens the input files of the input, which can be a file, a
+// directory of files, or a glob pattern, and returns the number of files.
+func selftestInput(path string) (int, error) {
+	var files []string
+
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(matches) == 0 {
+			return 0, fmt.Errorf("Invalid input file specified, no files match %q", path)
+		}
+
+		files = matches
+	} else if fi, err := os.Stat(path); err != nil {
+		return 0, err
+	} else if fi.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, fi := range infos {
+			files = append(files, filepath.Join(path, fi.Name()))
+		}
+	} else {
+		files = []string{path}
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return 0, err
+		}
+		f.Close()
+	}
+
+	return len(files), nil
+}
+
+// selftestOutput checks a file can be created in the directory of the output file,
+// without touching the output file itself.
+func selftestOutput(file string) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), ".sequence-selftest-")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// selftestPushgateway checks the Pushgateway at url is up.
+func selftestPushgateway(url string) error {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(strings.TrimRight(url, "/") + "/-/healthy")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Invalid response from Pushgateway: %s", resp.Status)
+	}
+
+	return nil
+}
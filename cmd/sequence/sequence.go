@@ -21,13 +21,15 @@
 package main
 
 import (
-	"bufio"
-	"compress/gzip"
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"runtime/pprof"
 	"sort"
 	"strings"
@@ -47,6 +49,37 @@ var (
 	cpuprofile string
 	workers    int
 	format     string
+	ratelimit  string
+	rateburst  int
+	joinsql    bool
+	normsql    bool
+	separator  string
+	binpolicy  string
+	usemmap    bool
+	explain    bool
+	suggest    int
+	fworkers   int
+	pworkers   int
+	sesskeys   string
+	eventid    bool
+	eventkeys  string
+	sesswindow time.Duration
+	winevents  bool
+	jsonfields string
+	jsonrest   bool
+	srcname    string
+	sortorder  string
+
+	// source is the source selected by --source or matched from the input file path
+	source sequence.Source
+
+	// keeptext is whether the scanners keep the text of the messages around the
+	// tokens, so the rest of the messages matched by prefix patterns is as is
+	keeptext bool
+
+	// inputs are the input files opened, used to report on them in the run summary
+	inputs   []*sequence.RecordScanner
+	inputsMu sync.Mutex
 
 	quit chan struct{}
 	done chan struct{}
@@ -79,9 +112,44 @@ func (d dataSlice) Swap(i, j int) {
 	d[i], d[j] = d[j], d[i]
 }
 
-// Less is part of sort.Interface. We use count as the value to sort by
+// Less is part of sort.Interface. We use count as the value to sort by, and the
+// pattern to break ties so the order doesn't change from one run to the next
 func (d dataSlice) Less(i, j int) bool {
-	return d[i].cnt > d[j].cnt
+	if d[i].cnt != d[j].cnt {
+		return d[i].cnt > d[j].cnt
+	}
+	return d[i].pat < d[j].pat
+}
+
+// alphaSlice sorts the patterns alphabetically
+type alphaSlice struct {
+	dataSlice
+}
+
+// Less is part of sort.Interface. We use the pattern as the value to sort by
+func (d alphaSlice) Less(i, j int) bool {
+	return d.dataSlice[i].pat < d.dataSlice[j].pat
+}
+
+const (
+	sortCount    = "count"
+	sortAlpha    = "alpha"
+	sortCoverage = "coverage"
+)
+
+// sortPatterns sorts the analyzed patterns in the order set by --sort. Coverage
+// sorts the same way as count, the most frequent patterns first, but the output
+// also records the share of the messages covered by each pattern and those before
+// it, so it's clear how many patterns are needed to cover most of the messages.
+func sortPatterns(s dataSlice) {
+	switch sortorder {
+	case sortCount, sortCoverage:
+		sort.Sort(s)
+	case sortAlpha:
+		sort.Sort(alphaSlice{s})
+	default:
+		log.Fatalf("Invalid sort order %q", sortorder)
+	}
 }
 
 func profile() {
@@ -97,33 +165,42 @@ func profile() {
 		pprof.StartCPUProfile(f)
 	}
 
+	stop := func() {
+		if f != nil {
+			glog.Errorf("Stopping profile")
+			pprof.StopCPUProfile()
+			f.Close()
+		}
+	}
+
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, os.Interrupt, os.Kill)
 	go func() {
 		select {
 		case sig := <-sigchan:
-			log.Printf("Existing due to trapped signal; %v", sig)
+			warnf("Existing due to trapped signal; %v", sig)
 
-		case <-quit:
-			log.Println("Quiting...")
+			// the command is cut short, so its deferred Close of the outputs never runs
+			stop()
+			closeOutputs()
+			os.Exit(0)
 
-		}
+		case <-quit:
+			debugf("Quiting...")
 
-		if f != nil {
-			glog.Errorf("Stopping profile")
-			pprof.StopCPUProfile()
-			f.Close()
 		}
 
+		// the command returns, and main exits, once its deferred calls are done
+		stop()
 		close(done)
-		os.Exit(0)
 	}()
 }
 
 func scan(cmd *cobra.Command, args []string) {
 	readConfig()
+	checkOutputFormat()
 
-	scanner := sequence.NewScanner()
+	scanner := newScanner()
 
 	if infile != "" {
 		// Open input file
@@ -135,16 +212,18 @@ func scan(cmd *cobra.Command, args []string) {
 
 		for iscan.Scan() {
 			line := iscan.Text()
-			if len(line) == 0 || line[0] == '#' {
+			if skipLine(scanner, line) {
 				continue
 			}
 
 			seq := scanMessage(scanner, line)
-			fmt.Fprintf(ofile, "%s\n\n", seq.PrintTokens())
+			fmt.Fprint(ofile, formatScan(iscan.Position().String(), line, seq))
 		}
+
+		logSummary()
 	} else if len(args) == 1 && args[0] != "" {
 		seq := scanMessage(scanner, args[0])
-		fmt.Println(seq.PrintTokens())
+		fmt.Println(strings.TrimRight(formatScan("", args[0], seq), "\n"))
 	} else {
 		log.Fatal("Invalid input file or string specified")
 	}
@@ -159,82 +238,129 @@ func analyze(cmd *cobra.Command, args []string) {
 
 	profile()
 
-	parser := buildParser()
-	analyzer := sequence.NewAnalyzer()
-	scanner := sequence.NewScanner()
+	// Check the sort order before the analysis rather than after it's done
+	sortPatterns(nil)
 
-	// Open input file
-	iscan, ifile := openInputFile(infile)
-	defer ifile.Close()
+	if ckptfile != "" && ckptevery <= 0 {
+		log.Fatal("Invalid checkpoint interval specified, must be greater than 0")
+	}
 
-	// For all the log messages, if we can't parse it, then let's add it to the
-	// analyzer for pattern analysis
-	for iscan.Scan() {
-		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
+	if isSocketInput(infile) {
+		log.Fatal("Invalid input file specified, analyze reads its input twice and can't read a socket")
+	}
 
-		seq := scanMessage(scanner, line)
+	files := inputFiles(infile)
 
-		if _, err := parser.Parse(seq); err != nil {
-			analyzer.Add(seq)
-		}
+	if ckptfile != "" && len(files) > 1 {
+		log.Fatal("Invalid input file specified, checkpoints require a single input file")
 	}
 
-	ifile.Close()
-	analyzer.Finalize()
-
-	iscan, ifile = openInputFile(infile)
-	defer ifile.Close()
+	parser := buildParser()
+	analyzer := sequence.NewAnalyzer()
+	dict := newValueDictionary()
 
 	pmap := make(map[string]pMapStruct)
 	amap := make(map[string]pMapStruct)
 	n := 0
+	capper := newErrorCapper(maxerrors)
+
+	// If there's a checkpoint, resume the analysis right after the last message
+	// processed, in the pass it was processed in
+	ckpt := loadCheckpoint()
+	if ckpt != nil {
+		analyzer = ckpt.analyzer()
+	}
+
+	// The messages are split into chunks that are analyzed concurrently, and the
+	// results of the chunks are merged in order, so they are the same as if the
+	// messages were analyzed one at a time
+	var offset int64
+	if ckpt != nil {
+		offset = ckpt.Offset
+	}
+
+	if ckpt == nil || ckpt.Pass == 1 {
+		k := 0
+
+		// For all the log messages, if we can't parse it, then let's add it to the
+		// analyzer of the chunk for pattern analysis
+		forEachChunk(files, offset, func(c *chunk, scanner *sequence.Scanner) interface{} {
+			atree := sequence.NewAnalyzer()
+
+			c.each(scanner, func(line string, pos sequence.Position) {
+				seq := scanMessage(scanner, line)
+
+				if _, err := parser.Parse(seq); err != nil {
+					atree.Add(seq)
+				}
+			})
+
+			return atree
+		}, func(c *chunk, result interface{}) {
+			if err := analyzer.Merge(result.(*sequence.Analyzer)); err != nil {
+				log.Fatal(err)
+			}
+
+			prev := k
+			if k += c.n; ckptfile != "" && k/ckptevery > prev/ckptevery {
+				saveCheckpoint(1, c.last(), 0, analyzer, nil, nil)
+			}
+		})
+
+		analyzer.Finalize()
+		ckpt, offset = nil, 0
+	} else {
+		n, pmap, amap = ckpt.Messages, toStats(ckpt.Parsed), toStats(ckpt.Analyzed)
+	}
+
+	// Only count the binary records once, in the pass below
+	resetInputs()
 
 	// Now that we have built the analyzer, let's go through each log message again
 	// to determine the unique patterns
-	for iscan.Scan() {
-		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
-		n++
+	forEachChunk(files, offset, func(c *chunk, scanner *sequence.Scanner) interface{} {
+		stats := &chunkStats{pmap: make(map[string]pMapStruct), amap: make(map[string]pMapStruct)}
 
-		seq := scanMessage(scanner, line)
-
-		pseq, err := parser.Parse(seq)
-		if err == nil {
-			pat := pseq.String()
-			stat, ok := pmap[pat]
-			if !ok {
-				stat = struct {
-					ex  string
-					cnt int
-				}{}
-			}
-			stat.ex = line
-			stat.cnt++
-			pmap[pat] = stat
-		} else {
-			aseq, err := analyzer.Analyze(seq)
+		c.each(scanner, func(line string, pos sequence.Position) {
+			seq := scanMessage(scanner, line)
+
+			var aseq sequence.Sequence
+
+			pseq, err := parser.Parse(seq)
 			if err != nil {
-				log.Printf("Error analyzing: %s", line)
-			} else {
-				pat := aseq.String()
-				stat, ok := amap[pat]
-				if !ok {
-					stat = struct {
-						ex  string
-						cnt int
-					}{}
+				if aseq, err = analyzer.Analyze(seq); err != nil && capper.Allow(err.Error()) {
+					errorf("Error analyzing %s: %s", pos, line)
 				}
-				stat.ex = line
-				stat.cnt++
-				amap[pat] = stat
 			}
+
+			if aseq != nil && dict != nil {
+				dict.Add(aseq)
+			}
+
+			if pseq != nil {
+				addStat(stats.pmap, pseq.String(), line, 1)
+			} else if aseq != nil {
+				addStat(stats.amap, aseq.String(), line, 1)
+			}
+		})
+
+		return stats
+	}, func(c *chunk, result interface{}) {
+		stats := result.(*chunkStats)
+
+		for pat, stat := range stats.pmap {
+			addStat(pmap, pat, stat.ex, stat.cnt)
 		}
-	}
+
+		for pat, stat := range stats.amap {
+			addStat(amap, pat, stat.ex, stat.cnt)
+		}
+
+		prev := n
+		if n += c.n; ckptfile != "" && n/ckptevery > prev/ckptevery {
+			saveCheckpoint(2, c.last(), n, analyzer, pmap, amap)
+		}
+	})
 
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
@@ -252,16 +378,44 @@ func analyze(cmd *cobra.Command, args []string) {
 	for pat, d := range amap {
 		s = append(s, sortableStruct{ex: d.ex, cnt: d.cnt, pat: pat})
 	}
-	sort.Sort(s)
+	sortPatterns(s)
+	created := time.Now().UTC().Truncate(time.Second)
+	covered := 0
 	for _, stat := range s {
-		fmt.Fprintf(ofile, "# %d log messages matched\n%v\n# %s\n\n", stat.cnt, stat.pat, stat.ex)
+		pat := sequence.Pattern{
+			Text:     stat.pat,
+			Origin:   sequence.OriginAnalyzer,
+			Created:  created,
+			Examples: []string{stat.ex},
+		}
+
+		if sortorder == sortCoverage && n > 0 {
+			covered += stat.cnt
+			pat.Comments = append(pat.Comments, fmt.Sprintf("%.2f%% of log messages covered, %.2f%% cumulative", 100*float64(stat.cnt)/float64(n), 100*float64(covered)/float64(n)))
+		}
+		pat.Comments = append(pat.Comments, fmt.Sprintf("%d log messages matched", stat.cnt))
+
+		if dict != nil {
+			pat.Comments = append(pat.Comments, enumerationComments(dict, stat.pat)...)
+		}
+
+		if err := sequence.WritePatterns(ofile, pat); err != nil {
+			warnf("Error writing pattern, skipping it: %v", err)
+		}
 	}
 
-	log.Printf("Analyzed %d messages, found %d unique patterns, %d are new.", n, len(pmap)+len(amap), len(amap))
+	capper.Summarize()
+	infof("Analyzed %d messages, found %d unique patterns, %d are new.", n, len(pmap)+len(amap), len(amap))
+	setMetric("sequence_run_messages", "Number of messages processed by the run.", float64(n))
+	setMetric("sequence_run_patterns", "Number of unique patterns found by the run.", float64(len(pmap)+len(amap)))
+	setMetric("sequence_run_new_patterns", "Number of new patterns found by the run.", float64(len(amap)))
+	logSummary()
+	removeCheckpoint()
 }
 
 func parse(cmd *cobra.Command, args []string) {
 	readConfig()
+	checkOutputFormat()
 
 	if infile == "" {
 		log.Fatal("Invalid input file specified")
@@ -270,40 +424,233 @@ func parse(cmd *cobra.Command, args []string) {
 	profile()
 
 	parser := buildParser()
-	scanner := sequence.NewScanner()
-
-	iscan, ifile := openInputFile(infile)
-	defer ifile.Close()
+	shadow := buildShadowParser()
+	sessionizer := newSessionizer()
+	hasher := newEventHasher()
 
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
 
-	n := 0
+	var ufile io.WriteCloser
+	if unmatchedfile != "" {
+		ufile = openOutput(unmatchedfile)
+		defer ufile.Close()
+	}
+
+	capper := newErrorCapper(maxerrors)
+	stats := startStreamStats()
+
+	anomalies := startAnomalies()
+	if anomalies != nil {
+		defer anomalies.Stop()
+	}
+
+	notifier := startNotify()
+	if notifier != nil {
+		defer notifier.Stop()
+	}
+
+	splitter := newOutputSplitter()
+	if splitter != nil {
+		defer splitter.Close()
+	}
+
+	var mu sync.Mutex
+	n, unmatched, dropped, disagreed := 0, 0, 0, 0
+	samples := make(map[string]int)
 	now := time.Now()
 
-	for iscan.Scan() {
-		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
-			continue
+	forEachFile(inputFiles(infile), func(file string) {
+		scanner := newScanner()
+
+		var years *sequence.YearInferrer
+		if stats != nil || splitter != nil {
+			years = newYearInferrer(file)
 		}
-		n++
 
-		seq := scanMessage(scanner, line)
+		iscan, ifile := openInputFile(file)
+		defer ifile.Close()
 
-		seq, err := parser.Parse(seq)
-		if err != nil {
-			log.Printf("Error (%s) parsing: %s", err, line)
-		} else {
-			fmt.Fprintf(ofile, "%s\n%s\n\n", line, seq.PrintTokens())
+		for iscan.Scan() {
+			line := iscan.Text()
+			if skipLine(scanner, line) {
+				continue
+			}
+
+			seq := scanMessage(scanner, line)
+
+			var exps []sequence.Explanation
+
+			pseq, pat, err := parser.Match(seq)
+			if err != nil && explain {
+				_, exps, _ = parser.ParseExplain(seq)
+			}
+
+			if stats != nil {
+				t, _ := messageTime(seq, years)
+				stats.Add(len(line), err != nil, t)
+			}
+
+			if anomalies != nil {
+				anomalies.Add(pat)
+			}
+
+			// the candidate patterns only count and log where they disagree
+			var current, candidate string
+			if shadow != nil {
+				_, spat, serr := shadow.Match(seq)
+				current, candidate = matchedText(pat, err), matchedText(spat, serr)
+			}
+
+			mu.Lock()
+			n++
+			if current != candidate {
+				disagreed++
+
+				if capper.Allow(fmt.Sprintf("shadow patterns disagree, current %s, candidate %s", current, candidate)) {
+					warnf("Shadow patterns disagree at %s, current %s, candidate %s: %s", iscan.Position(), current, candidate, line)
+				}
+			}
+			if err != nil {
+				unmatched++
+
+				// errors are grouped by the reason and the closest pattern, if known
+				key := err.Error()
+				if len(exps) > 0 {
+					key += ", closest pattern " + exps[0].Pattern.String()
+				}
+
+				logged := capper.Allow(key)
+
+				if logged || ufile != nil {
+					var details []string
+
+					for _, e := range exps {
+						details = append(details, fmt.Sprintf("  closest pattern %s", e))
+					}
+
+					if suggest > 0 {
+						for _, sug := range parser.Suggest(seq, suggest) {
+							details = append(details, fmt.Sprintf("  similar pattern %s (%.0f%% similar): %s", sug.Pattern, sug.Similarity*100, sug.Pattern.Text))
+						}
+					}
+
+					if logged {
+						errorf("Error (%s) parsing %s: %s", err, iscan.Position(), line)
+
+						for _, d := range details {
+							errorf("%s", d)
+						}
+					}
+
+					if ufile != nil {
+						writeUnmatched(ufile, iscan.Position(), err, details, line)
+					}
+				}
+
+				mu.Unlock()
+				continue
+			}
+
+			if winevents {
+				pseq = sequence.EnrichWindowsEvent(pseq)
+			}
+
+			if hasher != nil {
+				pseq, _ = hasher.EventID(pseq, pat)
+			}
+
+			if sessionizer != nil {
+				pseq, _ = sessionizer.Sessionize(pseq, pat)
+			}
+
+			if pat != nil && !sampled(samples, pat) {
+				dropped++
+			} else if splitter != nil {
+				fmt.Fprint(splitter.Writer(file, pseq, years), formatParse(iscan.Position().String(), line, pat, pseq))
+			} else {
+				fmt.Fprint(ofile, formatParse(iscan.Position().String(), line, pat, pseq))
+			}
+			mu.Unlock()
 		}
+	})
+
+	if stats != nil {
+		stats.Stop()
 	}
 
 	since := time.Since(now)
-	log.Printf("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)))
+	infof("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)))
+	if ps := parser.PoolStats(); ps.Gets > 0 {
+		debugf("Parser scratch memory was allocated for %d of %d parses.", ps.Allocs, ps.Gets)
+	}
+	capper.Summarize()
+	if dropped > 0 {
+		infof("Dropped %d matched messages by pattern sample rates.", dropped)
+	}
+	if shadow != nil {
+		infof("Shadow patterns %s disagreed on %d of %d messages.", shadowfile, disagreed, n)
+		setMetric("sequence_run_shadow_disagreements", "Number of messages matched by a different pattern, or none, with the shadow patterns.", float64(disagreed))
+	}
+	setMetric("sequence_run_messages", "Number of messages processed by the run.", float64(n))
+	setMetric("sequence_run_unmatched_messages", "Number of messages that didn't match any pattern.", float64(unmatched))
+	setMetric("sequence_run_dropped_messages", "Number of matched messages dropped by pattern sample rates.", float64(dropped))
+	logSummary()
 	close(quit)
 	<-done
 }
 
+// newSessionizer returns the sessionizer for the session keys and window flags, or
+// nil if no session keys are specified.
+func newSessionizer() *sequence.Sessionizer {
+	if sesskeys == "" {
+		return nil
+	}
+
+	keys := strings.Split(sesskeys, ",")
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+
+	s, err := sequence.NewSessionizer(sesswindow, keys...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return s
+}
+
+// newEventHasher returns the event hasher for the event ID flags, or nil if event
+// IDs are not enabled.
+func newEventHasher() *sequence.EventHasher {
+	if !eventid {
+		return nil
+	}
+
+	var keys []string
+
+	if eventkeys != "" {
+		keys = strings.Split(eventkeys, ",")
+		for i := range keys {
+			keys[i] = strings.TrimSpace(keys[i])
+		}
+	}
+
+	h, err := sequence.NewEventHasher(keys...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return h
+}
+
+// sampled counts the message matched by the pattern in samples, and returns true
+// if the message should be written according to the sample rate of the pattern.
+func sampled(samples map[string]int, pat *sequence.Pattern) bool {
+	samples[pat.String()]++
+	return pat.Sampled(samples[pat.String()])
+}
+
 func benchScan(cmd *cobra.Command, args []string) {
 	readConfig()
 
@@ -327,39 +674,18 @@ func benchScan(cmd *cobra.Command, args []string) {
 
 	profile()
 
-	now := time.Now()
+	bench := func(scanner *sequence.Scanner, line string) {
+		scanMessage(scanner, line)
+	}
 
-	if workers == 1 {
-		scanner := sequence.NewScanner()
-		for _, line := range lines {
-			scanMessage(scanner, line)
-		}
+	if sweepworkers != "" {
+		sweepBench(lines, totalSize, bench)
 	} else {
-		var wg sync.WaitGroup
-		msgpipe := make(chan string, 10000)
-
-		for i := 0; i < workers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				scanner := sequence.NewScanner()
-
-				for line := range msgpipe {
-					scanMessage(scanner, line)
-				}
-			}()
-		}
-
-		for _, line := range lines {
-			msgpipe <- line
-		}
-		close(msgpipe)
-
-		wg.Wait()
+		since := runBench(lines, workers, bench)
+		infof("Scanned %d messages in %.2f secs, ~ %.2f msgs/sec, ~ %.2f MB/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)), float64(totalSize)/float64(mbyte)/(float64(since)/float64(time.Second)))
 	}
 
-	since := time.Since(now)
-	log.Printf("Scanned %d messages in %.2f secs, ~ %.2f msgs/sec, ~ %.2f MB/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)), float64(totalSize)/float64(mbyte)/(float64(since)/float64(time.Second)))
+	logSummary()
 	close(quit)
 	<-done
 }
@@ -393,42 +719,56 @@ func benchParse(cmd *cobra.Command, args []string) {
 
 	profile()
 
-	now := time.Now()
-
-	if workers == 1 {
-		scanner := sequence.NewScanner()
+	bench := func(scanner *sequence.Scanner, line string) {
+		parser.Parse(scanMessage(scanner, line))
+	}
 
-		for _, line := range lines {
-			parser.Parse(scanMessage(scanner, line))
-		}
+	if sweepworkers != "" {
+		sweepBench(lines, totalSize, bench)
 	} else {
-		var wg sync.WaitGroup
-		msgpipe := make(chan string, 10000)
+		since := runBench(lines, workers, bench)
+		infof("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec, ~ %.2f MB/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)), float64(totalSize)/float64(mbyte)/(float64(since)/float64(time.Second)))
+	}
 
-		for i := 0; i < workers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				scanner := sequence.NewScanner()
+	logSummary()
+	close(quit)
+	<-done
+}
 
-				for line := range msgpipe {
-					parser.Parse(scanMessage(scanner, line))
-				}
-			}()
-		}
+func newScanner() *sequence.Scanner {
+	scanner := sequence.NewScanner()
+	scanner.SetJoinSQL(joinsql)
+	scanner.SetKeepText(keeptext)
+	scanner.SetNormalizeSQL(normsql)
 
-		for _, line := range lines {
-			msgpipe <- line
+	if jsonfields != "" {
+		if err := scanner.SetJsonFields(strings.Split(jsonfields, ","), jsonrest); err != nil {
+			log.Fatal(err)
 		}
-		close(msgpipe)
+	}
+
+	applyTypeProfile(scanner)
+
+	return scanner
+}
 
-		wg.Wait()
+// skipLine returns true if the line is empty or a comment, and should not be scanned.
+// For the w3c format, comments are directives, and are passed on to the scanner so
+// it picks up the field names from the #Fields directive.
+func skipLine(scanner *sequence.Scanner, line string) bool {
+	if len(line) == 0 {
+		return true
 	}
 
-	since := time.Since(now)
-	log.Printf("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec, ~ %.2f MB/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)), float64(totalSize)/float64(mbyte)/(float64(since)/float64(time.Second)))
-	close(quit)
-	<-done
+	if line[0] != '#' {
+		return false
+	}
+
+	if format == "w3c" {
+		scanMessage(scanner, line)
+	}
+
+	return true
 }
 
 func scanMessage(scanner *sequence.Scanner, data string) sequence.Sequence {
@@ -441,6 +781,21 @@ func scanMessage(scanner *sequence.Scanner, data string) sequence.Sequence {
 	case "json":
 		seq, err = scanner.ScanJson(data)
 
+	case "kv":
+		seq, err = scanner.ScanKV(data)
+
+	case "columns":
+		seq, err = scanner.ScanColumns(data)
+
+	case "haproxy":
+		seq, err = scanner.ScanHAProxy(data)
+
+	case "w3c":
+		seq, err = scanner.ScanW3C(data)
+
+	case "auto":
+		seq, err = scanner.ScanAuto(data)
+
 	default:
 		seq, err = scanner.Scan(data)
 	}
@@ -454,68 +809,249 @@ func scanMessage(scanner *sequence.Scanner, data string) sequence.Sequence {
 func buildParser() *sequence.Parser {
 	parser := sequence.NewParser()
 
+	for _, pat := range loadPatterns() {
+		if err := parser.AddPattern(pat); err != nil {
+			log.Fatalf("Error adding pattern %s: %v", pat, err)
+		}
+
+		if pat.Match == sequence.MatchPrefix {
+			keeptext = true
+		}
+	}
+
+	return parser
+}
+
+func loadPatterns() []sequence.Pattern {
 	if patfile == "" {
-		return parser
+		return nil
+	}
+
+	return loadPatternsFrom(patfile)
+}
+
+// loadPatternsFrom reads the patterns in the path, which can be a pattern file, a
+// directory of pattern files, or a pattern database.
+func loadPatternsFrom(path string) []sequence.Pattern {
+	if trustedkeys != "" && !sequence.IsPatternDB(path) {
+		log.Fatalf("Invalid patterns %s: only signed pattern databases can be used with trusted keys", path)
 	}
 
 	var files []string
 
-	if fi, err := os.Stat(patfile); err != nil {
+	if fi, err := os.Stat(path); err != nil {
 		log.Fatal(err)
+	} else if fi.Mode().IsDir() && sequence.IsPatternDB(path) {
+		return loadPatternDB(path)
 	} else if fi.Mode().IsDir() {
-		files = getDirOfFiles(patfile)
+		files = getDirOfFiles(path)
 	} else {
-		files = append(files, patfile)
+		files = append(files, path)
 	}
 
-	scanner := sequence.NewScanner()
+	pats, err := sequence.ReadPatterns(files...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	debugf("Read %d patterns from %s.", len(pats), path)
 
-	for _, file := range files {
-		// Open pattern file
-		pscan, pfile := openInputFile(file)
+	return pats
+}
 
-		for pscan.Scan() {
-			line := pscan.Text()
-			if len(line) == 0 || line[0] == '#' {
-				continue
-			}
+// loadPatternDB reads the patterns of the pattern database in the directory, after
+// checking the files against its manifest.
+func loadPatternDB(path string) []sequence.Pattern {
+	db, err := sequence.OpenPatternDB(path)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			seq, err := scanner.Scan(line)
-			if err != nil {
-				log.Fatal(err)
-			}
+	verifyPatternDB(db)
 
-			if err := parser.Add(seq); err != nil {
-				log.Fatal(err)
-			}
-		}
+	pats, err := db.Patterns()
+	if err != nil {
+		log.Fatal(err)
+	}
+	debugf("Read %d patterns from pattern database %s, version %d.", len(pats), path, db.Version)
+
+	return pats
+}
+
+func openInputFile(fname string) (*sequence.RecordScanner, io.Closer) {
+	var (
+		r io.Reader
+		c io.Closer
+	)
+
+	debugf("Reading input file %s.", fname)
 
-		pfile.Close()
+	if isSocketInput(fname) {
+		r, c = openSocketInput(fname)
+	} else if isTarInput(fname) {
+		r, c = openTarInput(fname)
+	} else {
+		r, c = openFile(fname)
 	}
 
-	return parser
+	switch binpolicy {
+	case sequence.BinarySkip, sequence.BinaryReplace, sequence.BinaryHex:
+	default:
+		log.Fatalf("Invalid binary policy %q", binpolicy)
+	}
+
+	s := sequence.NewRecordScanner(r, fname, separator, binpolicy)
+
+	if separator != "" && separator != sequence.SeparatorNewline {
+		s.Buffer(make([]byte, 0, 64*1024), mbyte)
+	}
+
+	inputsMu.Lock()
+	inputs = append(inputs, s)
+	inputsMu.Unlock()
+
+	return s, c
 }
 
-func openInputFile(fname string) (*bufio.Scanner, *os.File) {
-	var s *bufio.Scanner
+// openFile opens the input file, which is decompressed if it's gzipped, or memory
+// mapped if requested.
+func openFile(fname string) (io.Reader, io.Closer) {
+	var (
+		r io.Reader
+		c io.Closer
+	)
 
 	f, err := os.Open(fname)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	c = f
+
 	if strings.HasSuffix(fname, ".gz") {
-		gunzip, err := gzip.NewReader(f)
+		gunzip, err := sequence.NewGzipReader(progressReader(f, fname))
+		if err != nil {
+			log.Fatalf("Error reading input file %s: %v", fname, err)
+		}
+
+		r = &inputErrReader{r: gunzip, fname: fname}
+	} else if usemmap {
+		data, err := mmapFile(f)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		s = bufio.NewScanner(gunzip)
+		r = progressReader(bytes.NewReader(data), fname)
+		c = &mappedFile{File: f, data: data}
 	} else {
-		s = bufio.NewScanner(f)
+		r = progressReader(f, fname)
+	}
+
+	return r, c
+}
+
+// resetInputs forgets the input files opened so far, so they are not included in
+// the run summary.
+func resetInputs() {
+	inputsMu.Lock()
+	inputs = nil
+	inputsMu.Unlock()
+}
+
+// inputFiles returns the input files for the input, which can be a file, a
+// directory of files, or a glob pattern such as "logs/*.log". Tar archives are
+// replaced by their members, see expandTarFiles. A socket input is its own input.
+func inputFiles(path string) []string {
+	if isSocketInput(path) {
+		return []string{path}
+	}
+
+	if strings.ContainsAny(path, "*?[") {
+		files, err := filepath.Glob(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(files) == 0 {
+			log.Fatalf("Invalid input file specified, no files match %q", path)
+		}
+
+		return expandTarFiles(files)
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		log.Fatal(err)
+	} else if fi.Mode().IsDir() {
+		return expandTarFiles(getDirOfFiles(path))
+	}
+
+	return expandTarFiles([]string{path})
+}
+
+// forEachFile calls fn for each of the files, processing up to pworkers files
+// concurrently. fn must be safe to call concurrently if there's more than one
+// file.
+func forEachFile(files []string, fn func(string)) {
+	if len(files) == 1 || pworkers <= 1 {
+		for _, file := range files {
+			fn(file)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	filepipe := make(chan string)
+
+	for i := 0; i < pworkers && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range filepipe {
+				fn(file)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		filepipe <- file
+	}
+	close(filepipe)
+
+	wg.Wait()
+}
+
+// mappedFile is an input file that's memory-mapped, it's unmapped when closed.
+type mappedFile struct {
+	*os.File
+	data []byte
+}
+
+func (this *mappedFile) Close() error {
+	if err := munmapFile(this.data); err != nil {
+		return err
+	}
+
+	return this.File.Close()
+}
+
+// logSummary adds the number of records with binary bytes to the run summary, and
+// writes the run metrics.
+func logSummary() {
+	inputsMu.Lock()
+	defer inputsMu.Unlock()
+
+	records, binaries := 0, 0
+	for _, s := range inputs {
+		records += s.Records()
+		binaries += s.Binaries()
 	}
 
-	return s, f
+	if binaries > 0 {
+		infof("Found %d messages with NUL or invalid UTF-8 bytes, applied binary policy %q.", binaries, binpolicy)
+	}
+
+	writeMetrics(records, binaries)
+	saveTypeProfile()
 }
 
 func getDirOfFiles(path string) []string {
@@ -533,43 +1069,96 @@ func getDirOfFiles(path string) []string {
 	return filenames
 }
 
-func openOutputFile(fname string) *os.File {
-	var (
-		ofile *os.File
-		err   error
-	)
+func openOutputFile(fname string) io.WriteCloser {
+	ofile := openOutput(fname)
 
-	if fname == "" {
-		ofile = os.Stdin
-	} else {
-		// Open output file
-		ofile, err = os.OpenFile(fname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-		if err != nil {
-			log.Fatal(err)
+	limit := newOutputLimiter()
+	if limit == nil {
+		return ofile
+	}
+
+	return &rateLimitedWriter{w: ofile, limit: limit}
+}
+
+// findConfig sets the config file, if it's not specified, to ./sequence.toml, or
+// else to sequence.toml in the same directory as the program. If neither exists,
+// the config embedded in the program is used, if any, and the config file is left
+// empty.
+func findConfig() error {
+	if cfgfile != "" {
+		return nil
+	}
+
+	files := []string{"./sequence.toml"}
+	if slash := strings.LastIndex(os.Args[0], "/"); slash != -1 {
+		files = append(files, os.Args[0][:slash]+"/sequence.toml")
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			cfgfile = file
+			return nil
 		}
 	}
 
-	return ofile
+	if defaultConfig == nil {
+		return fmt.Errorf("No configuration file found")
+	}
+
+	return nil
 }
 
-func readConfig() {
+// loadConfig reads the config file, or the embedded config if there's none.
+func loadConfig() error {
 	if cfgfile == "" {
-		cfgfile = "./sequence.toml"
+		return sequence.ReadConfigData(defaultConfig)
+	}
 
-		if _, err := os.Stat(cfgfile); err != nil {
-			if slash := strings.LastIndex(os.Args[0], "/"); slash != -1 {
-				cfgfile = os.Args[0][:slash] + "/sequence.toml"
+	return sequence.ReadConfig(cfgfile)
+}
 
-				if _, err := os.Stat(cfgfile); err != nil {
-					log.Fatalln("No configuration file found")
-				}
-			}
-		}
+// configName returns the name of the config read, for the log.
+func configName() string {
+	if cfgfile == "" {
+		return "embedded config"
+	}
+
+	return "config file " + cfgfile
+}
+
+func readConfig() {
+	if err := findConfig(); err != nil {
+		log.Fatalln(err)
 	}
 
-	if err := sequence.ReadConfig(cfgfile); err != nil {
+	if err := loadConfig(); err != nil {
 		log.Fatal(err)
 	}
+	debugf("Read %s.", configName())
+
+	if srcname != "" {
+		src, ok := sequence.LookupSource(srcname)
+		if !ok {
+			log.Fatalf("Invalid source %q: not defined in %s", srcname, configName())
+		}
+		source = src
+	} else if infile != "" {
+		source, _ = sequence.MatchSource(infile)
+	}
+
+	if source.Name != "" {
+		debugf("Using source %q.", source.Name)
+	}
+
+	source.Apply()
+
+	if format == "" {
+		format = source.Format
+	}
+
+	if patfile == "" {
+		patfile = source.Patterns
+	}
 }
 
 func main() {
@@ -597,6 +1186,61 @@ func main() {
 			Short: "parses a log file and output a list of parsed tokens for each of the log messages",
 		}
 
+		coverageCmd = &cobra.Command{
+			Use:   "coverage",
+			Short: "parses a log file and output the number of log messages matched by each pattern, along with its provenance",
+		}
+
+		corpusCmd = &cobra.Command{
+			Use:   "corpus",
+			Short: "extracts one example log message for each unique pattern in a log file",
+		}
+
+		schemaCmd = &cobra.Command{
+			Use:   "schema",
+			Short: "infers the union schema of a json log file and output each key with its types, presence and example values",
+		}
+
+		replayCmd = &cobra.Command{
+			Use:   "replay",
+			Short: "replays a log file to the output, paced by the timestamps of the log messages",
+		}
+
+		patternsCmd = &cobra.Command{
+			Use:   "patterns",
+			Short: "manages versioned pattern databases, i.e., directories of pattern files with a manifest of their checksums",
+		}
+
+		packCmd = &cobra.Command{
+			Use:   "pack",
+			Short: "packs the pattern files in a directory into a single bundle, with a manifest of their checksums",
+		}
+
+		diffCmd = &cobra.Command{
+			Use:   "diff dirA dirB",
+			Short: "parses a log file with two pattern directories and reports the messages matched by a different pattern, or none, with the second",
+		}
+
+		keygenCmd = &cobra.Command{
+			Use:   "keygen",
+			Short: "generates a key pair for signing pattern bundles, the public key is written to the output file with a .pub extension",
+		}
+
+		unpackCmd = &cobra.Command{
+			Use:   "unpack",
+			Short: "unpacks a pattern bundle into a directory, after verifying the files against the manifest",
+		}
+
+		selftestCmd = &cobra.Command{
+			Use:   "selftest",
+			Short: "validates the config, patterns, input and outputs, and parses a built-in sample corpus, for use as a startup probe or pre-deploy check",
+		}
+
+		versionCmd = &cobra.Command{
+			Use:   "version",
+			Short: "outputs the version of the program, how it was built, and the optional components included in the build",
+		}
+
 		benchCmd = &cobra.Command{
 			Use:   "bench",
 			Short: "benchmarks scanning or parsing of a log file, no output is provided",
@@ -613,28 +1257,121 @@ func main() {
 		}
 	)
 
-	sequenceCmd.PersistentFlags().StringVarP(&cfgfile, "config", "", "", "TOML-formatted configuration file, default checks ./sequence.toml, then sequence.toml in the same directory as program")
-	sequenceCmd.PersistentFlags().StringVarP(&format, "format", "", "", "format of the message to tokenize, can be 'json' or leave empty")
-	sequenceCmd.PersistentFlags().StringVarP(&infile, "input", "i", "", "input file, required")
-	sequenceCmd.PersistentFlags().StringVarP(&outfile, "output", "o", "", "output file, if empty, to stdout")
+	sequenceCmd.PersistentFlags().IntVarP(&maxerrors, "max-errors", "", 10, "maximum number of errors logged for each failure reason, the rest are summarized at the end of the run, 0 means no limit")
+	sequenceCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only log warnings and fatal errors, not the errors of each message or the summary of the run")
+	sequenceCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "also log the details of the run, such as the config file, source, patterns and input files used")
+	sequenceCmd.PersistentFlags().StringVarP(&logformat, "log-format", "", "text", "format of the diagnostics written to stderr, can be 'text' or 'json' for a json object per line")
+	sequenceCmd.PersistentFlags().StringVarP(&cfgfile, "config", "", "", "TOML-formatted configuration file, default checks ./sequence.toml, then sequence.toml in the same directory as program, then the config embedded in the program")
+	sequenceCmd.PersistentFlags().StringVarP(&srcname, "source", "", "", "name of the source defined in the config file to use, default matches the input file path against the paths of the sources")
+	sequenceCmd.PersistentFlags().StringVarP(&format, "format", "", "", "format of the message to tokenize, can be 'json', 'kv', 'columns', 'w3c', 'haproxy' to split the timers, 'auto' to detect json per message, or leave empty")
+	sequenceCmd.PersistentFlags().StringVarP(&separator, "separator", "", "", "record separator of the input file, can be 'newline', 'blank', 'nul', 'octet' for RFC 6587 octet counted frames, 'indent' for indented continuation lines, 'mysql-slow' for MySQL slow query logs, or a literal marker, default is newline")
+	sequenceCmd.PersistentFlags().StringVarP(&binpolicy, "binary", "", sequence.BinaryReplace, "how to handle NUL and invalid UTF-8 bytes in the input file, can be 'skip', 'replace' or 'hex'")
+	sequenceCmd.PersistentFlags().DurationVarP(&progressinterval, "progress", "", 0, "time between reports of the share of each input file read so far, e.g., 30s, 0 means no reports")
+	sequenceCmd.PersistentFlags().BoolVarP(&usemmap, "mmap", "", false, "memory-map local uncompressed input files instead of reading them, which can be faster on fast local disks")
+	sequenceCmd.PersistentFlags().StringVarP(&maxmemory, "max-memory", "", "", "maximum memory the run may use before it's aborted, e.g., 512MB or 4GB")
+	sequenceCmd.PersistentFlags().StringVarP(&metricsfile, "metrics-file", "", "", "file to write the run metrics to at the end of the run, in the Prometheus text format, e.g., for the node exporter textfile collector")
+	sequenceCmd.PersistentFlags().StringVarP(&pushgateway, "pushgateway", "", "", "URL of the Prometheus Pushgateway to push the run metrics to at the end of the run, e.g., http://localhost:9091")
+	sequenceCmd.PersistentFlags().IntVarP(&pushattempts, "push-attempts", "", 3, "maximum number of attempts to push the metrics to the Pushgateway, connection errors and 5xx and 429 responses are retried")
+	sequenceCmd.PersistentFlags().DurationVarP(&pushbackoff, "push-backoff", "", time.Second, "maximum random wait before the first retry of a push, doubled after each retry up to 30s")
+	sequenceCmd.PersistentFlags().DurationVarP(&maxruntime, "max-runtime", "", 0, "maximum time the run may take before it's aborted, e.g., 30m or 2h")
+	sequenceCmd.PersistentFlags().StringVarP(&infile, "input", "i", "", "input file, required, analyze and parse also accept a directory or glob pattern, scan and parse also accept a socket, e.g., unix:/run/sequence.sock, unixgram:/run/sequence.dgram, zmq-sub:tcp://127.0.0.1:5556 or zmq-pull:ipc:///run/logs.ipc")
+	sequenceCmd.PersistentFlags().StringVarP(&tarmembers, "tar-members", "", "", "glob of the members of .tar, .tar.gz and .tgz input archives to read, matched against the member path or its base name, e.g., '*.log', all if empty")
+	sequenceCmd.PersistentFlags().StringVarP(&outfile, "output", "o", "", "output file, if empty, to stdout, can also be a named pipe or a Unix socket, e.g., unix:/run/consumer.sock or unixgram:/run/consumer.dgram")
+	sequenceCmd.PersistentFlags().StringVarP(&noreader, "no-reader", "", readerBlock, "what to do with the records written to a named pipe or Unix socket output while it has no reader, can be 'block' to wait for one up to --reader-timeout and then drop them, 'drop', or 'spool' to keep them in --spool-file until it has one")
+	sequenceCmd.PersistentFlags().DurationVarP(&readertimeout, "reader-timeout", "", 0, "maximum time to wait for the reader of a named pipe or Unix socket output to connect or to read a record, 0 means no maximum")
+	sequenceCmd.PersistentFlags().StringVarP(&spoolfile, "spool-file", "", "", "file the records are spooled to with --no-reader spool, if empty, the output path with .spool appended")
+	sequenceCmd.PersistentFlags().StringVarP(&spoolmax, "spool-max", "", "64MB", "maximum size of the spool file, records are dropped once it's full")
+	sequenceCmd.PersistentFlags().StringVarP(&trustedkeys, "trusted-keys", "", "", "file of PEM encoded ed25519 public keys, if set only pattern databases signed by one of the keys are used")
 	sequenceCmd.PersistentFlags().StringVarP(&patfile, "patterns", "p", "", "patterns, can be a file or directory, used by analyze and parse")
+	sequenceCmd.PersistentFlags().StringVarP(&outbuffer, "output-buffer", "", "64KB", "size of the buffer of the output, e.g., 64KB or 1MB")
+	sequenceCmd.PersistentFlags().DurationVarP(&outflush, "flush-interval", "", time.Second, "maximum time records are kept in the output buffer before they are written, 0 means only when the buffer is full")
+	sequenceCmd.PersistentFlags().IntVarP(&outbatch, "output-batch", "", 0, "maximum number of records kept in the output buffer before they are written, 0 means only when the buffer is full, replay writes each record as it's replayed")
+	sequenceCmd.PersistentFlags().StringVarP(&ratelimit, "rate-limit", "", "", "maximum number of records written to the output, e.g., 1000/s, 500/m, 36000/h")
+	sequenceCmd.PersistentFlags().IntVarP(&rateburst, "rate-burst", "", 1, "number of records that can be written in a burst above the rate limit")
+	sequenceCmd.PersistentFlags().BoolVarP(&joinsql, "join-sql", "", false, "scan embedded SQL statements, e.g., of database logs, as a single token")
+	sequenceCmd.PersistentFlags().BoolVarP(&normsql, "normalize-sql", "", false, "scan embedded SQL statements as a single token with the values replaced by ?, so messages cluster by query shape")
+	sequenceCmd.PersistentFlags().StringVarP(&jsonfields, "json-fields", "", "", "comma separated json fields to tokenize for the json format, e.g., eventName,userIdentity.type,records[*].id, all if empty")
+	sequenceCmd.PersistentFlags().BoolVarP(&jsonrest, "json-rest", "", false, "keep the json fields not selected by --json-fields as a single msgrest token instead of dropping them")
+	sequenceCmd.PersistentFlags().StringVarP(&typeproffile, "type-profile", "", "", "json file of the number of literals found to be each token type, e.g., host, used to order the token type checks of the scanner and updated at the end of the run")
 
 	benchCmd.PersistentFlags().StringVarP(&cpuprofile, "cpuprofile", "", "", "CPU profile filename")
 	benchCmd.PersistentFlags().IntVarP(&workers, "workers", "", 1, "number of parsing workers")
+	benchCmd.PersistentFlags().StringVarP(&sweepworkers, "sweep-workers", "", "", "comma separated worker counts, e.g., 1,2,4,8,16, to run the benchmark at and output a scaling table for")
+
+	analyzeCmd.Flags().IntVarP(&fworkers, "workers", "", runtime.NumCPU(), "number of chunks of the input analyzed concurrently")
+	analyzeCmd.Flags().IntVarP(&chunksize, "chunk-size", "", 10000, "number of messages in each chunk of the input analyzed by a worker, the patterns found don't depend on it")
+	scanCmd.Flags().StringVarP(&outformat, "output-format", "", outputText, "format of the tokens written to the output, can be 'text' or 'json' for a json object per message with the tag, type, value and offset of each token")
+	scanCmd.Flags().StringVarP(&printstyle, "print-style", "", "full", "layout of the tokens in the text output format, can be 'full', 'compact' for a single line per message, or 'table'")
+	scanCmd.Flags().StringVarP(&colormode, "color", "", "auto", "color the tokens by type in the text output format, can be 'auto' to color only when writing to a terminal, 'always' or 'never'")
+	parseCmd.Flags().StringVarP(&outformat, "output-format", "", outputText, "format of the tokens written to the output, can be 'text' or 'json' for a json object per message with the tag, type, value and offset of each token")
+	parseCmd.Flags().IntVarP(&pworkers, "workers", "", 1, "number of input files processed concurrently, if the input is a directory or glob pattern, the messages of the files are written in no particular order if more than 1")
+	parseCmd.Flags().StringVarP(&splitoutput, "split-output", "", "", "template of the output files to split the parsed messages into, e.g., out/{apphost}.log, out/{msgtime:2006-01-02}.log or out/{source}, instead of the output file")
+	parseCmd.Flags().IntVarP(&splitmaxfiles, "split-max-files", "", 256, "maximum number of split output files kept open, the file used least recently is closed to open another, and appended to if it's written to again")
+	parseCmd.Flags().StringVarP(&unmatchedfile, "unmatched", "", "", "file to write the messages that don't match to, with the error, closest and similar patterns of each as comments, so it can be used as input")
+	parseCmd.Flags().BoolVarP(&explain, "explain", "", false, "for each message that doesn't match, report the closest patterns and the token that broke the match")
+	parseCmd.Flags().IntVarP(&suggest, "suggest", "", 0, "for each message that doesn't match, report this many of the most similar patterns")
+	parseCmd.Flags().StringVarP(&sesskeys, "session-keys", "", "", "comma separated fields that identify related messages, e.g., apphost,sessionid, to assign a flowid to each session")
+	parseCmd.Flags().StringVarP(&shadowfile, "shadow-patterns", "", "", "candidate patterns, a file or directory, to also match each message with, logging only the messages they match differently from the patterns")
+	parseCmd.Flags().BoolVarP(&eventid, "event-id", "", false, "add an eventid field with a stable hash of the pattern, the timestamp and the event ID keys, so downstream stores can deduplicate replays")
+	parseCmd.Flags().StringVarP(&eventkeys, "event-id-keys", "", "", "comma separated fields hashed into the event ID, e.g., apphost,sessionid, if empty, all the fields are hashed")
+	parseCmd.Flags().BoolVarP(&winevents, "windows-events", "", false, "add the action and category of well-known Windows event IDs, extracted as msgid, to the parsed fields")
+	parseCmd.Flags().DurationVarP(&statsinterval, "stats-interval", "", 0, "time between reports of the message and failure rates and the lag over the stats window, to the log and the metrics, e.g., 10s, 0 means no reports")
+	parseCmd.Flags().DurationVarP(&statswindow, "stats-window", "", time.Minute, "time the rates reported with --stats-interval are averaged over")
+	parseCmd.Flags().StringVarP(&anomalyfile, "anomalies", "", "", "file to write json events to for the patterns whose number of messages in an anomaly interval deviates sharply from their learned baseline, e.g., new patterns, bursts and quiet sources")
+	parseCmd.Flags().DurationVarP(&anomalyinterval, "anomaly-interval", "", time.Minute, "interval the number of messages of each pattern is counted over for --anomalies")
+	parseCmd.Flags().Float64VarP(&anomalythreshold, "anomaly-threshold", "", 3, "number of standard deviations from the baseline of a pattern its count must be to be an anomaly")
+	parseCmd.Flags().DurationVarP(&sesswindow, "session-window", "", 0, "maximum time between related messages in a session, e.g., 5m, 0 means no limit")
+	packCmd.Flags().StringVarP(&signkey, "sign-key", "", "", "PEM encoded ed25519 private key file to sign the bundle with, see patterns keygen")
+	analyzeCmd.Flags().StringVarP(&sortorder, "sort", "", sortCount, "order of the patterns written to the output, can be 'count' for the most frequent first, 'alpha' for alphabetical, or 'coverage' to also record the cumulative share of messages covered")
+	analyzeCmd.Flags().StringVarP(&ckptfile, "checkpoint", "", "", "checkpoint file to periodically save the progress of the analysis to, and to resume the analysis from if it exists")
+	analyzeCmd.Flags().IntVarP(&ckptevery, "checkpoint-every", "", 1000000, "number of messages processed between checkpoints")
+	analyzeCmd.Flags().StringVarP(&dictfields, "dict-fields", "", "", "comma separated fields, or token types of untagged tokens, e.g., action,status,string, whose values are learned for each new pattern and recorded as comments if they take at most --dict-max-values values, values seen before resuming from a checkpoint are not counted")
+	analyzeCmd.Flags().IntVarP(&dictmax, "dict-max-values", "", 10, "maximum number of values of a field recorded with --dict-fields")
+
+	sequenceCmd.PersistentFlags().StringVarP(&inferyear, "infer-year", "", "mtime", "how the year of times without one is inferred, relative to the input file's 'mtime', to 'now', or so the first time is in a given year, e.g., 2014, or 'none'")
+	replayCmd.Flags().Float64VarP(&speed, "speed", "", 1, "replay speed multiplier, e.g., 2 replays twice as fast as the original timing")
 
 	scanCmd.Run = scan
 	analyzeCmd.Run = analyze
 	parseCmd.Run = parse
+	replayCmd.Run = replay
+	corpusCmd.Run = extractCorpus
+	coverageCmd.Run = coverage
+	schemaCmd.Run = inferSchema
+	selftestCmd.Run = selftest
+	versionCmd.Run = buildInfo
 	benchScanCmd.Run = benchScan
 	benchParseCmd.Run = benchParse
+	packCmd.Run = packPatterns
+	unpackCmd.Run = unpackPatterns
+	keygenCmd.Run = keygenPatterns
+	diffCmd.Run = diffPatterns
 
 	benchCmd.AddCommand(benchScanCmd)
 	benchCmd.AddCommand(benchParseCmd)
 
+	patternsCmd.AddCommand(packCmd)
+	patternsCmd.AddCommand(unpackCmd)
+	patternsCmd.AddCommand(keygenCmd)
+	patternsCmd.AddCommand(diffCmd)
+
 	sequenceCmd.AddCommand(scanCmd)
 	sequenceCmd.AddCommand(analyzeCmd)
 	sequenceCmd.AddCommand(parseCmd)
+	sequenceCmd.AddCommand(replayCmd)
+	sequenceCmd.AddCommand(corpusCmd)
+	sequenceCmd.AddCommand(coverageCmd)
+	sequenceCmd.AddCommand(schemaCmd)
+	sequenceCmd.AddCommand(selftestCmd)
+	sequenceCmd.AddCommand(versionCmd)
 	sequenceCmd.AddCommand(benchCmd)
+	sequenceCmd.AddCommand(patternsCmd)
+
+	sequenceCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		setupLogging()
+		startMetrics(cmd.CommandPath())
+		startLimits()
+	}
 
 	sequenceCmd.Execute()
 }
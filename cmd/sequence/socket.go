@@ -0,0 +1,237 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The prefixes of the socket inputs, e.g., "unix:/run/sequence.sock", which are
+// read until the run is stopped, rather than until the end of a file.
+const (
+	socketUnix     = "unix:"     // Unix stream socket that's listened on
+	socketUnixgram = "unixgram:" // Unix datagram socket that's listened on
+	socketZmqSub   = "zmq-sub:"  // ZeroMQ SUB socket connected to a PUB endpoint, e.g., zmq-sub:tcp://127.0.0.1:5556
+	socketZmqPull  = "zmq-pull:" // ZeroMQ PULL socket bound to an endpoint, e.g., zmq-pull:ipc:///run/logs.ipc
+)
+
+var socketPrefixes = []string{socketUnix, socketUnixgram, socketZmqSub, socketZmqPull}
+
+// isSocketInput returns true if the input file is a socket input.
+func isSocketInput(fname string) bool {
+	_, addr := splitSocketName(fname)
+	return addr != ""
+}
+
+// splitSocketName returns the prefix and address of the socket input, or empty
+// strings if it's not a socket input.
+func splitSocketName(fname string) (string, string) {
+	for _, prefix := range socketPrefixes {
+		if strings.HasPrefix(fname, prefix) {
+			return prefix, fname[len(prefix):]
+		}
+	}
+
+	return "", ""
+}
+
+// openSocketInput listens on or connects to the socket input, and returns the
+// reader of the records received.
+func openSocketInput(fname string) (io.Reader, io.Closer) {
+	prefix, addr := splitSocketName(fname)
+
+	in := &socketInput{closed: make(chan struct{})}
+	in.pr, in.pw = io.Pipe()
+
+	var err error
+
+	switch prefix {
+	case socketUnix:
+		err = in.listenUnix(addr)
+
+	case socketUnixgram:
+		err = in.listenUnixgram(addr)
+
+	default:
+		err = in.listenZmq(prefix, addr)
+	}
+
+	if err != nil {
+		log.Fatalf("Error opening input %s: %v", fname, err)
+	}
+
+	infof("Reading input %s until the run is stopped.", fname)
+
+	return &inputErrReader{r: in.pr, fname: fname}, in
+}
+
+// socketInput forwards the data received on a socket to a pipe that's read by the
+// record scanner. The lines of concurrent stream connections are not mixed, and
+// datagrams and ZeroMQ messages are forwarded whole, ending with a line break if
+// they don't. So records of more than one line, e.g., with --separator blank, are
+// only kept together if they're sent in a single message or by a single sender.
+type socketInput struct {
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	// mu serializes the writes of the connections
+	mu sync.Mutex
+
+	closers []io.Closer
+	unlink  string
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (this *socketInput) Close() error {
+	this.once.Do(func() {
+		close(this.closed)
+
+		for _, c := range this.closers {
+			c.Close()
+		}
+
+		if this.unlink != "" {
+			os.Remove(this.unlink)
+		}
+
+		this.pw.Close()
+	})
+
+	return nil
+}
+
+// fail stops the input at the error, unless it's due to the input being closed.
+func (this *socketInput) fail(err error) {
+	select {
+	case <-this.closed:
+	default:
+		this.pw.CloseWithError(err)
+	}
+}
+
+// write forwards the data, adding a line break if it doesn't end with one.
+func (this *socketInput) write(data []byte) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, err := this.pw.Write(data); err != nil {
+		return err
+	}
+
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := this.pw.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listenUnix accepts connections on the Unix stream socket, and forwards the lines
+// read from each of them.
+func (this *socketInput) listenUnix(path string) error {
+	removeStaleSocket(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	this.closers = append(this.closers, l)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				this.fail(err)
+				return
+			}
+
+			go this.serve(conn)
+		}
+	}()
+
+	return nil
+}
+
+// serve forwards the lines read from the connection until it's closed.
+func (this *socketInput) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if this.write(line) != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				warnf("Error reading connection to %s: %v", conn.LocalAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// listenUnixgram forwards the datagrams received on the Unix datagram socket.
+func (this *socketInput) listenUnixgram(path string) error {
+	removeStaleSocket(path)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	this.closers = append(this.closers, conn)
+	this.unlink = path
+
+	go func() {
+		buf := make([]byte, mbyte)
+
+		for {
+			n, _, err := conn.ReadFromUnix(buf)
+			if err != nil {
+				this.fail(err)
+				return
+			}
+
+			if this.write(buf[:n]) != nil {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// removeStaleSocket removes the socket file left behind by a previous run that
+// wasn't stopped cleanly, so it can be listened on again. Other files are kept, so
+// listening fails rather than deleting them.
+func removeStaleSocket(path string) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trustpath/sequence"
+)
+
+const (
+	// splitSource is the placeholder of the base name of the input file
+	splitSource = "source"
+
+	// splitUnknown is the value of the placeholders of fields the message doesn't have
+	splitUnknown = "unknown"
+)
+
+var (
+	splitoutput   string
+	splitmaxfiles int
+)
+
+// outputSplitter writes the parsed messages to output files named by expanding a
+// template with the values of each message, e.g., "out/{apphost}.log" writes the
+// messages of each host to their own file. A placeholder is either the name of a
+// field, a time field with a time layout, e.g., "{msgtime:2006-01-02}" for a file
+// per day, or "{source}" for the base name of the input file. The files are opened
+// as they are needed, and at most splitmaxfiles are kept open, so a field with
+// many values, e.g., {srcip}, doesn't run out of file descriptors. The file used
+// least recently is closed to open another, and is appended to if it's needed
+// again. The rate limit is for all the files. It's not safe to use concurrently.
+type outputSplitter struct {
+	parts []splitPart
+	limit *rateLimiter
+	files map[string]*splitFile
+
+	// opened are the files opened so far, and used counts the messages written,
+	// to find the file used least recently
+	opened map[string]bool
+	used   int64
+}
+
+// splitFile is an open output file of a splitter, and used is when it was used
+// last.
+type splitFile struct {
+	w    io.WriteCloser
+	used int64
+}
+
+// splitPart is either the literal text of a template, or a placeholder of a field
+// with an optional time layout.
+type splitPart struct {
+	text   string
+	field  string
+	layout string
+}
+
+// newOutputSplitter returns the splitter of the split output template, or nil if
+// there's none.
+func newOutputSplitter() *outputSplitter {
+	if splitoutput == "" {
+		return nil
+	}
+
+	if splitmaxfiles < 1 {
+		log.Fatalf("Invalid split max files %d: expecting a positive number of files", splitmaxfiles)
+	}
+
+	this := &outputSplitter{
+		limit:  newOutputLimiter(),
+		files:  make(map[string]*splitFile),
+		opened: make(map[string]bool),
+	}
+
+	for s := splitoutput; s != ""; {
+		i := strings.IndexByte(s, '{')
+		if i == -1 {
+			this.parts = append(this.parts, splitPart{text: s})
+			break
+		}
+
+		k := strings.IndexByte(s[i:], '}')
+		if k == -1 {
+			log.Fatalf("Invalid split output %q: expecting } after {", splitoutput)
+		}
+
+		part := splitPart{field: s[i+1 : i+k]}
+		if j := strings.IndexByte(part.field, ':'); j != -1 {
+			part.field, part.layout = part.field[:j], part.field[j+1:]
+		}
+
+		if part.field == "" {
+			log.Fatalf("Invalid split output %q: expecting a field name between { and }", splitoutput)
+		}
+
+		this.parts = append(this.parts, splitPart{text: s[:i]}, part)
+		s = s[i+k+1:]
+	}
+
+	if len(this.parts) < 2 {
+		log.Fatalf("Invalid split output %q: expecting at least one {field}", splitoutput)
+	}
+
+	return this
+}
+
+// Writer returns the output of the parsed message read from the input file. The
+// years of times without one are inferred by years, if it's not nil.
+func (this *outputSplitter) Writer(file string, seq sequence.Sequence, years *sequence.YearInferrer) io.Writer {
+	name := this.name(file, seq, years)
+
+	this.used++
+
+	f, ok := this.files[name]
+	if !ok {
+		if len(this.files) >= splitmaxfiles {
+			this.closeLeastUsed()
+		}
+
+		f = &splitFile{w: this.open(name)}
+		this.files[name] = f
+	}
+
+	f.used = this.used
+
+	if this.limit != nil {
+		return &rateLimitedWriter{w: f.w, limit: this.limit}
+	}
+
+	return f.w
+}
+
+// open opens the output file, which is truncated the first time it's opened, and
+// appended to if it's opened again.
+func (this *outputSplitter) open(name string) io.WriteCloser {
+	if this.opened[name] {
+		return appendOutput(name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	debugf("Writing split output file %s.", name)
+
+	this.opened[name] = true
+
+	return openOutput(name)
+}
+
+// closeLeastUsed closes the open output file used least recently.
+func (this *outputSplitter) closeLeastUsed() {
+	var least string
+
+	for name, f := range this.files {
+		if least == "" || f.used < this.files[least].used {
+			least = name
+		}
+	}
+
+	this.close(least)
+}
+
+func (this *outputSplitter) close(name string) {
+	if err := this.files[name].w.Close(); err != nil {
+		warnf("Error closing split output file %s: %v", name, err)
+	}
+
+	delete(this.files, name)
+}
+
+// Close closes the output files still open.
+func (this *outputSplitter) Close() {
+	for name := range this.files {
+		this.close(name)
+	}
+
+	infof("Wrote %d split output files.", len(this.opened))
+}
+
+// name returns the output file name of the message.
+func (this *outputSplitter) name(file string, seq sequence.Sequence, years *sequence.YearInferrer) string {
+	var buf bytes.Buffer
+
+	for _, part := range this.parts {
+		if part.field == "" {
+			buf.WriteString(part.text)
+		} else {
+			buf.WriteString(this.value(part, file, seq, years))
+		}
+	}
+
+	return buf.String()
+}
+
+// value returns the value of the placeholder for the message. Values can't contain
+// path separators, so a message can't have its output written outside the
+// directories in the template, e.g., with a host name of "../../etc".
+func (this *outputSplitter) value(part splitPart, file string, seq sequence.Sequence, years *sequence.YearInferrer) string {
+	var value string
+
+	if part.field == splitSource {
+		value = filepath.Base(file)
+		if _, member := splitTarName(file); member != "" {
+			value = filepath.Base(member)
+		}
+	} else {
+		for _, tok := range seq {
+			if tok.Tag != sequence.TagUnknown && source.FieldName(tok.Tag) == part.field {
+				value = tok.Value
+				break
+			}
+		}
+	}
+
+	if value != "" && part.layout != "" {
+		t, err := sequence.ParseTime(value)
+		if err != nil {
+			return splitUnknown
+		}
+
+		if years != nil {
+			t = years.Infer(t)
+		}
+
+		// the layout is part of the template, so it can contain path separators
+		return t.Format(part.layout)
+	}
+
+	switch value {
+	case "":
+		return splitUnknown
+	case ".", "..":
+		return "_"
+	}
+
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputSplitterMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	defer func(o, b, r string, m int, f time.Duration) {
+		splitoutput, outbuffer, ratelimit, splitmaxfiles, outflush = o, b, r, m, f
+	}(splitoutput, outbuffer, ratelimit, splitmaxfiles, outflush)
+
+	splitoutput, outbuffer, ratelimit, splitmaxfiles, outflush = filepath.Join(dir, "{source}"), "64KB", "", 2, 0
+
+	splitter := newOutputSplitter()
+
+	// c closes b, the file used least recently, and b closes a, and each file closed
+	// is appended to when it's needed again
+	for _, file := range []string{"a.log", "b.log", "a.log", "c.log", "b.log", "a.log"} {
+		fmt.Fprintf(splitter.Writer(file, nil, nil), "%s\n", file)
+		require.True(t, len(splitter.files) <= 2)
+	}
+
+	splitter.Close()
+
+	for name, data := range map[string]string{
+		"a.log": "a.log\na.log\na.log\n",
+		"b.log": "b.log\nb.log\n",
+		"c.log": "c.log\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, data, string(got))
+	}
+}
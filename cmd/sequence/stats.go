@@ -0,0 +1,171 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	statsinterval time.Duration
+	statswindow   time.Duration
+)
+
+// streamStats keeps the number of messages, bytes and failures of each interval
+// in a sliding window, and periodically reports the rates over the window, along
+// with the lag behind the newest message, to the log and the run metrics. It's
+// meant for long running parses, e.g., of a named pipe that's written to by a
+// log shipper, where the end of run summary comes too late.
+type streamStats struct {
+	mu sync.Mutex
+
+	// buckets is a ring of the counts of the last intervals, cur is the current one
+	buckets []statsBucket
+	cur     int
+
+	// newest is the newest message time parsed so far
+	newest time.Time
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+type statsBucket struct {
+	start    time.Time
+	messages int
+	bytes    int
+	failures int
+}
+
+// startStreamStats starts reporting the stats every stats interval, or returns nil
+// if no interval is specified.
+func startStreamStats() *streamStats {
+	if statsinterval == 0 {
+		return nil
+	}
+
+	if statsinterval < 0 || statswindow < statsinterval {
+		log.Fatalf("Invalid stats interval %s and window %s: expecting a positive interval no longer than the window", statsinterval, statswindow)
+	}
+
+	this := &streamStats{
+		buckets: make([]statsBucket, (statswindow+statsinterval-1)/statsinterval),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	this.buckets[0].start = time.Now()
+
+	go func() {
+		defer close(this.done)
+
+		ticker := time.NewTicker(statsinterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				this.report(now)
+
+			case <-this.quit:
+				return
+			}
+		}
+	}()
+
+	return this
+}
+
+// Add counts a message of size bytes, and whether it failed to parse. The time of
+// the message, if not zero, is used to find the lag of the newest message.
+func (this *streamStats) Add(size int, failed bool, t time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	b := &this.buckets[this.cur]
+	b.messages++
+	b.bytes += size
+	if failed {
+		b.failures++
+	}
+
+	if t.After(this.newest) {
+		this.newest = t
+	}
+}
+
+// Stop stops reporting the stats.
+func (this *streamStats) Stop() {
+	close(this.quit)
+	<-this.done
+}
+
+// report reports the rates over the intervals in the window, and starts the next
+// interval, dropping the oldest one once the window is full.
+func (this *streamStats) report(now time.Time) {
+	this.mu.Lock()
+
+	var (
+		total statsBucket
+		start = now
+	)
+
+	for _, b := range this.buckets {
+		if b.start.IsZero() {
+			continue
+		}
+
+		if b.start.Before(start) {
+			start = b.start
+		}
+
+		total.messages += b.messages
+		total.bytes += b.bytes
+		total.failures += b.failures
+	}
+
+	newest := this.newest
+
+	this.cur = (this.cur + 1) % len(this.buckets)
+	this.buckets[this.cur] = statsBucket{start: now}
+
+	this.mu.Unlock()
+
+	secs := now.Sub(start).Seconds()
+	if secs <= 0 {
+		return
+	}
+
+	var ratio float64
+	if total.messages > 0 {
+		ratio = float64(total.failures) / float64(total.messages)
+	}
+
+	// the lag is unknown until a message with a time is parsed
+	lag := -1.0
+	if !newest.IsZero() {
+		lag = now.Sub(newest).Seconds()
+	}
+
+	infof("Last %.0f secs: %.2f msgs/sec, %.2f KB/sec, %.2f%% failed, %.0f secs lag", secs, float64(total.messages)/secs, float64(total.bytes)/1024/secs, ratio*100, lag)
+
+	setMetric("sequence_stream_messages_per_second", "Messages processed per second over the stats window.", float64(total.messages)/secs)
+	setMetric("sequence_stream_bytes_per_second", "Bytes of messages processed per second over the stats window.", float64(total.bytes)/secs)
+	setMetric("sequence_stream_failure_ratio", "Share of the messages over the stats window that didn't match any pattern.", ratio)
+	setMetric("sequence_stream_lag_seconds", "Time between now and the newest message time parsed, -1 if none had a time.", lag)
+	publishMetrics()
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/trustpath/sequence"
+)
+
+var (
+	typeproffile string
+
+	// typeprof is the profile read from the type profile file, and scanners are
+	// the scanners created since, whose counts are added to it at the end
+	typeprof     sequence.TypeProfile
+	typeprofOnce sync.Once
+	scanners     []*sequence.Scanner
+	scannersMu   sync.Mutex
+)
+
+// applyTypeProfile orders the token type checks of the scanner by the type profile
+// read from the type profile file, if any, and keeps the scanner so its counts are
+// saved to the file at the end of the run.
+func applyTypeProfile(scanner *sequence.Scanner) {
+	if typeproffile == "" {
+		return
+	}
+
+	typeprofOnce.Do(loadTypeProfile)
+
+	scanner.SetTypeProfile(typeprof)
+
+	scannersMu.Lock()
+	scanners = append(scanners, scanner)
+	scannersMu.Unlock()
+}
+
+func loadTypeProfile() {
+	typeprof = make(sequence.TypeProfile)
+
+	data, err := ioutil.ReadFile(typeproffile)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := json.Unmarshal(data, &typeprof); err != nil {
+		log.Fatalf("Error reading type profile %s: %v", typeproffile, err)
+	}
+
+	debugf("Read type profile %v from %s.", typeprof, typeproffile)
+}
+
+// saveTypeProfile adds the counts of the scanners created so far to the type
+// profile, and writes it back to the type profile file, so the profile keeps
+// learning the mix of token types of the source across runs.
+func saveTypeProfile() {
+	scannersMu.Lock()
+	defer scannersMu.Unlock()
+
+	if len(scanners) == 0 {
+		return
+	}
+
+	for _, s := range scanners {
+		typeprof.Merge(s.TypeProfile())
+	}
+	scanners = nil
+
+	data, err := json.MarshalIndent(typeprof, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(typeproffile, append(data, '\n'), 0644); err != nil {
+		warnf("Error writing type profile %s: %v", typeproffile, err)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	outbuffer string
+	outflush  time.Duration
+	outbatch  int
+
+	// outputs are the output writers open, flushed if the run is aborted
+	outputs   []*bufferedWriter
+	outputsMu sync.Mutex
+)
+
+// bufferedWriter buffers the records written to an output, a file or stdout, so
+// each record doesn't cost a system call. The buffer is flushed when it's full,
+// after every batch of records if there's a batch size, every flush interval if
+// there is one, so a slow trickle of records still shows up promptly, and when the
+// writer is closed. Stdout is flushed, but not closed. Each call to Write is one
+// record.
+type bufferedWriter struct {
+	mu   sync.Mutex
+	buf  *bufio.Writer
+	w    io.WriteCloser
+	quit chan struct{}
+	done chan struct{}
+
+	// batch is the maximum number of records buffered, 0 if there's no maximum,
+	// and pending is the number of records written since the last flush
+	batch   int
+	pending int
+}
+
+func newBufferedWriter(w io.WriteCloser, size, batch int, interval time.Duration) *bufferedWriter {
+	this := &bufferedWriter{
+		buf:   bufio.NewWriterSize(w, size),
+		w:     w,
+		batch: batch,
+	}
+
+	if interval > 0 {
+		this.quit = make(chan struct{})
+		this.done = make(chan struct{})
+
+		go func() {
+			defer close(this.done)
+
+			tick := time.NewTicker(interval)
+			defer tick.Stop()
+
+			for {
+				select {
+				case <-tick.C:
+					if err := this.Flush(); err != nil {
+						warnf("Error flushing output: %v", err)
+					}
+
+				case <-this.quit:
+					return
+				}
+			}
+		}()
+	}
+
+	return this
+}
+
+func (this *bufferedWriter) Write(p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	n, err := this.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if this.pending++; this.batch > 0 && this.pending >= this.batch {
+		this.pending = 0
+		err = this.buf.Flush()
+	}
+
+	return n, err
+}
+
+// Flush writes the buffered records to the output.
+func (this *bufferedWriter) Flush() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.pending = 0
+
+	return this.buf.Flush()
+}
+
+func (this *bufferedWriter) Close() error {
+	outputsMu.Lock()
+	for i, bw := range outputs {
+		if bw == this {
+			outputs = append(outputs[:i], outputs[i+1:]...)
+			break
+		}
+	}
+	outputsMu.Unlock()
+
+	if this.quit != nil {
+		close(this.quit)
+		<-this.done
+		this.quit = nil
+	}
+
+	err := this.Flush()
+
+	if this.w == os.Stdout {
+		return err
+	}
+
+	if cerr := this.w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// openOutput returns the buffered writer for the output file, or for stdout if the
+// file name is empty, using the output buffer size and flush interval flags. The
+// records written to a named pipe or Unix socket are not batched, so a record is
+// never split between writes, see localWriter.
+func openOutput(fname string) *bufferedWriter {
+	return openOutputFlag(fname, os.O_TRUNC)
+}
+
+// appendOutput returns the buffered writer for the output file, the same as
+// openOutput, except the records are appended to the file if it exists.
+func appendOutput(fname string) *bufferedWriter {
+	return openOutputFlag(fname, os.O_APPEND)
+}
+
+func openOutputFlag(fname string, flag int) *bufferedWriter {
+	var w io.WriteCloser = os.Stdout
+
+	batch := outbatch
+
+	if isSocketInput(fname) && !isLocalOutput(fname) {
+		log.Fatalf("Invalid output %q: ZeroMQ sockets are only supported as inputs", fname)
+	}
+
+	if isLocalOutput(fname) {
+		w, batch = openLocalOutput(fname), 1
+	} else if fname != "" {
+		f, err := os.OpenFile(fname, os.O_CREATE|flag|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w = f
+	}
+
+	size, err := parseSize(outbuffer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if outflush < 0 {
+		log.Fatalf("Invalid flush interval %s: expecting a positive duration", outflush)
+	}
+
+	if outbatch < 0 {
+		log.Fatalf("Invalid output batch %d: expecting a positive number of records", outbatch)
+	}
+
+	bw := newBufferedWriter(w, int(size), batch, outflush)
+
+	outputsMu.Lock()
+	outputs = append(outputs, bw)
+	outputsMu.Unlock()
+
+	return bw
+}
+
+// closeOutputs closes all the output writers opened, e.g., before the run exits
+// on a signal, without the deferred Close of the command.
+func closeOutputs() {
+	outputsMu.Lock()
+	open := append([]*bufferedWriter(nil), outputs...)
+	outputsMu.Unlock()
+
+	for _, bw := range open {
+		if err := bw.Close(); err != nil {
+			warnf("Error closing output: %v", err)
+		}
+	}
+}
+
+// flushOutputs flushes all the output writers opened, e.g., before the run exits
+// without closing them.
+func flushOutputs() {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	for _, bw := range outputs {
+		if err := bw.Flush(); err != nil {
+			warnf("Error flushing output: %v", err)
+		}
+	}
+}
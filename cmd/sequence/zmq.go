@@ -0,0 +1,79 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+package main
+
+import (
+	"context"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func init() {
+	components = append(components, "zmq")
+}
+
+// listenZmq connects a SUB socket to the endpoint, subscribed to all the messages,
+// or binds a PULL socket to it, and forwards the messages received. The last frame
+// of a multipart message is the log message, the frames before it are taken to be
+// the topic or envelope.
+func (this *socketInput) listenZmq(prefix, endpoint string) error {
+	var sock zmq4.Socket
+
+	if prefix == socketZmqSub {
+		sock = zmq4.NewSub(context.Background())
+
+		if err := sock.Dial(endpoint); err != nil {
+			sock.Close()
+			return err
+		}
+
+		if err := sock.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+			sock.Close()
+			return err
+		}
+	} else {
+		sock = zmq4.NewPull(context.Background())
+
+		if err := sock.Listen(endpoint); err != nil {
+			sock.Close()
+			return err
+		}
+	}
+
+	this.closers = append(this.closers, sock)
+
+	go func() {
+		for {
+			msg, err := sock.Recv()
+			if err != nil {
+				this.fail(err)
+				return
+			}
+
+			if len(msg.Frames) == 0 {
+				continue
+			}
+
+			if this.write(msg.Frames[len(msg.Frames)-1]) != nil {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
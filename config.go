@@ -16,7 +16,12 @@ package sequence
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/zhenjl/porter2"
@@ -24,9 +29,14 @@ import (
 
 var (
 	config struct {
-		tagIDs   map[string]TagType
-		tagNames []string
-		tagTypes []TokenType
+		tagIDs      map[string]TagType
+		tagNames    []string
+		tagTypes    []TokenType
+		timeFormats []string
+		timeZones   map[string]*time.Location
+		columns     []column
+		punctuation string
+		sources     []Source
 	}
 
 	keymaps struct {
@@ -39,23 +49,59 @@ var (
 	allTypesCount   int
 )
 
+// ReadConfig reads the configuration from the TOML-formatted file, e.g.,
+// sequence.toml.
 func ReadConfig(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return ReadConfigData(data)
+}
+
+// ReadConfigData reads the configuration from TOML-formatted data, e.g., a config
+// embedded in a program, so it doesn't depend on a file being deployed with it.
+func ReadConfigData(data []byte) error {
 	var configInfo struct {
 		Version     string
 		TimeFormats []string
+		TimeZones   map[string]string
 		Tags        []string
+		Columns     []string
+		Punctuation string
 
 		Analyzer struct {
 			Prekeys  map[string][]string
 			Keywords map[string][]string
 		}
+
+		Sources map[string]struct {
+			Paths       []string
+			Format      string
+			Patterns    string
+			TimeFormats []string
+			Fields      map[string]string
+		}
 	}
 
-	if _, err := toml.DecodeFile(file, &configInfo); err != nil {
+	if _, err := toml.Decode(string(data), &configInfo); err != nil {
 		return err
 	}
 
 	timeFsmRoot = buildTimeFSM(configInfo.TimeFormats)
+	config.timeFormats = configInfo.TimeFormats
+
+	config.timeZones = make(map[string]*time.Location, len(configInfo.TimeZones))
+
+	for abbr, name := range configInfo.TimeZones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("Error parsing time zone %q: %v", abbr, err)
+		}
+
+		config.timeZones[abbr] = loc
+	}
 
 	config.tagIDs = make(map[string]TagType, 30)
 	config.tagNames = config.tagNames[:0]
@@ -112,9 +158,197 @@ func ReadConfig(file string) error {
 	TagTypesCount = len(config.tagNames)
 	allTypesCount = TokenTypesCount + TagTypesCount
 
+	config.columns = config.columns[:0]
+
+	for i, c := range configInfo.Columns {
+		col, err := parseColumn(c)
+		if err != nil {
+			return err
+		}
+
+		if col.width == 0 && i != len(configInfo.Columns)-1 {
+			return fmt.Errorf("Error parsing column %q: only the last column can have a width of 0", c)
+		}
+
+		config.columns = append(config.columns, col)
+	}
+
+	if err := validPunctuation(configInfo.Punctuation); err != nil {
+		return err
+	}
+
+	config.punctuation = configInfo.Punctuation
+
+	config.sources = config.sources[:0]
+
+	for name, si := range configInfo.Sources {
+		src := Source{
+			Name:        name,
+			Paths:       si.Paths,
+			Format:      si.Format,
+			Patterns:    si.Patterns,
+			TimeFormats: si.TimeFormats,
+			Fields:      si.Fields,
+		}
+
+		if err := src.validate(); err != nil {
+			return err
+		}
+
+		config.sources = append(config.sources, src)
+	}
+
+	sort.Sort(sources(config.sources))
+
 	return nil
 }
 
+// Source is a named source of messages defined in the config file, with its own
+// format, time formats, patterns and output field names, e.g.,
+//
+//	[sources.nginx]
+//	paths = ["/var/log/nginx/*.log"]
+//	format = "kv"
+//	patterns = "patterns/nginx"
+//	timeFormats = ["_2/Jan/2006:15:04:05 -0700"]
+//
+//	[sources.nginx.fields]
+//	srcip = "client_ip"
+//
+// Any setting that's left empty falls back to the global configuration.
+type Source struct {
+	Name        string            // Name is the name of the source, e.g., "nginx".
+	Paths       []string          // Paths are the glob patterns of the files of the source.
+	Format      string            // Format is the format of the messages, e.g., "json" or "kv".
+	Patterns    string            // Patterns is the pattern file or directory of the source.
+	TimeFormats []string          // TimeFormats replace the global time formats if not empty.
+	Fields      map[string]string // Fields are the output names of the tags, e.g., srcip = "client_ip".
+}
+
+// Sources returns the sources defined in the config file, sorted by name.
+func Sources() []Source {
+	return config.sources
+}
+
+// LookupSource returns the source with the name, and false if there isn't one.
+func LookupSource(name string) (Source, bool) {
+	for _, src := range config.sources {
+		if src.Name == name {
+			return src, true
+		}
+	}
+
+	return Source{}, false
+}
+
+// MatchSource returns the first source, by name, that has a path pattern matching
+// the file path, and false if there isn't one. A pattern without a directory, e.g.,
+// "*.log", is matched against the base name of the file.
+func MatchSource(path string) (Source, bool) {
+	for _, src := range config.sources {
+		for _, p := range src.Paths {
+			name := path
+			if !strings.Contains(p, "/") {
+				name = filepath.Base(path)
+			}
+
+			if ok, _ := filepath.Match(p, name); ok {
+				return src, true
+			}
+		}
+	}
+
+	return Source{}, false
+}
+
+// Apply replaces the global time formats with the time formats of the source, if
+// it has any. The other settings are applied by the caller, e.g., by choosing the
+// scan method for the format.
+func (this Source) Apply() {
+	if len(this.TimeFormats) > 0 {
+		timeFsmRoot = buildTimeFSM(this.TimeFormats)
+		config.timeFormats = this.TimeFormats
+	}
+}
+
+// FieldName returns the output name of the tag for the source, which is the name
+// of the tag unless it's mapped to another one.
+func (this Source) FieldName(tag TagType) string {
+	if name, ok := this.Fields[tag.String()]; ok {
+		return name
+	}
+
+	return tag.String()
+}
+
+// PrintTokens is the same as Sequence.PrintTokens, except the tags are printed
+// using their output names for the source.
+func (this Source) PrintTokens(seq Sequence) string {
+	var str string
+	for i, t := range seq {
+		str += fmt.Sprintf("# %3d: %s\n", i, t.format(this.FieldName(t.Tag)))
+	}
+
+	return str[:len(str)-1]
+}
+
+func (this Source) validate() error {
+	switch this.Format {
+	case "", "json", "kv", "columns", "w3c", "auto", "haproxy":
+	default:
+		return fmt.Errorf("Error parsing source %q: invalid format %q", this.Name, this.Format)
+	}
+
+	for _, p := range this.Paths {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("Error parsing source %q: invalid path %q", this.Name, p)
+		}
+	}
+
+	for tag := range this.Fields {
+		if name2TagType(tag) == TagUnknown {
+			return fmt.Errorf("Error parsing source %q: unknown tag %q", this.Name, tag)
+		}
+	}
+
+	return nil
+}
+
+type sources []Source
+
+func (this sources) Len() int           { return len(this) }
+func (this sources) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this sources) Less(i, j int) bool { return this[i].Name < this[j].Name }
+
+// column is a single column of fixed-width messages.
+type column struct {
+	width int     // width of the column in bytes, 0 means the rest of the message
+	tag   TagType // tag of the column, TagUnknown if the column should be tokenized
+}
+
+func parseColumn(s string) (column, error) {
+	var col column
+
+	fs := strings.Split(s, ":")
+	if len(fs) > 2 {
+		return col, fmt.Errorf("Error parsing column %q: expecting \"width\" or \"width:tag\"", s)
+	}
+
+	width, err := strconv.Atoi(fs[0])
+	if err != nil || width < 0 {
+		return col, fmt.Errorf("Error parsing column %q: invalid width", s)
+	}
+	col.width = width
+
+	if len(fs) == 2 {
+		if col.tag = name2TagType(fs[1]); col.tag == TagUnknown {
+			return col, fmt.Errorf("Error parsing column %q: unknown tag", s)
+		}
+	}
+
+	return col, nil
+}
+
 func predefineAnalyzerTags(f string, t TagType) {
 	switch f {
 	case "msgid":
@@ -217,6 +451,26 @@ func predefineAnalyzerTags(f string, t TagType) {
 		TagPktsSent = t
 	case "duration":
 		TagDuration = t
+	case "msgrest":
+		TagMsgRest = t
+	case "flowid":
+		TagFlowID = t
+	case "category":
+		TagCategory = t
+	case "queueid":
+		TagQueueID = t
+	case "domain":
+		TagDomain = t
+	case "qtype":
+		TagQType = t
+	case "rcode":
+		TagRCode = t
+	case "traceid":
+		TagTraceID = t
+	case "spanid":
+		TagSpanID = t
+	case "eventid":
+		TagEventID = t
 	}
 }
 
@@ -272,4 +526,14 @@ var (
 	TagPktsRecv   TagType // The number of packets received
 	TagPktsSent   TagType // The number of packets sent
 	TagDuration   TagType // The duration of the session
+	TagMsgRest    TagType // The rest of the log message not matched by a prefix pattern
+	TagFlowID     TagType // The session or flow ID assigned to related log messages
+	TagCategory   TagType // The category of the event, e.g., Logon or Process Creation
+	TagQueueID    TagType // The mail queue ID, e.g., of postfix or sendmail, shared by the messages of a mail transaction
+	TagDomain     TagType // The DNS domain name queried
+	TagQType      TagType // The DNS query type, e.g., A, AAAA or MX
+	TagRCode      TagType // The DNS response code, e.g., NOERROR or NXDOMAIN
+	TagTraceID    TagType // The distributed trace ID, e.g., of a W3C traceparent
+	TagSpanID     TagType // The distributed trace span ID, e.g., of a W3C traceparent
+	TagEventID    TagType // The stable hash of a parsed message, so downstream stores can deduplicate replays
 )
@@ -15,6 +15,8 @@
 package sequence
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -24,3 +26,71 @@ func TestSequenceConfig(t *testing.T) {
 	err := ReadConfig("sequence.toml")
 	require.NoError(t, err)
 }
+
+func TestSequenceConfigSources(t *testing.T) {
+	data, err := ioutil.ReadFile("sequence.toml")
+	require.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "sequence")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(string(data) + `
+[sources.nginx]
+paths = ["/var/log/nginx/*.log"]
+format = "kv"
+timeFormats = ["_2/Jan/2006:15:04:05 -0700"]
+
+[sources.nginx.fields]
+srcip = "client_ip"
+
+[sources.auth]
+paths = ["auth.log*"]
+patterns = "patterns/sshd.txt"
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, ReadConfig(f.Name()))
+	defer ReadConfig("sequence.toml")
+
+	require.Equal(t, 2, len(Sources()))
+	require.Equal(t, "auth", Sources()[0].Name)
+
+	src, ok := LookupSource("nginx")
+	require.True(t, ok)
+	require.Equal(t, "kv", src.Format)
+	require.Equal(t, "client_ip", src.FieldName(TagSrcIP))
+	require.Equal(t, "dstip", src.FieldName(TagDstIP))
+
+	_, ok = LookupSource("apache")
+	require.False(t, ok)
+
+	src, ok = MatchSource("/var/log/nginx/access.log")
+	require.True(t, ok)
+	require.Equal(t, "nginx", src.Name)
+
+	src, ok = MatchSource("/data/auth.log.1")
+	require.True(t, ok)
+	require.Equal(t, "auth", src.Name)
+
+	_, ok = MatchSource("/var/log/syslog")
+	require.False(t, ok)
+
+	src, _ = LookupSource("nginx")
+	src.Apply()
+	require.Equal(t, []string{"_2/Jan/2006:15:04:05 -0700"}, config.timeFormats)
+
+	f, err = ioutil.TempFile("", "sequence")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(string(data) + `
+[sources.nginx.fields]
+clientip = "client_ip"
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.Error(t, ReadConfig(f.Name()))
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import "sort"
+
+// Corpus extracts a minimized, deduplicated set of messages from a large body of
+// messages, keeping exactly one example for each structurally distinct pattern.
+// The example kept is the shortest message seen for the pattern. This is useful
+// for building regression corpora and fuzzing seeds.
+//
+// Like the Analyzer, the Corpus requires two passes over the messages. In the
+// first pass, each message sequence is added using Add(). After Finalize() is
+// called, the second pass calls Collect() for each message to record examples.
+// If a Parser is supplied, messages that match an existing pattern are grouped
+// by that pattern instead of the analyzed one.
+type Corpus struct {
+	parser   *Parser
+	analyzer *Analyzer
+	entries  map[string]*CorpusEntry
+}
+
+// CorpusEntry is a single example message and the pattern it represents.
+type CorpusEntry struct {
+	Pattern string // Pattern is the pattern that matches the example.
+	Example string // Example is the shortest message that matched the pattern.
+	Count   int    // Count is the number of messages that matched the pattern.
+}
+
+func NewCorpus(parser *Parser) *Corpus {
+	return &Corpus{
+		parser:   parser,
+		analyzer: NewAnalyzer(),
+		entries:  make(map[string]*CorpusEntry),
+	}
+}
+
+// Add adds a single message sequence to the corpus analyzer. Sequences that match
+// one of the parser patterns are not added.
+func (this *Corpus) Add(seq Sequence) error {
+	if this.parser != nil {
+		if _, err := this.parser.Parse(seq); err == nil {
+			return nil
+		}
+	}
+
+	return this.analyzer.Add(seq)
+}
+
+// Finalize finalizes the corpus analyzer. It must be called after all the message
+// sequences are added, and before any of them are collected.
+func (this *Corpus) Finalize() error {
+	return this.analyzer.Finalize()
+}
+
+// Collect determines the pattern for the message sequence, and keeps the message
+// as the example for the pattern if it's the shortest one seen so far.
+func (this *Corpus) Collect(msg string, seq Sequence) error {
+	var (
+		pseq Sequence
+		err  error
+	)
+
+	if this.parser != nil {
+		pseq, err = this.parser.Parse(seq)
+	}
+
+	if this.parser == nil || err != nil {
+		if pseq, err = this.analyzer.Analyze(seq); err != nil {
+			return err
+		}
+	}
+
+	pat := pseq.String()
+
+	if e, ok := this.entries[pat]; ok {
+		e.Count++
+		if len(msg) < len(e.Example) {
+			e.Example = msg
+		}
+	} else {
+		this.entries[pat] = &CorpusEntry{Pattern: pat, Example: msg, Count: 1}
+	}
+
+	return nil
+}
+
+// Entries returns the collected examples, sorted by pattern.
+func (this *Corpus) Entries() []CorpusEntry {
+	entries := make([]CorpusEntry, 0, len(this.entries))
+
+	for _, e := range this.entries {
+		entries = append(entries, *e)
+	}
+
+	sort.Sort(corpusEntries(entries))
+
+	return entries
+}
+
+type corpusEntries []CorpusEntry
+
+func (this corpusEntries) Len() int           { return len(this) }
+func (this corpusEntries) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this corpusEntries) Less(i, j int) bool { return this[i].Pattern < this[j].Pattern }
@@ -0,0 +1,64 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	corpustests = []string{
+		"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+		"Jan 12 06:49:42 irc sshd[7034]: Accepted password for root from 218.161.81.238 port 4228 ssh2",
+		"Jan 12 14:44:48 jlz sshd[11084]: Accepted publickey for jlz from 76.21.0.16 port 36609 ssh2",
+		"Jan 12 08:03:01 buster-dev sshd[24877]: pam_unix(sshd:session): session opened for user jolata by (uid=0)",
+		"Jan 12 08:03:01 buster-dev sshd[24877]: pam_unix(sshd:session): session opened for user jo by (uid=0)",
+	}
+)
+
+func TestCorpusEntries(t *testing.T) {
+	corpus := NewCorpus(nil)
+	scanner := NewScanner()
+
+	for _, msg := range corpustests {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+		require.NoError(t, corpus.Add(seq), msg)
+	}
+
+	require.NoError(t, corpus.Finalize())
+
+	for _, msg := range corpustests {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+		require.NoError(t, corpus.Collect(msg, seq), msg)
+	}
+
+	entries := corpus.Entries()
+	require.Equal(t, 2, len(entries))
+
+	for _, e := range entries {
+		switch e.Count {
+		case 2:
+			require.Equal(t, corpustests[4], e.Example)
+		case 3:
+			require.Equal(t, corpustests[0], e.Example)
+		default:
+			require.FailNow(t, "unexpected count for "+e.Pattern)
+		}
+	}
+}
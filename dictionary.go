@@ -0,0 +1,206 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ValueDictionary learns the values of chosen fields in the messages of each
+// pattern, along with their counts, so fields that only take a few values, e.g.,
+// an action that's either ACCEPT, DENY or DROP, can be turned into enumerations
+// and promoted into the patterns or used to validate the messages. Fields with
+// more values than the maximum are not enumerations, and their values are dropped.
+// It's safe to use concurrently.
+type ValueDictionary struct {
+	mu sync.Mutex
+
+	// fields are the names of the fields learned, or the token types of the untagged
+	// tokens learned, e.g., "string", and max is the maximum number of values of an
+	// enumeration
+	fields map[string]bool
+	max    int
+
+	// patterns are the values of the fields of each pattern, by token position
+	patterns map[string]map[int]*fieldValues
+}
+
+type fieldValues struct {
+	field  string
+	tagged bool
+	counts map[string]int
+
+	// overflow is true once the field has more than the maximum number of values
+	overflow bool
+}
+
+// Enumeration is a field of a pattern that only took a few values, sorted by the
+// number of messages each value was seen in, most first.
+type Enumeration struct {
+	Field    string   // Field is the name of the field, or the token type of an untagged token.
+	Tagged   bool     // Tagged is true if the token has a field name.
+	Position int      // Position is the position of the token in the pattern, starting at 0.
+	Values   []string // Values are the values of the field.
+	Counts   []int    // Counts are the number of messages each value was seen in.
+}
+
+// String returns the enumeration as, e.g., "action ∈ {ACCEPT (120), DENY (30)}".
+func (this Enumeration) String() string {
+	var buf bytes.Buffer
+
+	if this.Tagged {
+		buf.WriteString(this.Field)
+	} else {
+		fmt.Fprintf(&buf, "%s at token %d", this.Field, this.Position)
+	}
+
+	buf.WriteString(" ∈ {")
+
+	for i, v := range this.Values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s (%d)", v, this.Counts[i])
+	}
+
+	buf.WriteString("}")
+
+	return buf.String()
+}
+
+// NewValueDictionary returns a ValueDictionary that learns the values of the
+// fields, e.g., "action", or of the untagged tokens of the token types, e.g.,
+// "string", with at most max values each.
+func NewValueDictionary(max int, fields ...string) *ValueDictionary {
+	this := &ValueDictionary{
+		fields:   make(map[string]bool, len(fields)),
+		max:      max,
+		patterns: make(map[string]map[int]*fieldValues),
+	}
+
+	for _, f := range fields {
+		this.fields[f] = true
+	}
+
+	return this
+}
+
+// Add learns the values of the fields of the sequence, which is a message parsed
+// or analyzed into the tokens of its pattern, e.g., by Parser.Parse or
+// Analyzer.Analyze.
+func (this *ValueDictionary) Add(seq Sequence) {
+	pattern := seq.String()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	positions := this.patterns[pattern]
+
+	for i, tok := range seq {
+		field, tagged := tok.Tag.String(), true
+		if tok.Tag == TagUnknown {
+			if tok.Type == TokenLiteral {
+				continue
+			}
+
+			field, tagged = tok.Type.String(), false
+		}
+
+		if !this.fields[field] {
+			continue
+		}
+
+		if positions == nil {
+			positions = make(map[int]*fieldValues)
+			this.patterns[pattern] = positions
+		}
+
+		fv, ok := positions[i]
+		if !ok {
+			fv = &fieldValues{field: field, tagged: tagged, counts: make(map[string]int)}
+			positions[i] = fv
+		}
+
+		if fv.overflow {
+			continue
+		}
+
+		if fv.counts[tok.Value]++; len(fv.counts) > this.max {
+			fv.overflow = true
+			fv.counts = nil
+		}
+	}
+}
+
+// Enumerations returns the fields of the pattern that took at most the maximum
+// number of values, in the order of the tokens.
+func (this *ValueDictionary) Enumerations(pattern string) []Enumeration {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	positions := this.patterns[pattern]
+
+	var enums []Enumeration
+
+	for i, fv := range positions {
+		if fv.overflow {
+			continue
+		}
+
+		enum := Enumeration{Field: fv.field, Tagged: fv.tagged, Position: i}
+
+		values := make(valueCounts, 0, len(fv.counts))
+		for v, n := range fv.counts {
+			values = append(values, valueCount{v, n})
+		}
+		sort.Sort(values)
+
+		for _, vc := range values {
+			enum.Values = append(enum.Values, vc.value)
+			enum.Counts = append(enum.Counts, vc.count)
+		}
+
+		enums = append(enums, enum)
+	}
+
+	sort.Sort(enumerations(enums))
+
+	return enums
+}
+
+type valueCount struct {
+	value string
+	count int
+}
+
+type valueCounts []valueCount
+
+func (this valueCounts) Len() int      { return len(this) }
+func (this valueCounts) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this valueCounts) Less(i, j int) bool {
+	if this[i].count != this[j].count {
+		return this[i].count > this[j].count
+	}
+	return this[i].value < this[j].value
+}
+
+type enumerations []Enumeration
+
+func (this enumerations) Len() int           { return len(this) }
+func (this enumerations) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this enumerations) Less(i, j int) bool { return this[i].Position < this[j].Position }
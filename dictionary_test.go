@@ -0,0 +1,65 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueDictionaryEnumerations(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pat := Pattern{Text: "%msgtime% %apphost% %appname% : %action% %string% from %srcip%"}
+	require.NoError(t, parser.AddPattern(pat))
+
+	dict := NewValueDictionary(2, "action", "string", "srcip")
+
+	for _, msg := range []string{
+		"Jan 12 06:49:42 irc fw: ACCEPT tcp from 10.0.0.1",
+		"Jan 12 06:49:43 irc fw: DENY udp from 10.0.0.2",
+		"Jan 12 06:49:44 irc fw: ACCEPT tcp from 10.0.0.3",
+		"Jan 12 06:49:45 irc fw: ACCEPT udp from 10.0.0.4",
+	} {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, msg)
+
+		dict.Add(seq)
+	}
+
+	enums := dict.Enumerations(pat.Text)
+
+	// srcip took more values than the maximum, so it's not an enumeration
+	require.Equal(t, 2, len(enums))
+
+	require.Equal(t, "action", enums[0].Field)
+	require.True(t, enums[0].Tagged)
+	require.Equal(t, []string{"accept", "deny"}, enums[0].Values)
+	require.Equal(t, []int{3, 1}, enums[0].Counts)
+	require.Equal(t, "action ∈ {accept (3), deny (1)}", enums[0].String())
+
+	require.Equal(t, "string", enums[1].Field)
+	require.False(t, enums[1].Tagged)
+	require.Equal(t, enums[0].Position+1, enums[1].Position)
+	require.Equal(t, []string{"tcp", "udp"}, enums[1].Values)
+	require.Equal(t, []int{2, 2}, enums[1].Counts)
+
+	require.Equal(t, 0, len(dict.Enumerations("%msgtime% %apphost%")))
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Divergence is the first point where two sequences, or a pattern and a message
+// sequence, differ. It's useful for explaining why a message didn't match.
+type Divergence struct {
+	Index int   // Index is the position of the token that differs in the message sequence.
+	Want  Token // Want is the token expected, or the zero Token if there are extra tokens.
+	Got   Token // Got is the token found, or the zero Token if there are missing tokens.
+}
+
+// String returns a description of the divergence, e.g., `token 9: expected
+// literal "from", got literal "to"`.
+func (this Divergence) String() string {
+	switch {
+	case this.Want == Token{}:
+		return fmt.Sprintf("token %d: expected end of message, got %s", this.Index, describeToken(this.Got))
+	case this.Got == Token{}:
+		return fmt.Sprintf("token %d: expected %s, got end of message", this.Index, describeToken(this.Want))
+	}
+
+	return fmt.Sprintf("token %d: expected %s, got %s", this.Index, describeToken(this.Want), describeToken(this.Got))
+}
+
+// describeToken returns the token as "%tag%" or "%type%" for pattern tokens, and
+// as "type value" or "%tag% type value" for message tokens.
+func describeToken(tok Token) string {
+	if vl := len(tok.Value); vl == 0 || (vl >= 2 && tok.Value[0] == '%' && tok.Value[vl-1] == '%') {
+		if tok.Tag != TagUnknown {
+			return fmt.Sprintf("%%%s%%", tok.Tag)
+		}
+		return fmt.Sprintf("%%%s%%", tok.Type)
+	}
+
+	if tok.Tag != TagUnknown {
+		return fmt.Sprintf("%%%s%% %s %q", tok.Tag, tok.Type, tok.Value)
+	}
+
+	return fmt.Sprintf("%s %q", tok.Type, tok.Value)
+}
+
+// Diff compares two sequences token by token, and returns the first point where
+// they differ. Tokens are the same if they have the same type, tag and value. It
+// returns false if the sequences are the same.
+func Diff(want, got Sequence) (Divergence, bool) {
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return Divergence{Index: i, Want: publicToken(want[i])}, true
+		case i >= len(want):
+			return Divergence{Index: i, Got: publicToken(got[i])}, true
+		case want[i].Type != got[i].Type || want[i].Tag != got[i].Tag || want[i].Value != got[i].Value:
+			return Divergence{Index: i, Want: publicToken(want[i]), Got: publicToken(got[i])}, true
+		}
+	}
+
+	return Divergence{}, false
+}
+
+// DiffPattern compares the pattern, e.g., "%msgtime% %apphost% sshd ...", with the
+// message sequence, using the same rules as the Parser, and returns the first point
+// where the message stops matching the pattern. It returns false if the message
+// matches the pattern, and an error if the pattern is invalid.
+func DiffPattern(pattern string, seq Sequence) (Divergence, bool, error) {
+	pat, err := compilePattern(pattern)
+	if err != nil {
+		return Divergence{}, false, err
+	}
+
+	d, diverged := diffPattern(pat, seq)
+	return d, diverged, nil
+}
+
+// compilePattern scans the pattern and resolves its tag tokens, the same way the
+// Parser does when the pattern is added.
+func compilePattern(pattern string) (Sequence, error) {
+	pseq, err := NewScanner().Scan(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	pat := make(Sequence, len(pseq))
+
+	for i, tok := range pseq {
+		if vl := len(tok.Value); vl >= 2 && tok.Value[0] == '%' && tok.Value[vl-1] == '%' {
+			if tok, err = processTagToken(tok); err != nil {
+				return nil, err
+			}
+		} else if tok.Type == TokenHost {
+			// A host name in the pattern is a literal, only %host% matches any host
+			tok.Type = TokenLiteral
+		}
+
+		pat[i] = tok
+	}
+
+	return pat, nil
+}
+
+func diffPattern(pat, seq Sequence) (Divergence, bool) {
+	j := 0
+
+	for i, pt := range pat {
+		switch {
+		case pt.until != "":
+			// Consume the tokens up to the literal
+			for ; j < len(seq) && !strings.EqualFold(seq[j].Value, pt.until); j++ {
+			}
+
+			if j == len(seq) && i < len(pat)-1 {
+				return Divergence{Index: j, Want: Token{Type: TokenLiteral, Value: pt.until}}, true
+			}
+
+		case pt.plus || pt.star:
+			n := 0
+
+			// Consume the matching tokens, but stop at the first one that the next
+			// pattern token matches
+			for ; j < len(seq) && matchToken(pt, seq[j]); j, n = j+1, n+1 {
+				if (n > 0 || pt.star) && i < len(pat)-1 && matchToken(pat[i+1], seq[j]) {
+					break
+				}
+			}
+
+			if pt.plus && n == 0 {
+				return divergenceAt(j, pt, seq), true
+			}
+
+		default:
+			if j >= len(seq) || !matchToken(pt, seq[j]) {
+				return divergenceAt(j, pt, seq), true
+			}
+			j++
+
+			if pt.minus {
+				// The rest of the message is consumed
+				j = len(seq)
+			}
+		}
+	}
+
+	if j < len(seq) {
+		return Divergence{Index: j, Got: publicToken(seq[j])}, true
+	}
+
+	return Divergence{}, false
+}
+
+// similarity returns how similar the message sequence is to the pattern, from 0
+// to 1, based on the number of tokens that have to be inserted, removed or changed
+// to turn one into the other. Tokens are the same if they match per matchToken.
+func similarity(pat, seq Sequence) float64 {
+	n := len(pat)
+	if len(seq) > n {
+		n = len(seq)
+	}
+
+	if n == 0 {
+		return 1
+	}
+
+	// Edit distance, keeping only the previous row of the table
+	prev := make([]int, len(seq)+1)
+	cur := make([]int, len(seq)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(pat); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(seq); j++ {
+			cost := 1
+			if matchToken(pat[i-1], seq[j-1]) {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return 1 - float64(prev[len(seq)])/float64(n)
+}
+
+func minInt(a int, b ...int) int {
+	for _, v := range b {
+		if v < a {
+			a = v
+		}
+	}
+
+	return a
+}
+
+// matchToken returns true if the message token mt matches the pattern token pt,
+// following the Parser rules: literals match the same literal, strings match any
+// literal or host name, and other types match tokens of the same type.
+func matchToken(pt, mt Token) bool {
+	switch {
+	case pt.Type == TokenLiteral:
+		return (mt.Type == TokenLiteral || mt.Type == TokenHost) && strings.EqualFold(pt.Value, mt.Value)
+	case pt.Type == TokenString:
+		return mt.Type == TokenLiteral || mt.Type == TokenHost || mt.Type == TokenString
+	}
+
+	return pt.Type == mt.Type
+}
+
+func divergenceAt(j int, pt Token, seq Sequence) Divergence {
+	d := Divergence{Index: j, Want: publicToken(pt)}
+
+	if j < len(seq) {
+		d.Got = publicToken(seq[j])
+	}
+
+	return d
+}
+
+// publicToken returns the token with only the exported fields, so divergences can
+// be compared by callers.
+func publicToken(tok Token) Token {
+	return Token{Type: tok.Type, Tag: tok.Tag, Value: tok.Value}
+}
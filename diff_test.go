@@ -0,0 +1,117 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	difftests = []struct {
+		pattern string
+		msg     string
+		index   int
+		want    string
+	}{
+		{
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2",
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+			-1, "",
+		},
+		{
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2",
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root to 218.161.81.238 port 4228 ssh2",
+			11, `token 11: expected literal "from", got literal "to"`,
+		},
+		{
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2",
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from host.example.com port 4228 ssh2",
+			12, `token 12: expected %srcip%, got host "host.example.com"`,
+		},
+		{
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser%",
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238",
+			11, `token 11: expected end of message, got literal "from"`,
+		},
+		{
+			"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip%",
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root",
+			11, `token 11: expected literal "from", got end of message`,
+		},
+		{
+			"%msgtime% %apphost% %appname% : %string:+% from %srcip%",
+			"Jan 12 06:49:42 irc app: user root logged in from 10.1.1.1",
+			-1, "",
+		},
+		{
+			"%msgtime% %apphost% %appname% : %string:+% from %srcip%",
+			"Jan 12 06:49:42 irc app: from 10.1.1.1",
+			5, `token 5: expected literal "from", got ipv4 "10.1.1.1"`,
+		},
+		{
+			"%msgtime% %apphost% %appname% : %string:-%",
+			"Jan 12 06:49:42 irc app: user root logged in from 10.1.1.1",
+			-1, "",
+		},
+	}
+)
+
+func TestDiffPattern(t *testing.T) {
+	scanner := NewScanner()
+
+	for _, tc := range difftests {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+
+		d, diverged, err := DiffPattern(tc.pattern, seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.index != -1, diverged, tc.msg+"\n"+d.String())
+
+		if diverged {
+			require.Equal(t, tc.index, d.Index, tc.msg)
+			require.Equal(t, tc.want, d.String(), tc.msg)
+		}
+	}
+
+	_, _, err := DiffPattern("%nosuchtag% foo", nil)
+	require.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	scanner := NewScanner()
+
+	seq, err := scanner.Scan("Jan 12 06:49:42 irc sshd[7034]: Failed password for root")
+	require.NoError(t, err)
+	want := append(Sequence(nil), seq...)
+
+	_, diverged := Diff(want, want)
+	require.False(t, diverged)
+
+	seq, err = scanner.Scan("Jan 12 06:49:42 irc sshd[7034]: Failed password for 42")
+	require.NoError(t, err)
+
+	d, diverged := Diff(want, seq)
+	require.True(t, diverged)
+	require.Equal(t, 10, d.Index)
+	require.Equal(t, Token{Type: TokenLiteral, Value: "root"}, d.Want)
+	require.Equal(t, Token{Type: TokenInteger, Value: "42"}, d.Got)
+
+	d, diverged = Diff(want, want[:9])
+	require.True(t, diverged)
+	require.Equal(t, 9, d.Index)
+	require.Equal(t, Token{}, d.Got)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// EventHasher assigns a stable event ID to parsed log messages, which is the hash
+// of the text of the pattern the message matched, its normalized timestamp, and
+// the values of the key tags, e.g., apphost and sessionid. The same message always
+// gets the same ID, so downstream stores can deduplicate the messages that are
+// parsed again when a pipeline is restarted. If no key tags are given, the values
+// of all the tokens are used.
+//
+// The pattern text is used rather than its file and line, so the IDs don't change
+// when patterns are moved around. Session IDs assigned by a Sessionizer are not
+// stable across runs, so messages should be hashed before they are sessionized.
+type EventHasher struct {
+	keys []TagType
+}
+
+// NewEventHasher returns an EventHasher that hashes the values of the key fields,
+// e.g., "apphost" and "sessionid", or of all the tokens if there are none.
+func NewEventHasher(keys ...string) (*EventHasher, error) {
+	tags := make([]TagType, len(keys))
+
+	for i, key := range keys {
+		if tags[i] = name2TagType(key); tags[i] == TagUnknown {
+			return nil, fmt.Errorf("Invalid event ID key %q: unknown field", key)
+		}
+	}
+
+	return &EventHasher{keys: tags}, nil
+}
+
+// EventID returns the event ID of the parsed message sequence and the pattern it
+// matched, which can be nil, along with the sequence with the ID appended as an
+// eventid token.
+func (this *EventHasher) EventID(seq Sequence, pat *Pattern) (Sequence, string) {
+	h := sha256.New()
+
+	if pat != nil {
+		fmt.Fprintf(h, "%s\x00", pat.Text)
+	}
+
+	for _, tok := range seq {
+		if tok.Tag == TagMsgTime || (tok.Tag == TagUnknown && tok.Type == TokenTime) {
+			fmt.Fprintf(h, "%s\x00", normalizeTime(tok.Value))
+			break
+		}
+	}
+
+	if len(this.keys) == 0 {
+		for _, tok := range seq {
+			fmt.Fprintf(h, "%s=%s\x00", tok.Tag, tok.Value)
+		}
+	} else {
+		for _, tag := range this.keys {
+			for _, tok := range seq {
+				if tok.Tag == tag {
+					fmt.Fprintf(h, "%s=%s\x00", tok.Tag, tok.Value)
+					break
+				}
+			}
+		}
+	}
+
+	id := hex.EncodeToString(h.Sum(nil)[:16])
+
+	return append(seq, Token{Type: TokenString, Tag: TagEventID, Value: id}), id
+}
+
+// normalizeTime returns the time in UTC in the RFC 3339 format, so the same time
+// written in different formats or time zones has the same value, or the value as
+// is if it's not a time.
+func normalizeTime(value string) string {
+	t, err := ParseTime(value)
+	if err != nil {
+		return value
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
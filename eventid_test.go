@@ -0,0 +1,83 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHasherEventID(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pats := []Pattern{
+		{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser%"},
+		{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : accepted publickey for %dstuser%"},
+	}
+
+	for i := range pats {
+		require.NoError(t, parser.AddPattern(pats[i]))
+	}
+
+	_, err := NewEventHasher("apphost", "pid")
+	require.Error(t, err)
+
+	all, err := NewEventHasher()
+	require.NoError(t, err)
+
+	keys, err := NewEventHasher("apphost", "sessionid")
+	require.NoError(t, err)
+
+	ids := func(h *EventHasher, msg string) string {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+
+		seq, pat, err := parser.Match(seq)
+		require.NoError(t, err, msg)
+
+		n := len(seq)
+
+		seq, id := h.EventID(seq, pat)
+		require.Equal(t, 32, len(id), msg)
+		require.Equal(t, n+1, len(seq), msg)
+		require.Equal(t, TagEventID, seq[n].Tag, msg)
+		require.Equal(t, id, seq[n].Value, msg)
+
+		return id
+	}
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: accepted password for root"
+
+	// The same message always has the same ID
+	require.Equal(t, ids(all, msg), ids(all, msg))
+	require.Equal(t, ids(keys, msg), ids(keys, msg))
+
+	// Any change to the values changes the ID with all the tokens, but only changes
+	// to the key values change the ID with keys
+	other := "Jan 12 06:49:42 irc sshd[7034]: accepted password for admin"
+	require.NotEqual(t, ids(all, msg), ids(all, other))
+	require.Equal(t, ids(keys, msg), ids(keys, other))
+
+	for _, other := range []string{
+		"Jan 12 06:49:43 irc sshd[7034]: accepted password for root",
+		"Jan 12 06:49:42 jlz sshd[7034]: accepted password for root",
+		"Jan 12 06:49:42 irc sshd[7035]: accepted password for root",
+		"Jan 12 06:49:42 irc sshd[7034]: accepted publickey for root",
+	} {
+		require.NotEqual(t, ids(keys, msg), ids(keys, other), other)
+	}
+}
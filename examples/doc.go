@@ -0,0 +1,20 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package examples has runnable examples of using the sequence package outside of
+// the sequence command, such as embedding a parser in an HTTP service, parsing a
+// stream of messages with a ParallelParser, and building patterns using an
+// Analyzer. The examples are run by go test, so they keep compiling and working
+// as the package changes.
+package examples
@@ -0,0 +1,217 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package examples_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+
+	"github.com/trustpath/sequence"
+)
+
+var messages = []string{
+	"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+	"Jan 12 06:49:42 irc sshd[7034]: Accepted password for root from 218.161.81.238 port 4228 ssh2",
+	"Jan 12 14:44:48 jlz sshd[11084]: Accepted publickey for jlz from 76.21.0.16 port 36609 ssh2",
+}
+
+const sshPattern = "%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2"
+
+func init() {
+	// The tags, e.g., srcuser, are defined in the config file
+	if err := sequence.ReadConfig("../sequence.toml"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseHandler returns an HTTP handler that parses each line of the request body,
+// and writes each parsed message as a json object of its fields. The parser is
+// safe to share between requests, but the scanner is not, so each request gets
+// its own.
+func parseHandler(parser *sequence.Parser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scanner := sequence.NewScanner()
+		enc := json.NewEncoder(w)
+
+		lines := bufio.NewScanner(r.Body)
+		for lines.Scan() {
+			seq, err := scanner.Scan(lines.Text())
+			if err == nil {
+				seq, err = parser.Parse(seq)
+			}
+
+			fields := make(map[string]string)
+
+			if err != nil {
+				fields["error"] = err.Error()
+			}
+
+			for _, tok := range seq {
+				if tok.Tag != sequence.TagUnknown {
+					fields[tok.Tag.String()] = tok.Value
+				}
+			}
+
+			enc.Encode(fields)
+		}
+	}
+}
+
+// Embed a parser in an HTTP service that parses the messages posted to it.
+func Example_httpService() {
+	parser := sequence.NewParser()
+
+	if err := parser.AddPattern(sequence.Pattern{Text: sshPattern}); err != nil {
+		log.Fatal(err)
+	}
+
+	// In a service, the handler is registered with http.Handle("/parse", ...)
+	handler := parseHandler(parser)
+
+	req := httptest.NewRequest("POST", "/parse", strings.NewReader(messages[0]+"\nnot a known message\n"))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	fmt.Print(rec.Body.String())
+	// Output:
+	// {"apphost":"irc","appname":"sshd","method":"password","msgtime":"Jan 12 06:49:42","sessionid":"7034","srcip":"218.161.81.238","srcport":"4228","srcuser":"root","status":"failed"}
+	// {"error":"sequence: no pattern matched for this message"}
+}
+
+// Parse a stream of messages using all the cores, with the results in order. The
+// messages are read from a reader here, but they can come from anywhere, e.g., a
+// loop over the messages of a Kafka consumer calling Add for each.
+func Example_stream() {
+	parser := sequence.NewParser()
+
+	if err := parser.AddPattern(sequence.Pattern{Text: sshPattern}); err != nil {
+		log.Fatal(err)
+	}
+
+	pp := sequence.NewParallelParser(parser, runtime.NumCPU(), 100)
+
+	go func() {
+		lines := bufio.NewScanner(strings.NewReader(strings.Join(messages, "\n")))
+		for lines.Scan() {
+			pp.Add(lines.Text())
+		}
+		pp.Close()
+	}()
+
+	for res := range pp.Results() {
+		if res.Err != nil {
+			fmt.Println(res.Err)
+			continue
+		}
+
+		var fields []string
+
+		for _, tok := range res.Sequence {
+			if tok.Tag == sequence.TagSrcUser || tok.Tag == sequence.TagMethod {
+				fields = append(fields, fmt.Sprintf("%s=%s", tok.Tag, tok.Value))
+			}
+		}
+
+		fmt.Println(strings.Join(fields, " "))
+	}
+	// Output:
+	// method=password srcuser=root
+	// method=password srcuser=root
+	// method=publickey srcuser=jlz
+}
+
+// Build the patterns of a set of messages using an Analyzer, and add them to a
+// parser directly, along with a pattern written by hand, without going through
+// pattern files.
+func Example_buildPatterns() {
+	scanner := sequence.NewScanner()
+	analyzer := sequence.NewAnalyzer()
+
+	// The analyzer first learns the structure of all the messages...
+	for _, msg := range messages {
+		seq, err := scanner.Scan(msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := analyzer.Add(seq); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := analyzer.Finalize(); err != nil {
+		log.Fatal(err)
+	}
+
+	// ...and then returns the pattern of each
+	for _, msg := range messages {
+		seq, err := scanner.Scan(msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := analyzer.Analyze(seq); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	pats := analyzer.Patterns()
+	fmt.Printf("found %d pattern\n", len(pats))
+
+	parser := sequence.NewParser()
+
+	pats = append(pats, sequence.Pattern{
+		Text:   "%msgtime% %apphost% %appname% [ %sessionid% ] : session %action% for user %srcuser%",
+		Origin: sequence.OriginHuman,
+		Owner:  "security",
+	})
+
+	for _, pat := range pats {
+		if err := parser.AddPattern(pat); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, msg := range []string{
+		"Jan 12 08:03:01 irc sshd[24877]: session opened for user jolata",
+		"Jan 12 08:03:02 irc sshd[24878]: Accepted password for admin from 10.0.0.1 port 22 ssh2",
+	} {
+		seq, err := scanner.Scan(msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		seq, pat, err := parser.Match(seq)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, tok := range seq {
+			if tok.Tag == sequence.TagSrcUser {
+				fmt.Printf("%s pattern matched srcuser=%s\n", pat.Origin, tok.Value)
+			}
+		}
+	}
+	// Output:
+	// found 1 pattern
+	// human pattern matched srcuser=jolata
+	// analyzer pattern matched srcuser=admin
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// GzipReader decompresses gzip files made of multiple members, such as the files
+// written by loggers that compress each rotation and append it to the same file,
+// or archives concatenated using cat. Unlike reading them with gzip.Reader, the
+// NUL padding some tools write between the members is skipped, and an error in a
+// member, e.g., a truncated last member, is returned along with the member number
+// and its offset in the file, after the data decompressed up to the error.
+type GzipReader struct {
+	in *ProgressReader
+	r  *bufio.Reader
+	z  *gzip.Reader
+
+	// members is the number of members read so far, start is the offset of the
+	// current member in the compressed input
+	members int
+	start   int64
+	err     error
+}
+
+// NewGzipReader returns a GzipReader that decompresses r. It returns an error if
+// r doesn't start with a gzip member.
+func NewGzipReader(r io.Reader) (*GzipReader, error) {
+	this := &GzipReader{in: NewProgressReader(r, nil)}
+	this.r = bufio.NewReader(this.in)
+
+	if err := this.next(); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// Read reads the decompressed data of the members.
+func (this *GzipReader) Read(p []byte) (int, error) {
+	for this.err == nil {
+		n, err := this.z.Read(p)
+
+		if err == io.EOF {
+			this.err = this.skipPadding()
+			if this.err == nil {
+				this.err = this.next()
+			}
+		} else if err != nil {
+			this.err = fmt.Errorf("Invalid gzip member %d at offset %d: %v", this.members, this.start, err)
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	return 0, this.err
+}
+
+// Members returns the number of gzip members read so far.
+func (this *GzipReader) Members() int {
+	return this.members
+}
+
+// Close closes the decompressor of the current member, but not the underlying reader.
+func (this *GzipReader) Close() error {
+	return this.z.Close()
+}
+
+// next starts reading the next member.
+func (this *GzipReader) next() error {
+	this.start = this.in.Bytes() - int64(this.r.Buffered())
+
+	var err error
+
+	if this.z == nil {
+		this.z, err = gzip.NewReader(this.r)
+	} else {
+		err = this.z.Reset(this.r)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Invalid gzip member %d at offset %d: %v", this.members+1, this.start, err)
+	}
+
+	this.z.Multistream(false)
+	this.members++
+
+	return nil
+}
+
+// skipPadding skips the NUL bytes after a member, and returns io.EOF if there are
+// no more members.
+func (this *GzipReader) skipPadding() error {
+	for {
+		b, err := this.r.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		if b[0] != 0 {
+			return nil
+		}
+
+		this.r.Discard(1)
+	}
+}
+
+// ProgressReader counts the bytes read from a reader, and calls a function with
+// the number of bytes read so far after each read, e.g., to report the progress of
+// reading a large file.
+type ProgressReader struct {
+	r  io.Reader
+	n  int64
+	fn func(int64)
+}
+
+// NewProgressReader returns a ProgressReader that reads from r and calls fn, which
+// can be nil, after each read.
+func NewProgressReader(r io.Reader, fn func(read int64)) *ProgressReader {
+	return &ProgressReader{r: r, fn: fn}
+}
+
+func (this *ProgressReader) Read(p []byte) (int, error) {
+	n, err := this.r.Read(p)
+	this.n += int64(n)
+
+	if this.fn != nil && n > 0 {
+		this.fn(this.n)
+	}
+
+	return n, err
+}
+
+// Bytes returns the number of bytes read so far.
+func (this *ProgressReader) Bytes() int64 {
+	return this.n
+}
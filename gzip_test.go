@@ -0,0 +1,81 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gzipMember(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func TestGzipReader(t *testing.T) {
+	first := gzipMember(t, "line 1\nline 2\n")
+	second := gzipMember(t, "line 3\n")
+
+	// Members concatenated, with NUL padding in between
+	var data []byte
+	data = append(data, first...)
+	data = append(data, make([]byte, 512)...)
+	data = append(data, second...)
+	data = append(data, make([]byte, 16)...)
+
+	var progress int64
+
+	gz, err := NewGzipReader(NewProgressReader(bytes.NewReader(data), func(n int64) { progress = n }))
+	require.NoError(t, err)
+
+	out, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2\nline 3\n", string(out))
+	require.Equal(t, 2, gz.Members())
+	require.Equal(t, int64(len(data)), progress)
+
+	// A truncated last member returns the data up to the error, and the member
+	data = append(append([]byte(nil), first...), second[:len(second)-4]...)
+
+	gz, err = NewGzipReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	out, err = ioutil.ReadAll(gz)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "gzip member 2 at offset"), err.Error())
+	require.True(t, bytes.HasPrefix(out, []byte("line 1\nline 2\n")), string(out))
+
+	// Garbage after a member
+	gz, err = NewGzipReader(bytes.NewReader(append(append([]byte(nil), first...), "garbage"...)))
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(gz)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "gzip member 2"), err.Error())
+
+	_, err = NewGzipReader(bytes.NewReader([]byte("not gzip")))
+	require.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ScanHAProxy returns a Sequence, or a list of tokens, for a message of an HAProxy
+// log. It's scanned the same way as Scan does, except the timers and other tuples
+// of integers joined by "/" are split into integers, see splitTimers.
+func (this *Scanner) ScanHAProxy(s string) (Sequence, error) {
+	if _, err := this.Scan(s); err != nil {
+		return nil, err
+	}
+
+	this.splitTimers()
+
+	if this.keep {
+		this.seq.keepText(s)
+	}
+
+	return this.seq, nil
+}
+
+// splitTimers splits each literal that's a tuple of three to five integers joined
+// by "/", e.g., the HAProxy timers "10/0/30/69/109", or Tq/Tw/Tc/Tr/Tt, of the
+// HTTP log format, and "0/0/5007", or Tw/Tc/Tt, of the TCP log format, into its
+// integers and the "/" between them, so each timer can be tagged by a pattern.
+// The timers are -1 if the step was not reached, and the total time has a "+" in
+// front if it was logged before the end of the session. Tuples that could be dates,
+// e.g., "10/14/2015", are left as is, so a few TCP timers, e.g., "1/2/15", are too.
+func (this *Scanner) splitTimers() {
+	for i := 0; i < len(this.seq); i++ {
+		tok := this.seq[i]
+		if tok.Type != TokenLiteral || tok.isKey {
+			continue
+		}
+
+		if n := strings.Count(tok.Value, "/"); n < 2 || n > 4 {
+			continue
+		}
+
+		parts := strings.Split(tok.Value, "/")
+
+		timers := true
+		for _, p := range parts {
+			if p == "" || !isDigits(p) && numberType(p) != TokenInteger {
+				timers = false
+				break
+			}
+		}
+
+		if !timers || isSlashDate(parts) {
+			continue
+		}
+
+		split := make(Sequence, 0, 2*len(parts)-1)
+		for j, p := range parts {
+			if j > 0 {
+				split = append(split, Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/"})
+			}
+			split = append(split, Token{Tag: TagUnknown, Type: TokenInteger, Value: p, isValue: tok.isValue})
+		}
+
+		this.seq = append(this.seq[:i], append(split, this.seq[i+1:]...)...)
+
+		if i < len(this.spaced) {
+			spaced := make([]bool, len(split))
+			spaced[0] = this.spaced[i]
+			this.spaced = append(this.spaced[:i], append(spaced, this.spaced[i+1:]...)...)
+		}
+
+		i += len(split) - 1
+	}
+}
+
+// isSlashDate returns true if the three integers could be a date, e.g., 10/14/2015
+// or 14/10/15, with the day and month in either order, and a year of 2 or 4 digits.
+func isSlashDate(parts []string) bool {
+	if len(parts) != 3 || (len(parts[2]) != 2 && len(parts[2]) != 4) {
+		return false
+	}
+
+	for _, p := range parts[:2] {
+		if n, err := strconv.Atoi(p); err != nil || p[0] == '+' || n < 1 || n > 31 {
+			return false
+		}
+	}
+
+	return isDigits(parts[2])
+}
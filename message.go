@@ -17,12 +17,17 @@ package sequence
 import (
 	"fmt"
 	"io"
+	"strings"
 	"unicode"
 )
 
 type Message struct {
 	Data string
 
+	// punct are the punctuation characters that are always tokens of their own,
+	// rather than part of the literals around them
+	punct string
+
 	state struct {
 		// these are per token states
 		tokenType TokenType
@@ -42,6 +47,9 @@ type Message struct {
 		chquote rune // Which quote character is it?
 		nxquote bool // Should the next quote be an open quote? See special case in scan()
 
+		spaced   bool // Is the last token returned preceded by spaces?
+		trailing bool // Is the last token returned followed by spaces?
+
 		hexState            int  // Current hex string state
 		hexStart            bool // Is the first char a :?
 		hexColons           int  // Total number of colons
@@ -66,6 +74,8 @@ func (this *Message) Tokenize() (Token, error) {
 		// Number of spaces skipped
 		nss := this.skipSpace(this.Data[this.state.start:])
 		this.state.start += nss
+		this.state.spaced = nss > 0 || this.state.trailing
+		this.state.trailing = false
 
 		// Let's see if this is a tag token, enclosed in two '%' chars
 		// at least 2 chars left, and the first is a '%'
@@ -92,6 +102,17 @@ func (this *Message) Tokenize() (Token, error) {
 			}
 		}
 
+		// Currency amounts, e.g., "$1,234.56", would otherwise be broken up at the
+		// commas, and the multi-byte currency symbols would be broken up by byte
+		if l := matchCurrency(this.Data[this.state.start:]); l > 0 {
+			tok := Token{Tag: TagUnknown, Type: TokenCurrency, Value: this.Data[this.state.start : this.state.start+l]}
+			this.state.tokCount++
+			this.state.prevToken = tok
+			this.state.start += l
+
+			return tok, nil
+		}
+
 		l, t, err := this.scanToken(this.Data[this.state.start:])
 		if err != nil {
 			return Token{}, err
@@ -109,6 +130,18 @@ func (this *Message) Tokenize() (Token, error) {
 		}
 
 		tok := Token{Tag: TagUnknown, Type: t, Value: this.Data[this.state.start : this.state.start+l]}
+
+		// Signed numbers, numbers with exponents and percentages are scanned as
+		// literals, so check whether the literal is really a number
+		if t == TokenLiteral {
+			if nt := numberType(tok.Value); nt != TokenUnknown {
+				tok.Type = nt
+			} else if vl := len(tok.Value); vl > 1 && tok.Value[vl-1] == '%' && isNumber(tok.Value[:vl-1]) {
+				tok.Type = TokenPercent
+			}
+		}
+
+		this.state.trailing = s > 0
 		this.state.tokCount++
 		this.state.prevToken = tok
 		this.state.start += l + s
@@ -234,6 +267,18 @@ func (this *Message) scanToken(data string) (int, TokenType, error) {
 
 func (this *Message) tokenStep(i int, r rune) bool {
 	// glog.Debugf("1. i=%d, r=%c, tokenStop=%t, tokenType=%s", i, r, this.state.tokenStop, this.state.tokenType)
+	if this.punct != "" && strings.ContainsRune(this.punct, r) {
+		// A punctuation character ends the token before it, or is a single character
+		// literal token of its own
+		if i == 0 {
+			this.state.tokenType = TokenLiteral
+		}
+
+		this.state.tokenStop = true
+
+		return true
+	}
+
 	switch this.state.tokenType {
 	case TokenUnknown:
 		switch r {
@@ -565,6 +610,8 @@ func (this *Message) reset() {
 	this.state.end = len(this.Data)
 	this.state.cur = 0
 	this.state.backslash = false
+	this.state.spaced = false
+	this.state.trailing = false
 
 	this.resetTokenStates()
 }
@@ -591,6 +638,142 @@ func isLetter(r rune) bool {
 	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_' || r >= 0x80 && unicode.IsLetter(r)
 }
 
+// numberType returns TokenInteger or TokenFloat if s is a number with an optional
+// sign, fraction and exponent, e.g., "-7", "+2.5", ".5" or "6.02e23", and returns
+// TokenUnknown otherwise.
+func numberType(s string) TokenType {
+	var (
+		i         int
+		digits    bool
+		fraction  bool
+		exponent  bool
+		sign      bool
+		expDigits bool
+	)
+
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		sign = true
+		i++
+	}
+
+	for ; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+		digits = true
+	}
+
+	if i < len(s) && s[i] == '.' {
+		// A trailing dot, e.g., "port 22.", is more likely to end a sentence
+		if i+1 == len(s) {
+			return TokenUnknown
+		}
+
+		fraction = true
+		for i++; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+			digits = true
+		}
+	}
+
+	if !digits {
+		return TokenUnknown
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		exponent = true
+		i++
+
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+
+		for ; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+			expDigits = true
+		}
+
+		if !expDigits {
+			return TokenUnknown
+		}
+	}
+
+	switch {
+	case i != len(s):
+		return TokenUnknown
+	case fraction || exponent:
+		return TokenFloat
+	case sign:
+		return TokenInteger
+	}
+
+	// Unsigned integers are already recognized by the scanner, so if it's still
+	// a literal, e.g., a leading zero number, leave it be
+	return TokenUnknown
+}
+
+// isNumber returns true if s is a signed or unsigned integer or floating point number.
+func isNumber(s string) bool {
+	return numberType(s) != TokenUnknown || (len(s) > 0 && isDigits(s))
+}
+
+// currencySymbols are the currency symbols recognized in front of an amount.
+var currencySymbols = []string{"$", "€", "£", "¥"}
+
+// matchCurrency returns the length of the currency amount at the start of s, or 0
+// if s doesn't start with one. A currency amount is an optional minus sign, a
+// currency symbol, and a number with optional thousands separators and cents, e.g.,
+// "$1,234.56", "-$5" or "€99.00".
+func matchCurrency(s string) int {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+
+	var sym string
+	for _, cs := range currencySymbols {
+		if strings.HasPrefix(s[i:], cs) {
+			sym = cs
+			break
+		}
+	}
+
+	if sym == "" {
+		return 0
+	}
+	i += len(sym)
+
+	start := i
+	for ; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+	}
+
+	if i == start {
+		return 0
+	}
+
+	// thousands separators must be followed by exactly 3 digits
+	for i+4 <= len(s) && s[i] == ',' && isDigits(s[i+1:i+4]) && (i+4 == len(s) || !isDigits(s[i+4:i+5])) {
+		i += 4
+	}
+
+	if i+1 < len(s) && s[i] == '.' && '0' <= s[i+1] && s[i+1] <= '9' {
+		for i++; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+		}
+	}
+
+	// The amount must not be followed by more of a literal, e.g., "$5abc"
+	if i < len(s) && s[i] != '.' && isLiteral(rune(s[i])) {
+		return 0
+	}
+
+	return i
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func isLiteral(r rune) bool {
 	//return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '_' || r == '#' || r == '\\' || r == '%' || r == '*' || r == '@' || r == '$' || r == '?' || r == '.' || r == '&' || r == '/'
 	switch r {
@@ -600,6 +783,19 @@ func isLiteral(r rune) bool {
 	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r >= '0' && r <= '9'
 }
 
+// validPunctuation returns an error if any of the characters can't be split out of
+// the literals as punctuation. Letters, digits and spaces aren't punctuation, and
+// quotes are always tokens.
+func validPunctuation(chars string) error {
+	for _, r := range chars {
+		if r > unicode.MaxASCII || !unicode.IsPunct(r) && !unicode.IsSymbol(r) || strings.ContainsRune(`"'<>`, r) {
+			return fmt.Errorf("Invalid punctuation %q: %q is not a punctuation character, or is a quote", chars, r)
+		}
+	}
+
+	return nil
+}
+
 func isHex(r rune) bool {
 	return isDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
 }
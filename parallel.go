@@ -0,0 +1,163 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"sync"
+)
+
+// ScanFunc scans a message into a sequence using the scanner, e.g., using one of
+// the Scan*() methods of the scanner.
+type ScanFunc func(scanner *Scanner, msg string) (Sequence, error)
+
+// ParseResult is the result of parsing a single message with a ParallelParser.
+type ParseResult struct {
+	Message  string   // Message is the message as it was added.
+	Sequence Sequence // Sequence is the parsed message, nil if there's an error.
+	Pattern  *Pattern // Pattern is the pattern that matched, nil if it was added using Add.
+	Err      error    // Err is the error scanning or parsing the message, if any.
+}
+
+// ParallelParser scans and parses messages using a number of workers, each with
+// its own Scanner, that share a Parser, and returns the results in the order the
+// messages were added. At most queue messages are waiting or being parsed at any
+// time, after which Add blocks until the oldest result is read, so the results
+// must be read from another goroutine than the one adding the messages, e.g.,
+//
+//	pp := sequence.NewParallelParser(parser, runtime.NumCPU(), 1000)
+//
+//	go func() {
+//		for _, msg := range msgs {
+//			pp.Add(msg)
+//		}
+//		pp.Close()
+//	}()
+//
+//	for res := range pp.Results() {
+//		...
+//	}
+//
+// Patterns can still be added to the Parser while messages are being parsed.
+type ParallelParser struct {
+	parser     *Parser
+	workers    int
+	newScanner func() *Scanner
+	scan       ScanFunc
+
+	// jobs are the messages waiting for a worker, pending are the result channels
+	// of the messages added, in order, which are read by the collector
+	jobs    chan parallelJob
+	pending chan chan ParseResult
+	results chan ParseResult
+
+	once sync.Once
+}
+
+type parallelJob struct {
+	msg    string
+	result chan ParseResult
+}
+
+// NewParallelParser returns a ParallelParser that parses messages with the parser
+// using the number of workers, with at most queue messages in flight. Both are at
+// least 1.
+func NewParallelParser(parser *Parser, workers, queue int) *ParallelParser {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queue < 1 {
+		queue = 1
+	}
+
+	return &ParallelParser{
+		parser:     parser,
+		workers:    workers,
+		newScanner: NewScanner,
+		scan:       (*Scanner).Scan,
+		jobs:       make(chan parallelJob, queue),
+		pending:    make(chan chan ParseResult, queue),
+		results:    make(chan ParseResult, queue),
+	}
+}
+
+// SetScanner sets the function that returns the Scanner of each worker, e.g., to
+// set the json fields of the scanners, and the function that scans the messages,
+// e.g., (*Scanner).ScanJson. Either can be nil to keep the default, which is
+// NewScanner and (*Scanner).Scan. It must be called before the first Add.
+func (this *ParallelParser) SetScanner(newScanner func() *Scanner, scan ScanFunc) {
+	if newScanner != nil {
+		this.newScanner = newScanner
+	}
+
+	if scan != nil {
+		this.scan = scan
+	}
+}
+
+// Add adds the message to be parsed, and blocks if the queue is full. It must not
+// be called after Close.
+func (this *ParallelParser) Add(msg string) {
+	this.once.Do(this.start)
+
+	result := make(chan ParseResult, 1)
+	this.pending <- result
+	this.jobs <- parallelJob{msg: msg, result: result}
+}
+
+// Close signals that no more messages will be added. The results channel is closed
+// once the results of all the messages added have been read.
+func (this *ParallelParser) Close() {
+	this.once.Do(this.start)
+
+	close(this.jobs)
+	close(this.pending)
+}
+
+// Results returns the channel of the results, in the order the messages were added.
+func (this *ParallelParser) Results() <-chan ParseResult {
+	return this.results
+}
+
+func (this *ParallelParser) start() {
+	for i := 0; i < this.workers; i++ {
+		go this.work()
+	}
+
+	go func() {
+		defer close(this.results)
+
+		for result := range this.pending {
+			this.results <- <-result
+		}
+	}()
+}
+
+func (this *ParallelParser) work() {
+	scanner := this.newScanner()
+
+	for job := range this.jobs {
+		res := ParseResult{Message: job.msg}
+
+		seq, err := this.scan(scanner, job.msg)
+		if err == nil {
+			res.Sequence, res.Pattern, res.Err = this.parser.Match(seq)
+		} else {
+			res.Err = err
+		}
+
+		job.result <- res
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelParserOrder(t *testing.T) {
+	parser := NewParser()
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser%"}))
+
+	pp := NewParallelParser(parser, 4, 8)
+
+	var msgs []string
+	for i := 0; i < 1000; i++ {
+		if i%10 == 0 {
+			msgs = append(msgs, fmt.Sprintf("unknown message %d", i))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("Jan 12 06:49:42 irc sshd[%d]: accepted password for user%d", i, i))
+		}
+	}
+
+	go func() {
+		for _, msg := range msgs {
+			pp.Add(msg)
+		}
+		pp.Close()
+	}()
+
+	n := 0
+
+	for res := range pp.Results() {
+		require.Equal(t, msgs[n], res.Message)
+
+		if n%10 == 0 {
+			require.Equal(t, ErrNoMatch, res.Err, res.Message)
+			require.Nil(t, res.Sequence)
+		} else {
+			require.NoError(t, res.Err, res.Message)
+			require.NotNil(t, res.Pattern)
+			require.Equal(t, fmt.Sprintf("user%d", n), res.Sequence[len(res.Sequence)-1].Value)
+		}
+
+		n++
+	}
+
+	require.Equal(t, len(msgs), n)
+}
+
+func TestParallelParserScanner(t *testing.T) {
+	parser := NewParser()
+	require.NoError(t, parser.AddPattern(Pattern{Text: "reference = %string% roundtripduration = %duration%"}))
+
+	pp := NewParallelParser(parser, 2, 2)
+	pp.SetScanner(nil, (*Scanner).ScanJson)
+
+	go func() {
+		pp.Add(`{"reference":"abc","roundTripDuration":206}`)
+		pp.Add(`not json`)
+		pp.Close()
+	}()
+
+	res := <-pp.Results()
+	require.NoError(t, res.Err)
+
+	res = <-pp.Results()
+	require.Error(t, res.Err)
+
+	_, ok := <-pp.Results()
+	require.False(t, ok)
+}
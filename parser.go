@@ -16,8 +16,10 @@ package sequence
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -37,6 +39,36 @@ type Parser struct {
 	root   *parseNode
 	height int
 	mu     sync.RWMutex
+
+	// the patterns added using AddPattern, used to explain parse failures
+	pats []compiledPattern
+
+	// scratch is the pool of parseScratch reused across parses, gets and allocs
+	// count the parses and the scratch allocated for them
+	scratch sync.Pool
+	gets    uint64
+	allocs  uint64
+}
+
+// parseScratch is the working memory of a single parse, i.e., the path of tokens
+// walked and the stack of nodes to visit. It's reused across parses, since it's
+// otherwise allocated for every message, and dominates the garbage of parsing.
+type parseScratch struct {
+	path    Sequence
+	toVisit []stackParseNode
+}
+
+// PoolStats are the statistics of the scratch memory pool of a Parser. If Allocs
+// keeps growing along with Gets, the pool is emptied by the garbage collector too
+// often, and increasing GOGC may help.
+type PoolStats struct {
+	Gets   uint64 // Gets is the number of parses that took scratch memory from the pool.
+	Allocs uint64 // Allocs is the number of times the pool was empty, and scratch memory was allocated.
+}
+
+type compiledPattern struct {
+	pat *Pattern
+	seq Sequence
 }
 
 type parseNode struct {
@@ -52,6 +84,16 @@ type parseNode struct {
 
 	// literal children
 	lc map[string]*parseNode
+
+	// the pattern that ends at this node, if this is a leaf
+	pattern *Pattern
+
+	// can the pattern that ends at this node match a prefix of the message?
+	prefix bool
+
+	// the value the token must have for the children to be searched, if the
+	// patterns under this node are conditional on this token
+	cond string
 }
 
 type stackParseNode struct {
@@ -67,10 +109,25 @@ func (this stackParseNode) String() string {
 }
 
 func NewParser() *Parser {
-	return &Parser{
+	this := &Parser{
 		root:   newParseNode(),
 		height: 0,
 	}
+
+	this.scratch.New = func() interface{} {
+		atomic.AddUint64(&this.allocs, 1)
+		return &parseScratch{}
+	}
+
+	return this
+}
+
+// PoolStats returns the statistics of the scratch memory pool of the parser.
+func (this *Parser) PoolStats() PoolStats {
+	return PoolStats{
+		Gets:   atomic.LoadUint64(&this.gets),
+		Allocs: atomic.LoadUint64(&this.allocs),
+	}
 }
 
 func newParseNode() *parseNode {
@@ -88,13 +145,57 @@ func (this *parseNode) String() string {
 // builds the parser tree so it can be used for parsing later.
 //func (this *Parser) Add(s string) error {
 func (this *Parser) Add(seq Sequence) error {
+	return this.add(seq, nil)
+}
+
+// AddPattern scans the pattern text and adds the resulting pattern sequence to the
+// parser tree. The pattern is remembered so that Match can report which pattern
+// matched a message.
+func (this *Parser) AddPattern(pat Pattern) error {
+	seq, err := NewScanner().Scan(pat.Text)
+	if err != nil {
+		return err
+	}
+
+	if err := this.add(seq, &pat); err != nil {
+		return err
+	}
+
+	cseq, err := compilePattern(pat.Text)
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	this.pats = append(this.pats, compiledPattern{&pat, cseq})
+	this.mu.Unlock()
+
+	return nil
+}
+
+func (this *Parser) add(seq Sequence, pat *Pattern) error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
 	parent := this.root
 	var grandparent *parseNode = nil
 
+	var (
+		condTag TagType = TagUnknown
+		gated   bool
+	)
+
+	if pat != nil && pat.When.Field != "" {
+		if condTag = name2TagType(pat.When.Field); condTag == TagUnknown {
+			return fmt.Errorf("Invalid pattern condition %q: unknown field", pat.When.Field)
+		}
+	}
+
 	for _, token := range seq {
+		// The nodes keep the token, but not the text around it in the pattern or
+		// message it came from, which is only used by Reconstruct
+		token.kept = nil
+
 		vl := len(token.Value)
 		//minus, plus, star := false, false, false
 
@@ -103,18 +204,28 @@ func (this *Parser) Add(seq Sequence) error {
 			if token, err = processTagToken(token); err != nil {
 				return err
 			}
+		} else if token.Type == TokenHost {
+			// A host name in the pattern is a literal, only %host% matches any host
+			token.Type = TokenLiteral
 		}
 
 		//log.Printf("add token=%s", token)
 
 		var found *parseNode
 
+		// The first token of the conditional field is the gate, so patterns with
+		// different conditions don't share the subtree below it.
+		var cond string
+		if !gated && condTag != TagUnknown && token.Tag == condTag {
+			cond, gated = pat.When.Value, true
+		}
+
 		switch {
 		case token.Type != TokenUnknown && token.Type != TokenLiteral:
 			// token nodes
 			if parent.tc[token.Type] != nil {
 				for _, n := range parent.tc[token.Type] {
-					if n.Type == token.Type && n.Tag == token.Tag && n.until == token.until {
+					if n.Type == token.Type && n.Tag == token.Tag && n.until == token.until && n.cond == cond {
 						found = n
 						break
 					}
@@ -124,6 +235,7 @@ func (this *Parser) Add(seq Sequence) error {
 			if found == nil {
 				found = newParseNode()
 				found.Token = token
+				found.cond = cond
 				parent.tc[found.Type] = append(parent.tc[found.Type], found)
 				parent.parent = true
 			}
@@ -156,7 +268,7 @@ func (this *Parser) Add(seq Sequence) error {
 			case found.Type != TokenUnknown && found.Type != TokenLiteral:
 				if grandparent.tc[found.Type] != nil {
 					for _, n := range grandparent.tc[found.Type] {
-						if n.Type == found.Type && n.Tag == found.Tag {
+						if n.Type == found.Type && n.Tag == found.Tag && n.cond == found.cond {
 							grandchild = n
 							break
 						}
@@ -186,10 +298,24 @@ func (this *Parser) Add(seq Sequence) error {
 		parent = found
 	}
 
+	if condTag != TagUnknown && !gated {
+		return fmt.Errorf("Invalid pattern condition %q: field not in pattern", pat.When.Field)
+	}
+
+	prefix := pat != nil && pat.Match == MatchPrefix
+
 	parent.leaf = true
+	parent.prefix = parent.prefix || prefix
+	if parent.pattern == nil {
+		parent.pattern = pat
+	}
 
 	if grandparent != nil {
 		grandparent.leaf = true
+		grandparent.prefix = grandparent.prefix || prefix
+		if grandparent.pattern == nil {
+			grandparent.pattern = pat
+		}
 	}
 
 	if len(seq) > this.height {
@@ -206,25 +332,139 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 
+	seq, _, err := this.parse(seq)
+	return seq, err
+}
+
+// Match is the same as Parse, except it also returns the pattern that matched the
+// message sequence. The pattern is nil if the matching pattern sequence was added
+// using Add instead of AddPattern.
+func (this *Parser) Match(seq Sequence) (Sequence, *Pattern, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return this.parse(seq)
+}
+
+// Explanation describes how close a pattern came to matching a message.
+type Explanation struct {
+	Pattern    *Pattern   // Pattern is the pattern that was compared with the message.
+	Matched    int        // Matched is the number of leading message tokens that matched.
+	Divergence Divergence // Divergence is the token that broke the match.
+}
+
+// String returns the explanation in the format "pattern: n tokens matched, ...".
+func (this Explanation) String() string {
+	return fmt.Sprintf("%s: %d tokens matched, %s", this.Pattern, this.Matched, this.Divergence)
+}
+
+// ParseExplain is the same as Parse, except if the message sequence doesn't match
+// any pattern, it also returns the closest patterns, i.e., the ones that matched
+// the most leading tokens of the message, along with the token that broke each
+// match. Only the patterns added using AddPattern are explained.
+func (this *Parser) ParseExplain(seq Sequence) (Sequence, []Explanation, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	pseq, _, err := this.parse(seq)
+	if err == nil {
+		return pseq, nil, nil
+	}
+
+	var exps []Explanation
+
+	for _, cp := range this.pats {
+		d, diverged := diffPattern(cp.seq, seq)
+		if !diverged {
+			// The tokens match, but the pattern condition isn't met
+			continue
+		}
+
+		if len(exps) > 0 && d.Index < exps[0].Matched {
+			continue
+		} else if len(exps) > 0 && d.Index > exps[0].Matched {
+			exps = exps[:0]
+		}
+
+		exps = append(exps, Explanation{Pattern: cp.pat, Matched: d.Index, Divergence: d})
+	}
+
+	return nil, exps, err
+}
+
+// Suggestion is a pattern similar to a message.
+type Suggestion struct {
+	Pattern    *Pattern // Pattern is the pattern similar to the message.
+	Similarity float64  // Similarity is from 0 for nothing in common, to 1 for the same tokens.
+}
+
+// Suggest returns the k patterns most similar to the message sequence, most similar
+// first, based on the number of tokens that differ between them. It's useful for
+// deciding whether an existing pattern can be generalized to match a message that
+// doesn't match any pattern, rather than adding a new one. Only the patterns added
+// using AddPattern are suggested.
+func (this *Parser) Suggest(seq Sequence, k int) []Suggestion {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	sugs := make(suggestions, 0, len(this.pats))
+
+	for _, cp := range this.pats {
+		sugs = append(sugs, Suggestion{Pattern: cp.pat, Similarity: similarity(cp.seq, seq)})
+	}
+
+	sort.Stable(sugs)
+
+	if k < len(sugs) {
+		sugs = sugs[:k]
+	}
+
+	return sugs
+}
+
+type suggestions []Suggestion
+
+func (this suggestions) Len() int           { return len(this) }
+func (this suggestions) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this suggestions) Less(i, j int) bool { return this[i].Similarity > this[j].Similarity }
+
+func (this *Parser) parse(seq Sequence) (Sequence, *Pattern, error) {
 	for i, t := range seq {
-		if t.Type == TokenLiteral {
+		if t.Type == TokenLiteral || t.Type == TokenHost {
 			seq[i].Value = strings.ToLower(t.Value)
 		}
 	}
 
+	atomic.AddUint64(&this.gets, 1)
+
+	scratch := this.scratch.Get().(*parseScratch)
+	defer this.scratch.Put(scratch)
+
 	var (
 		parent stackParseNode
 
 		// Keep track of the path we have walked
-		path = make(Sequence, len(seq))
+		path = scratch.path
 
+		// The best path is returned, so it's the only one that's not reused
 		bestScore int
-		bestPath  = make(Sequence, len(seq))
+		bestPath  Sequence
+		bestNode  *parseNode
 	)
 
+	if cap(path) < len(seq) {
+		path = make(Sequence, len(seq))
+	}
+	path = path[:len(seq)]
+
 	// toVisit is a stack, children that need to be visited are appended to the end,
 	// and we take children from the end to visit
-	toVisit := append(make([]stackParseNode, 0, this.height), stackParseNode{node: this.root})
+	toVisit := append(scratch.toVisit[:0], stackParseNode{node: this.root})
+
+	// the path and the stack may grow, so they are saved back for the next parse
+	defer func() {
+		scratch.path, scratch.toVisit = path, toVisit
+	}()
 
 	for len(toVisit) > 0 {
 		// pop the last element from the toVisit stack
@@ -279,10 +519,22 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				if parent.score > bestScore {
 					bestScore = parent.score
 					bestPath = append(bestPath[:0], path...)
+					bestNode = parent.node
 				}
 
 				continue
 			}
+
+			// There are tokens left, but the pattern can match a prefix of the
+			// message, so finalize the current path with the rest of the message
+			// as a msgrest token. Keep looking in case a longer pattern matches.
+			if parent.node.prefix && parent.score > bestScore {
+				rest := Token{Type: TokenString, Tag: TagMsgRest, Value: seq[parent.seqidx:].text()}
+
+				bestScore = parent.score
+				bestPath = append(append(bestPath[:0], path...), rest)
+				bestNode = parent.node
+			}
 		}
 
 		// If there's not enough tokens extractd from the message, then let's get more.
@@ -304,6 +556,9 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 			// Find any children that's a string token and add them to the stack
 			// if len(token.Value) > 1 || (len(token.Value) == 1 && isLiteral(rune(token.Value[0]))) {
 			for _, n := range parent.node.tc[TokenString] {
+				if n.cond != "" && n.cond != token.Value {
+					continue
+				}
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + partialMatchWeight, token.Value})
 			}
 			// }
@@ -313,8 +568,27 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
 			}
 
+		case TokenHost:
+			// A host name is also a string, so it partially matches string tokens,
+			// and fully matches the same literal host name
+			for _, n := range parent.node.tc[TokenString] {
+				if n.cond != "" && n.cond != token.Value {
+					continue
+				}
+				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + partialMatchWeight, token.Value})
+			}
+
+			if n, ok := parent.node.lc[token.Value]; ok {
+				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
+			}
+
+			fallthrough
+
 		default:
 			for _, n := range parent.node.tc[token.Type] {
+				if n.cond != "" && n.cond != strings.ToLower(token.Value) {
+					continue
+				}
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
 			}
 		}
@@ -334,10 +608,10 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				l = len(bestPath)
 			}
 		}
-		return bestPath, nil
+		return bestPath, bestNode.pattern, nil
 	}
 
-	return nil, ErrNoMatch
+	return nil, nil, ErrNoMatch
 }
 
 // A tag token is of the format "%tag:type:meta%".
@@ -284,6 +284,296 @@ func TestParserParseMessages(t *testing.T) {
 	}
 }
 
+func TestParserMatch(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for i, tc := range parsetests[:3] {
+		err := parser.AddPattern(Pattern{Text: tc.rule, Source: "test.txt", Line: i + 1})
+		require.NoError(t, err, tc.rule)
+	}
+
+	for i, tc := range parsetests[:3] {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, pat, err := parser.Match(seq)
+		require.NoError(t, err, tc.msg)
+		require.NotNil(t, pat, tc.msg)
+		require.Equal(t, tc.rule, pat.Text)
+		require.Equal(t, i+1, pat.Line)
+	}
+}
+
+func TestParserPoolStats(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, tc := range parsetests[:3] {
+		require.NoError(t, parser.AddPattern(Pattern{Text: tc.rule}), tc.rule)
+	}
+
+	for i := 0; i < 100; i++ {
+		for _, tc := range parsetests[:3] {
+			seq, err := scanner.Scan(tc.msg)
+			require.NoError(t, err, tc.msg)
+
+			// The parsed sequence is not reused by the next parse
+			pseq, err := parser.Parse(seq)
+			require.NoError(t, err, tc.msg)
+			want := pseq.String()
+
+			_, err = parser.Parse(append(Sequence(nil), seq...))
+			require.NoError(t, err, tc.msg)
+			require.Equal(t, want, pseq.String(), tc.msg)
+		}
+	}
+
+	stats := parser.PoolStats()
+	require.Equal(t, uint64(600), stats.Gets)
+	require.True(t, stats.Allocs >= 1 && stats.Allocs < stats.Gets, stats)
+}
+
+func TestParserMatchCondition(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for i, text := range []string{
+		"%msgtime% %apphost% %appname% : %string% %action%",
+		"%msgtime% %apphost% %appname% : %string% %status%",
+	} {
+		pat := Pattern{Text: text, Line: i + 1, When: Condition{Field: "appname", Value: "unix"}}
+		if i == 1 {
+			pat.When.Value = "kernel"
+		}
+		require.NoError(t, parser.AddPattern(pat), text)
+	}
+
+	for _, tc := range []struct {
+		msg  string
+		line int
+	}{
+		{"May  2 15:51:24 dlfssrv unix: vfs root", 1},
+		{"May  2 15:51:24 dlfssrv KERNEL: vfs root", 2},
+		{"May  2 15:51:24 dlfssrv sshd: vfs root", 0},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		_, pat, err := parser.Match(seq)
+
+		if tc.line == 0 {
+			require.Equal(t, ErrNoMatch, err, tc.msg)
+			continue
+		}
+
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.line, pat.Line, tc.msg)
+	}
+
+	err := parser.AddPattern(Pattern{Text: "%msgtime% %apphost% : %string%", When: Condition{Field: "appname", Value: "unix"}})
+	require.Error(t, err)
+
+	err = parser.AddPattern(Pattern{Text: "%msgtime% %apphost% : %string%", When: Condition{Field: "vendorname", Value: "unix"}})
+	require.Error(t, err)
+}
+
+func TestParserMatchPrefix(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%msgtime% %apphost% %appname% : vfs root %action%", Match: MatchPrefix}))
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%msgtime% %apphost% %appname% : session opened for %dstuser%"}))
+
+	msg := "May  2 15:51:24 dlfssrv unix: vfs root entry on volume 3"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	seq, _, err = parser.Match(seq)
+	require.NoError(t, err, msg)
+	require.Equal(t, TagAction, seq[len(seq)-2].Tag)
+	require.Equal(t, TagMsgRest, seq[len(seq)-1].Tag)
+	require.Equal(t, "on volume 3", seq[len(seq)-1].Value)
+
+	msg = "May  2 15:51:24 dlfssrv unix: vfs root entry"
+	seq, err = scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	seq, _, err = parser.Match(seq)
+	require.NoError(t, err, msg)
+	require.Equal(t, TagAction, seq[len(seq)-1].Tag)
+
+	msg = "May  2 15:51:24 dlfssrv sshd: session opened for root by (uid=0)"
+	seq, err = scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	_, _, err = parser.Match(seq)
+	require.Equal(t, ErrNoMatch, err, msg)
+
+	// The rest is the text of the message as is if the scanner keeps it
+	scanner.SetKeepText(true)
+
+	for msg, rest := range map[string]string{
+		"May  2 15:51:24 dlfssrv unix: vfs root entry a=b, c":                        "a=b, c",
+		`May  2 15:51:24 dlfssrv unix: vfs root entry  "Quoted  Text" (id=7)  done.`: `"Quoted  Text" (id=7)  done.`,
+		"May  2 15:51:24 dlfssrv unix: vfs root entry on 10.1.1.1:80":                "on 10.1.1.1:80",
+	} {
+		seq, err = scanner.Scan(msg)
+		require.NoError(t, err, msg)
+		seq, _, err = parser.Match(seq)
+		require.NoError(t, err, msg)
+		require.Equal(t, TagMsgRest, seq[len(seq)-1].Tag)
+		require.Equal(t, rest, seq[len(seq)-1].Value, seq.PrintTokens())
+	}
+}
+
+func TestParserParseHost(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, rule := range []string{
+		"%msgtime% %apphost% %appname% : connection from host %host%",
+		"%msgtime% %apphost% %appname% : connection from relay.example.com to %dsthost%",
+	} {
+		seq, err := scanner.Scan(rule)
+		require.NoError(t, err, rule)
+		require.NoError(t, parser.Add(seq), rule)
+	}
+
+	for _, tc := range []struct {
+		msg, rule string
+	}{
+		{"Jan 12 06:49:42 irc app: connection from host db-prod-03.example.com", "%msgtime% %apphost% %appname% : connection from host %host%"},
+		{"Jan 12 06:49:42 irc app: connection from host db-prod-04.example.com.", "%msgtime% %apphost% %appname% : connection from host %host%"},
+		{"Jan 12 06:49:42 irc app: connection from Relay.Example.com to db.example.com", "%msgtime% %apphost% %appname% : connection from relay.example.com to %dsthost%"},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.rule, seq.String(), tc.msg)
+	}
+}
+
+func TestParserParseRequest(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	rule := `%srcip% - - [ %msgtime% ] " %request% " %integer% %integer%`
+	seq, err := scanner.Scan(rule)
+	require.NoError(t, err, rule)
+	require.NoError(t, parser.Add(seq), rule)
+
+	for _, msg := range []string{
+		`9.26.157.45 - - [16/Jan/2003:21:22:59 -0500] "GET /WSsamples/ HTTP/1.1" 200 1576`,
+		`9.26.157.44 - - [16/Jan/2003:21:22:59 -0500] "POST /cart?item=1&qty=2 HTTP/1.0" 302 0`,
+	} {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, msg)
+		require.Equal(t, rule, seq.String(), msg)
+	}
+}
+
+func TestParserParseSequence(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	rule := "%srcip% %srcport% %dstip% %dstport% %method% %object%"
+	seq, err := scanner.Scan(rule)
+	require.NoError(t, err, rule)
+	require.NoError(t, parser.Add(seq), rule)
+
+	seq, err = NewSequence(
+		NewToken(TokenIPv4, "10.1.1.1"),
+		NewToken(TokenInteger, "49152"),
+		NewToken(TokenIPv4, "10.2.2.2"),
+		NewToken(TokenInteger, "443"),
+		NewToken(TokenUnknown, "GET"),
+		NewToken(TokenString, "/index.html"),
+	)
+	require.NoError(t, err)
+
+	seq, err = parser.Parse(seq)
+	require.NoError(t, err)
+	require.Equal(t, rule, seq.String())
+	require.Equal(t, Token{Type: TokenInteger, Tag: TagSrcPort, Value: "49152"}, seq[1])
+
+	_, err = NewSequence(NewToken(TokenIPv4, ""))
+	require.Error(t, err)
+
+	_, err = NewSequence(NewToken(token__END__, "x"))
+	require.Error(t, err)
+
+	_, err = NewSequence(Token{Type: TokenString, Tag: TagType(TagTypesCount), Value: "x"})
+	require.Error(t, err)
+}
+
+func TestParserParseExplain(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pats, err := readPatterns(strings.NewReader(`%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2
+%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for invalid user %srcuser% from %srcip% port %srcport% ssh2
+%msgtime% %apphost% %appname% : connection from %srcip%
+`), "sshd.txt")
+	require.NoError(t, err)
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat), pat.Text)
+	}
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	seq, exps, err := parser.ParseExplain(seq)
+	require.NoError(t, err, msg)
+	require.Nil(t, exps)
+	require.NotNil(t, seq)
+
+	msg = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh1"
+	seq, err = scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	_, exps, err = parser.ParseExplain(seq)
+	require.Equal(t, ErrNoMatch, err)
+	require.Equal(t, 1, len(exps))
+	require.Equal(t, "sshd.txt:1", exps[0].Pattern.String())
+	require.Equal(t, 15, exps[0].Matched)
+	require.Equal(t, `sshd.txt:1: 15 tokens matched, token 15: expected literal "ssh2", got literal "ssh1"`, exps[0].String())
+
+	msg = "Jan 12 06:49:42 irc sshd[7034]: Failed password for"
+	seq, err = scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	_, exps, err = parser.ParseExplain(seq)
+	require.Equal(t, ErrNoMatch, err)
+	require.Equal(t, 2, len(exps))
+	require.Equal(t, 10, exps[1].Matched)
+}
+
+func TestParserSuggest(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pats, err := readPatterns(strings.NewReader(`%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2
+%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for invalid user %srcuser% from %srcip% port %srcport% ssh2
+%msgtime% %apphost% %appname% : connection from %srcip%
+`), "sshd.txt")
+	require.NoError(t, err)
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat), pat.Text)
+	}
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for illegal user root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+
+	sugs := parser.Suggest(seq, 2)
+	require.Equal(t, 2, len(sugs))
+	require.Equal(t, "sshd.txt:2", sugs[0].Pattern.String())
+	require.InDelta(t, 1-1.0/18, sugs[0].Similarity, 0.0001)
+	require.Equal(t, "sshd.txt:1", sugs[1].Pattern.String())
+	require.True(t, sugs[0].Similarity > sugs[1].Similarity)
+
+	require.Equal(t, 3, len(parser.Suggest(seq, 10)))
+}
+
 func BenchmarkParserParseMeta(b *testing.B) {
 	benchmarkRunParser(b, parsetests2[3])
 }
@@ -308,3 +598,249 @@ func benchmarkRunParser(b *testing.B, tc struct{ format, msg, rule string }) {
 		parser.Parse(seq)
 	}
 }
+
+func TestParserParseFlows(t *testing.T) {
+	var pats []Pattern
+
+	for _, file := range []string{"patterns/nfdump.txt", "patterns/silk.txt"} {
+		p, err := ReadPatterns(file)
+		require.NoError(t, err, file)
+		pats = append(pats, p...)
+	}
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		fields map[TagType]string
+	}{
+		{
+			"2015-10-14 15:04:05.123     0.512 TCP        10.1.1.5:51234 ->       10.2.2.2:443          12     1520     1",
+			map[TagType]string{TagMsgTime: "2015-10-14 15:04:05.123", TagDuration: "0.512", TagProtocol: "tcp", TagSrcIP: "10.1.1.5:51234", TagDstIP: "10.2.2.2:443", TagPktsSent: "12", TagBytesSent: "1520"},
+		},
+		{
+			"     10.1.1.5|      10.2.2.2|51234|  443|  6|         1|        60|     S  |2015/10/14T15:04:05.123|    0.000|2015/10/14T15:04:05.123|  S0|",
+			map[TagType]string{TagSrcIP: "10.1.1.5", TagDstIP: "10.2.2.2", TagSrcPort: "51234", TagDstPort: "443", TagProtocol: "6", TagPktsSent: "1", TagBytesSent: "60", TagMsgTime: "2015/10/14T15:04:05.123", TagDuration: "0.000"},
+		},
+		{
+			"     10.1.1.5|      10.2.2.3|   53|53211| 17|         2|       152|        |2015/10/14T15:04:06.000|    1.250|2015/10/14T15:04:07.250|  S0|",
+			map[TagType]string{TagSrcIP: "10.1.1.5", TagDstIP: "10.2.2.3", TagSrcPort: "53", TagDstPort: "53211", TagProtocol: "17", TagBytesSent: "152", TagDuration: "1.250"},
+		},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		fields := make(map[TagType]string)
+		for _, tok := range seq {
+			fields[tok.Tag] = tok.Value
+		}
+
+		for tag, v := range tc.fields {
+			require.Equal(t, v, fields[tag], "%s: %s", tc.msg, tag)
+		}
+	}
+}
+
+func TestParserParseDNS(t *testing.T) {
+	var pats []Pattern
+
+	for _, file := range []string{"patterns/bind.txt", "patterns/unbound.txt", "patterns/dnsmasq.txt"} {
+		p, err := ReadPatterns(file)
+		require.NoError(t, err, file)
+		pats = append(pats, p...)
+	}
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		fields map[TagType]string
+	}{
+		{
+			"14-Oct-2015 15:04:05.123 queries: info: client 10.1.1.5#51234 (www.example.com): query: www.example.com IN A +E (10.0.0.1)",
+			map[TagType]string{TagSrcIP: "10.1.1.5#51234", TagDomain: "www.example.com", TagQType: "a", TagDstIP: "10.0.0.1"},
+		},
+		{
+			"14-Oct-2015 15:04:05.123 client @0x7f1234567890 10.1.1.5#51234 (example.com): query: example.com IN MX +E(0)K (10.0.0.1)",
+			map[TagType]string{TagSrcIP: "10.1.1.5#51234", TagDomain: "example.com", TagQType: "mx", TagDstIP: "10.0.0.1"},
+		},
+		{
+			"Oct 14 15:04:05 ns1 named[1234]: client 10.1.1.5#51234 (www.example.com): query: www.example.com IN AAAA + (10.0.0.1)",
+			map[TagType]string{TagAppName: "named", TagSrcIP: "10.1.1.5#51234", TagDomain: "www.example.com", TagQType: "aaaa"},
+		},
+		{
+			"[1444835045] unbound[1234:0] info: 10.1.1.5 www.example.com. A IN",
+			map[TagType]string{TagSrcIP: "10.1.1.5", TagDomain: "www.example.com.", TagQType: "a"},
+		},
+		{
+			"[1444835045] unbound[1234:0] info: reply: 10.1.1.5 example.com. AAAA IN NXDOMAIN 0.000123 0 45",
+			map[TagType]string{TagSrcIP: "10.1.1.5", TagDomain: "example.com.", TagQType: "aaaa", TagRCode: "nxdomain", TagBytesRecv: "45"},
+		},
+		{
+			"Oct 14 15:04:05 ns1 unbound: [1234:0] info: 10.1.1.6 mail.example.org. MX IN",
+			map[TagType]string{TagSrcIP: "10.1.1.6", TagDomain: "mail.example.org.", TagQType: "mx"},
+		},
+		{
+			"Oct 14 15:04:05 gw dnsmasq[1234]: query[A] www.example.com from 10.1.1.5",
+			map[TagType]string{TagQType: "a", TagDomain: "www.example.com", TagSrcIP: "10.1.1.5"},
+		},
+		{
+			"Oct 14 15:04:05 gw dnsmasq[1234]: reply www.example.com is 93.184.216.34",
+			map[TagType]string{TagAction: "reply", TagDomain: "www.example.com", TagDstIP: "93.184.216.34"},
+		},
+		{
+			"Oct 14 15:04:05 gw dnsmasq[1234]: cached example.org is NXDOMAIN",
+			map[TagType]string{TagAction: "cached", TagDomain: "example.org", TagRCode: "nxdomain"},
+		},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		fields := make(map[TagType]string)
+		for _, tok := range seq {
+			fields[tok.Tag] = tok.Value
+		}
+
+		for tag, v := range tc.fields {
+			require.Equal(t, v, fields[tag], "%s: %s", tc.msg, tag)
+		}
+	}
+}
+
+func TestParserParseHAProxy(t *testing.T) {
+	pats, err := ReadPatterns("patterns/haproxy.txt")
+	require.NoError(t, err)
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		fields map[string]string
+	}{
+		{
+			`Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET /index.html HTTP/1.1"`,
+			map[string]string{"srcip": "10.0.1.2:33317", "reqtime": "10", "queuetime": "0", "conntime": "30", "resptime": "69", "duration": "109", "status": "200", "bytessent": "2750", "reason": "----"},
+		},
+		{
+			`Feb  6 12:14:15 localhost haproxy[14389]: 10.0.1.3:33318 [06/Feb/2009:12:14:15.102] http-in static/srv2 5/0/-1/-1/+3002 503 212 - - SC-- 2/2/0/0/3 0/0 "GET /x HTTP/1.1"`,
+			map[string]string{"reqtime": "5", "conntime": "-1", "resptime": "-1", "duration": "+3002", "status": "503", "reason": "sc--"},
+		},
+		{
+			`Feb  6 12:12:56 localhost haproxy[14387]: 10.0.1.2:33313 [06/Feb/2009:12:12:51.443] fnt bck/srv1 0/0/5007 212 -- 0/0/0/0/3 0/0`,
+			map[string]string{"srcip": "10.0.1.2:33313", "queuetime": "0", "conntime": "0", "duration": "5007", "bytessent": "212", "reason": "--"},
+		},
+	} {
+		seq, err := scanner.ScanHAProxy(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		fields := make(map[string]string)
+		for _, tok := range seq {
+			fields[tok.Tag.String()] = tok.Value
+		}
+
+		for tag, v := range tc.fields {
+			require.Equal(t, v, fields[tag], "%s: %s", tc.msg, tag)
+		}
+	}
+}
+
+func TestParserParseSlowQueries(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+	scanner.SetNormalizeSQL(true)
+
+	for _, file := range []string{"patterns/mysql.txt", "patterns/postgresql.txt"} {
+		pats, err := ReadPatterns(file)
+		require.NoError(t, err)
+
+		for _, pat := range pats {
+			require.NoError(t, parser.AddPattern(pat))
+		}
+	}
+
+	for _, tc := range []struct {
+		sep    string
+		data   string
+		fields []map[string]string
+	}{
+		{
+			SeparatorMySQLSlow,
+			"# Time: 2019-01-07T15:04:05.123456Z\n" +
+				"# User@Host: app[app] @ localhost [127.0.0.1]  Id:    42\n" +
+				"# Query_time: 2.501234  Lock_time: 0.000120 Rows_sent: 1  Rows_examined: 500000\n" +
+				"SET timestamp=1546873445;\n" +
+				"SELECT * FROM orders\n" +
+				"WHERE customer_id = 42;\n" +
+				"# User@Host: app[app] @  [10.0.0.5]  Id:    43\n" +
+				"# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 10\n" +
+				"use appdb;\n" +
+				"SET timestamp=1546873446;\n" +
+				"UPDATE orders SET status = 'paid' WHERE id IN (1, 2, 3);\n",
+			[]map[string]string{
+				{"msgtime": "2019-01-07T15:04:05.123456Z", "srcuser": "app", "srchost": "localhost", "srcip": "127.0.0.1", "sessionid": "42",
+					"duration": "2.501234", "rows": "1", "rowsexamined": "500000", "query": "SELECT * FROM orders WHERE customer_id = ?;"},
+				{"srcuser": "app", "srcip": "10.0.0.5", "sessionid": "43", "duration": "1.000000", "rows": "0", "rowsexamined": "10",
+					"query": "UPDATE orders SET status = ? WHERE id IN (?);"},
+			},
+		},
+		{
+			SeparatorIndent,
+			"2019-01-07 15:04:05 UTC [12345]: user=app,db=appdb,app=psql,client=10.0.0.7 LOG:  duration: 2501.234 ms  statement: SELECT *\n" +
+				"\tFROM orders\n" +
+				"\tWHERE id = 42\n" +
+				"2019-01-07 15:04:06.100 UTC [12346] LOG:  duration: 12.500 ms  execute <unnamed>: SELECT 1\n",
+			[]map[string]string{
+				{"msgtime": "2019-01-07 15:04:05", "sessionid": "12345", "srcuser": "app", "srcip": "10.0.0.7", "duration": "2501.234",
+					"query": "SELECT * FROM orders WHERE id = ?"},
+				{"msgtime": "2019-01-07 15:04:06.100", "sessionid": "12346", "duration": "12.500", "query": "SELECT ?"},
+			},
+		},
+	} {
+		s := NewRecordScanner(strings.NewReader(tc.data), "slow.log", tc.sep, BinaryReplace)
+
+		var i int
+		for s.Scan() {
+			require.True(t, i < len(tc.fields), s.Text())
+
+			seq, err := scanner.Scan(s.Text())
+			require.NoError(t, err, s.Text())
+			seq, err = parser.Parse(seq)
+			require.NoError(t, err, s.Text())
+
+			fields := make(map[string]string)
+			for _, tok := range seq {
+				fields[tok.Tag.String()] = tok.Value
+			}
+
+			for tag, v := range tc.fields[i] {
+				require.Equal(t, v, fields[tag], "%s: %s", s.Text(), tag)
+			}
+
+			i++
+		}
+
+		require.NoError(t, s.Err())
+		require.Equal(t, len(tc.fields), i)
+	}
+}
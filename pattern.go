@@ -0,0 +1,488 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OriginHuman    = "human"    // Pattern is written by a human
+	OriginAnalyzer = "analyzer" // Pattern is generated by the analyzer
+
+	MatchStrict = "strict" // Pattern must consume the whole message
+	MatchPrefix = "prefix" // Pattern may match a prefix of the message
+
+	SessionOpen  = "open"  // Pattern starts a new session
+	SessionClose = "close" // Pattern ends the current session
+
+	// patternMetaPrefix starts a metadata line in a pattern file. Metadata lines
+	// are of the format "#@ key: value", and apply to the next pattern in the file.
+	patternMetaPrefix = "#@"
+)
+
+// Pattern is a single pattern, along with the information about where it came
+// from. A pattern file can record the provenance of each pattern with metadata
+// lines preceding the pattern, for example:
+//
+//	#@ origin: analyzer
+//	#@ owner: security-team
+//	#@ created: 2015-02-23T15:14:04Z
+//	%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2
+//
+// A pattern can also be gated on the value of a field it extracts, so it's only
+// tried for messages where the field has that value, for example:
+//
+//	#@ when: appname = asa
+//	%msgtime% %apphost% %appname% : %string% : built %protocol% connection %sessionid% for %srcip%
+//
+// When the parser reaches the field, only the patterns gated on the extracted
+// value are searched further, which prunes patterns for other vendors from the
+// search and prevents them from matching by accident.
+//
+// By default a pattern must consume the whole message. For sources that append
+// unpredictable free text to their messages, a pattern can be allowed to match a
+// prefix of the message instead, in which case the remainder of the message is
+// returned as a msgrest token:
+//
+//	#@ match: prefix
+//	%msgtime% %apphost% %appname% : vfs root %action%
+//
+// The messages that match a pattern can be sampled when they are written out, to
+// cut the volume of noisy messages without losing the important ones, e.g., only
+// 1 in 100 of the heartbeats below is kept:
+//
+//	#@ sample: 1%
+//	%msgtime% %apphost% %appname% : heartbeat ok
+//
+// A pattern can mark the start or the end of a session, e.g., a connection, so the
+// Sessionizer knows when to assign a new session ID to the related messages:
+//
+//	#@ session: open
+//	%msgtime% %apphost% %appname% [ %sessionid% ] : connection from %srcip% port %srcport%
+//
+// Any other lines that start with "#" are regular comments and are ignored.
+type Pattern struct {
+	Text      string    // Text is the pattern, e.g., "%msgtime% %apphost% ...", with fragments expanded.
+	Source    string    // Source is the file the pattern was read from, if any.
+	Line      int       // Line is the line number of the pattern in the Source file.
+	Namespace string    // Namespace is the namespace of the pattern in the Source file.
+	Origin    string    // Origin is either OriginHuman or OriginAnalyzer.
+	Owner     string    // Owner is the person or team responsible for the pattern.
+	Created   time.Time // Created is when the pattern was created, zero if unknown.
+	When      Condition // When is the condition the message must meet to match the pattern.
+	Match     string    // Match is either MatchStrict or MatchPrefix, empty means MatchStrict.
+	Sample    float64   // Sample is the fraction of matched messages to keep, 0 means all of them.
+	Session   string    // Session is either SessionOpen, SessionClose, or empty if neither.
+	Comments  []string  // Comments are written as comments before the pattern by WritePatterns.
+	Examples  []string  // Examples are messages written as comments after the pattern by WritePatterns.
+}
+
+// Condition requires the token extracted for the field, e.g., "appname", to have
+// the value, e.g., "asa". The value is compared case-insensitively. A condition
+// with an empty field is always met.
+type Condition struct {
+	Field string
+	Value string
+}
+
+// Sampled returns true if the n-th message, starting at 1, that matched the pattern
+// should be kept according to the sample rate. Messages are kept at even intervals,
+// e.g., the 100th, 200th, and so on for a 1% sample rate, so the result doesn't
+// change from one run to the next.
+func (this Pattern) Sampled(n int) bool {
+	if this.Sample == 0 || this.Sample >= 1 {
+		return true
+	}
+
+	return int(float64(n)*this.Sample) > int(float64(n-1)*this.Sample)
+}
+
+// String returns the location of the pattern in the format "source:line" if the
+// source is known, or the pattern text if not.
+func (this Pattern) String() string {
+	if this.Source == "" {
+		return this.Text
+	}
+
+	return fmt.Sprintf("%s:%d", this.Source, this.Line)
+}
+
+// ReadPatterns reads all the patterns in the pattern files, in order. Empty lines
+// and lines starting with "#" are skipped. Patterns without an origin are assumed
+// to be written by a human.
+//
+// Pattern files can be organized using the following directives:
+//
+//	#@ include: shared/syslog.txt
+//	#@ namespace: sshd
+//	#@ fragment header: %msgtime% %apphost% %appname% [ %sessionid% ] :
+//
+// include reads the patterns and fragments of another file, relative to the
+// directory of the current file, at the point of the directive. Each file is read
+// at most once, so shared files can be included from multiple places.
+//
+// namespace sets the namespace of the patterns and fragments that follow it in
+// the current file.
+//
+// fragment defines a piece of pattern that can be referenced in later patterns or
+// fragments as %@name%, e.g., "%@header% session opened for user %dstuser%". A
+// reference is first resolved within the current namespace, e.g., %@header% in
+// the sshd namespace refers to sshd.header, and then as a fully qualified name.
+func ReadPatterns(files ...string) ([]Pattern, error) {
+	pr := newPatternReader()
+
+	for _, file := range files {
+		if err := pr.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return pr.pats, nil
+}
+
+// WritePatterns writes the patterns to w in the pattern file format, so they can
+// be read back with ReadPatterns. Each pattern is written as its comments, its
+// metadata lines, the pattern text, and its examples, followed by an empty line.
+// Empty metadata is not written. The Source, Line and Namespace of the patterns
+// are not written, since the text already has the fragments expanded.
+//
+// An error is returned, and nothing is written, if any of the patterns can't be
+// read back as is, e.g., the text is empty or starts with "#", or a comment, an
+// example or a metadata value spans multiple lines.
+func WritePatterns(w io.Writer, pats ...Pattern) error {
+	var buf bytes.Buffer
+
+	for _, pat := range pats {
+		if err := pat.write(&buf); err != nil {
+			return err
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func (this Pattern) write(buf *bytes.Buffer) error {
+	text := strings.TrimSpace(this.Text)
+	if text == "" || text[0] == '#' || strings.Contains(text, "%@") || strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("Invalid pattern %q", this.Text)
+	}
+
+	for _, c := range this.Comments {
+		if strings.ContainsAny(c, "\r\n") {
+			return fmt.Errorf("Invalid pattern comment %q: must be a single line", c)
+		}
+		fmt.Fprintf(buf, "# %s\n", c)
+	}
+
+	meta, err := this.meta()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range meta {
+		fmt.Fprintf(buf, "%s %s: %s\n", patternMetaPrefix, m[0], m[1])
+	}
+
+	fmt.Fprintf(buf, "%s\n", text)
+
+	for _, ex := range this.Examples {
+		if strings.ContainsAny(ex, "\r\n") {
+			return fmt.Errorf("Invalid pattern example %q: must be a single line", ex)
+		}
+		fmt.Fprintf(buf, "# %s\n", ex)
+	}
+
+	buf.WriteString("\n")
+
+	return nil
+}
+
+// meta returns the key and value of each metadata line of the pattern, checking
+// that each one is read back the same way.
+func (this Pattern) meta() ([][2]string, error) {
+	var meta [][2]string
+
+	if this.Origin != "" {
+		meta = append(meta, [2]string{"origin", this.Origin})
+	}
+
+	if this.Owner != "" {
+		meta = append(meta, [2]string{"owner", this.Owner})
+	}
+
+	if !this.Created.IsZero() {
+		meta = append(meta, [2]string{"created", this.Created.Format(time.RFC3339)})
+	}
+
+	if this.When.Field != "" {
+		if strings.Contains(this.When.Field, "=") {
+			return nil, fmt.Errorf("Invalid pattern condition field %q", this.When.Field)
+		}
+		meta = append(meta, [2]string{"when", this.When.Field + " = " + this.When.Value})
+	}
+
+	if this.Match != "" {
+		meta = append(meta, [2]string{"match", this.Match})
+	}
+
+	if this.Sample > 0 && this.Sample < 1 {
+		meta = append(meta, [2]string{"sample", strconv.FormatFloat(this.Sample, 'g', -1, 64)})
+	}
+
+	if this.Session != "" {
+		meta = append(meta, [2]string{"session", this.Session})
+	}
+
+	var pat Pattern
+
+	for _, m := range meta {
+		if strings.ContainsAny(m[1], "\r\n") || m[1] != strings.TrimSpace(m[1]) {
+			return nil, fmt.Errorf("Invalid pattern %s %q: must be a single line", m[0], m[1])
+		}
+
+		if err := pat.setMeta(m[0], m[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
+
+func readPatterns(r io.Reader, source string) ([]Pattern, error) {
+	pr := newPatternReader()
+
+	if err := pr.read(r, source); err != nil {
+		return nil, err
+	}
+
+	return pr.pats, nil
+}
+
+type patternReader struct {
+	pats      []Pattern
+	fragments map[string]string
+	seen      map[string]bool
+
+	// open opens the pattern file, replaceable for testing
+	open func(string) (io.ReadCloser, error)
+}
+
+func newPatternReader() *patternReader {
+	return &patternReader{
+		fragments: make(map[string]string),
+		seen:      make(map[string]bool),
+		open: func(file string) (io.ReadCloser, error) {
+			return os.Open(file)
+		},
+	}
+}
+
+func (this *patternReader) readFile(file string) error {
+	file = filepath.Clean(file)
+	if this.seen[file] {
+		return nil
+	}
+	this.seen[file] = true
+
+	f, err := this.open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return this.read(f, file)
+}
+
+func (this *patternReader) read(r io.Reader, source string) error {
+	var (
+		pat = Pattern{Source: source, Origin: OriginHuman}
+		ns  string
+		n   int
+	)
+
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+
+		if strings.HasPrefix(line, patternMetaPrefix) {
+			if err := this.directive(line[len(patternMetaPrefix):], source, &ns, &pat); err != nil {
+				return fmt.Errorf("Error parsing %s:%d: %v", source, n, err)
+			}
+			continue
+		}
+
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		text, err := this.expand(line, ns)
+		if err != nil {
+			return fmt.Errorf("Error parsing %s:%d: %v", source, n, err)
+		}
+
+		pat.Text = text
+		pat.Line = n
+		pat.Namespace = ns
+		this.pats = append(this.pats, pat)
+
+		pat = Pattern{Source: source, Origin: OriginHuman}
+	}
+
+	return s.Err()
+}
+
+func (this *patternReader) directive(s, source string, ns *string, pat *Pattern) error {
+	i := strings.Index(s, ":")
+	if i == -1 {
+		return fmt.Errorf("Invalid pattern metadata %q: expecting \"key: value\"", s)
+	}
+
+	key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+
+	switch {
+	case key == "include":
+		if !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(source), value)
+		}
+		return this.readFile(value)
+
+	case key == "namespace":
+		*ns = value
+
+	case strings.HasPrefix(key, "fragment "):
+		name := strings.TrimSpace(key[len("fragment "):])
+		text, err := this.expand(value, *ns)
+		if err != nil {
+			return err
+		}
+		this.fragments[qualifyName(*ns, name)] = text
+
+	default:
+		return pat.setMeta(key, value)
+	}
+
+	return nil
+}
+
+// expand replaces all the %@name% fragment references in s with the fragments.
+func (this *patternReader) expand(s, ns string) (string, error) {
+	for {
+		i := strings.Index(s, "%@")
+		if i == -1 {
+			return s, nil
+		}
+
+		j := strings.Index(s[i+2:], "%")
+		if j == -1 {
+			return "", fmt.Errorf("Invalid fragment reference in %q: missing closing %%", s)
+		}
+
+		name := s[i+2 : i+2+j]
+
+		text, ok := this.fragments[qualifyName(ns, name)]
+		if !ok {
+			if text, ok = this.fragments[name]; !ok {
+				return "", fmt.Errorf("Unknown fragment %q", name)
+			}
+		}
+
+		s = s[:i] + text + s[i+2+j+1:]
+	}
+}
+
+func qualifyName(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+
+	return ns + "." + name
+}
+
+func (this *Pattern) setMeta(key, value string) error {
+	switch key {
+	case "origin":
+		if value != OriginHuman && value != OriginAnalyzer {
+			return fmt.Errorf("Invalid pattern origin %q", value)
+		}
+		this.Origin = value
+
+	case "owner":
+		this.Owner = value
+
+	case "created":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("Invalid pattern creation time %q: %v", value, err)
+		}
+		this.Created = t
+
+	case "when":
+		i := strings.Index(value, "=")
+		if i == -1 {
+			return fmt.Errorf("Invalid pattern condition %q: expecting \"field = value\"", value)
+		}
+
+		field, v := strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+		if field == "" || v == "" {
+			return fmt.Errorf("Invalid pattern condition %q: expecting \"field = value\"", value)
+		}
+
+		this.When = Condition{Field: field, Value: strings.ToLower(v)}
+
+	case "match":
+		if value != MatchStrict && value != MatchPrefix {
+			return fmt.Errorf("Invalid pattern match mode %q", value)
+		}
+		this.Match = value
+
+	case "sample":
+		v, scale := value, 1.0
+		if strings.HasSuffix(v, "%") {
+			v, scale = strings.TrimSpace(v[:len(v)-1]), 100
+		}
+
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate/scale > 1 {
+			return fmt.Errorf("Invalid pattern sample rate %q: expecting a rate between 0 and 1, or 0%% and 100%%", value)
+		}
+		this.Sample = rate / scale
+
+	case "session":
+		if value != SessionOpen && value != SessionClose {
+			return fmt.Errorf("Invalid pattern session marker %q", value)
+		}
+		this.Session = value
+
+	default:
+		return fmt.Errorf("Unknown pattern metadata %q", key)
+	}
+
+	return nil
+}
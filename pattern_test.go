@@ -0,0 +1,216 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	patternfile = `# sshd patterns
+#@ origin: analyzer
+#@ owner: security-team
+#@ created: 2015-02-23T15:14:04Z
+#@ match: prefix
+%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2
+# Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2
+
+#@ when: appname = SSHD
+%msgtime% %apphost% %appname% [ %sessionid% ] : pam_unix ( sshd : %string% ) : check pass ; user %srcuser%
+`
+)
+
+func TestPatternReadPatterns(t *testing.T) {
+	pats, err := readPatterns(strings.NewReader(patternfile), "sshd.txt")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pats))
+
+	require.Equal(t, 6, pats[0].Line)
+	require.Equal(t, OriginAnalyzer, pats[0].Origin)
+	require.Equal(t, "security-team", pats[0].Owner)
+	require.True(t, time.Date(2015, time.February, 23, 15, 14, 4, 0, time.UTC).Equal(pats[0].Created))
+	require.Equal(t, "sshd.txt:6", pats[0].String())
+	require.Equal(t, MatchPrefix, pats[0].Match)
+
+	require.Equal(t, 10, pats[1].Line)
+	require.Equal(t, "", pats[1].Match)
+	require.Equal(t, OriginHuman, pats[1].Origin)
+	require.Equal(t, "", pats[1].Owner)
+	require.True(t, pats[1].Created.IsZero())
+	require.Equal(t, Condition{Field: "appname", Value: "sshd"}, pats[1].When)
+}
+
+func TestPatternReadPatternsWindows(t *testing.T) {
+	data := "\ufeff" + strings.Replace(patternfile, "\n", "\r\n", -1)
+
+	pats, err := readPatterns(strings.NewReader(data), "sshd.txt")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pats))
+	require.Equal(t, OriginAnalyzer, pats[0].Origin)
+	require.False(t, strings.HasSuffix(pats[1].Text, "\r"))
+}
+
+func TestPatternSample(t *testing.T) {
+	pats, err := readPatterns(strings.NewReader("#@ sample: 1%\n%msgtime% heartbeat\n#@ sample: 0.25\n%msgtime% debug\n%msgtime% error\n"), "test.txt")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(pats))
+	require.Equal(t, 0.01, pats[0].Sample)
+	require.Equal(t, 0.25, pats[1].Sample)
+	require.Equal(t, 0.0, pats[2].Sample)
+
+	for i, want := range []int{10, 250, 1000} {
+		kept := 0
+		for n := 1; n <= 1000; n++ {
+			if pats[i].Sampled(n) {
+				kept++
+			}
+		}
+		require.Equal(t, want, kept, pats[i].Text)
+	}
+
+	require.False(t, pats[1].Sampled(3))
+	require.True(t, pats[1].Sampled(4))
+}
+
+func TestPatternReadPatternsInvalidMeta(t *testing.T) {
+	for _, data := range []string{
+		"#@ origin: robot\n%msgtime%",
+		"#@ created: yesterday\n%msgtime%",
+		"#@ color: blue\n%msgtime%",
+		"#@ owner\n%msgtime%",
+		"#@ when: appname\n%msgtime%",
+		"#@ when: = asa\n%msgtime%",
+		"#@ match: suffix\n%msgtime%",
+		"#@ sample: often\n%msgtime%",
+		"#@ sample: 0\n%msgtime%",
+		"#@ sample: 150%\n%msgtime%",
+		"#@ session: begin\n%msgtime%",
+	} {
+		_, err := readPatterns(strings.NewReader(data), "test.txt")
+		require.Error(t, err, data)
+	}
+}
+
+var (
+	includefiles = map[string]string{
+		"patterns/main.txt": `#@ include: shared/syslog.txt
+#@ include: sshd.txt
+#@ include: shared/syslog.txt
+%@syslog.header% vfs root %action%
+`,
+		"patterns/sshd.txt": `#@ namespace: sshd
+#@ include: shared/syslog.txt
+#@ fragment prefix: %@syslog.header% [ %sessionid% ] :
+%@prefix% check pass ; user %srcuser%
+`,
+		"patterns/shared/syslog.txt": `#@ namespace: syslog
+#@ fragment header: %msgtime% %apphost% %appname%
+`,
+	}
+)
+
+func TestPatternReadPatternsInclude(t *testing.T) {
+	pr := newPatternReader()
+	pr.open = func(file string) (io.ReadCloser, error) {
+		data, ok := includefiles[file]
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return ioutil.NopCloser(strings.NewReader(data)), nil
+	}
+
+	require.NoError(t, pr.readFile("patterns/main.txt"))
+	require.Equal(t, 2, len(pr.pats))
+
+	require.Equal(t, "%msgtime% %apphost% %appname% [ %sessionid% ] : check pass ; user %srcuser%", pr.pats[0].Text)
+	require.Equal(t, "sshd", pr.pats[0].Namespace)
+	require.Equal(t, "patterns/sshd.txt:4", pr.pats[0].String())
+
+	require.Equal(t, "%msgtime% %apphost% %appname% vfs root %action%", pr.pats[1].Text)
+	require.Equal(t, "", pr.pats[1].Namespace)
+	require.Equal(t, "patterns/main.txt:4", pr.pats[1].String())
+
+	_, err := readPatterns(strings.NewReader("%@missing% vfs root %action%"), "test.txt")
+	require.Error(t, err)
+}
+
+func TestPatternWritePatterns(t *testing.T) {
+	pats, err := readPatterns(strings.NewReader(patternfile), "sshd.txt")
+	require.NoError(t, err)
+
+	pats[0].Comments = []string{"1 log messages matched"}
+	pats[0].Examples = []string{"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"}
+	pats[1].Sample = 0.01
+	pats[1].Session = SessionOpen
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePatterns(&buf, pats...))
+	require.Equal(t, `# 1 log messages matched
+#@ origin: analyzer
+#@ owner: security-team
+#@ created: 2015-02-23T15:14:04Z
+#@ match: prefix
+%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcip% port %srcport% ssh2
+# Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2
+
+#@ origin: human
+#@ when: appname = sshd
+#@ sample: 0.01
+#@ session: open
+%msgtime% %apphost% %appname% [ %sessionid% ] : pam_unix ( sshd : %string% ) : check pass ; user %srcuser%
+
+`, buf.String())
+
+	pats2, err := readPatterns(&buf, "sshd.txt")
+	require.NoError(t, err)
+	require.Equal(t, len(pats), len(pats2))
+
+	for i := range pats {
+		require.Equal(t, pats[i].Text, pats2[i].Text)
+		require.Equal(t, pats[i].Origin, pats2[i].Origin)
+		require.Equal(t, pats[i].Owner, pats2[i].Owner)
+		require.True(t, pats[i].Created.Equal(pats2[i].Created))
+		require.Equal(t, pats[i].When, pats2[i].When)
+		require.Equal(t, pats[i].Match, pats2[i].Match)
+		require.Equal(t, pats[i].Sample, pats2[i].Sample)
+		require.Equal(t, pats[i].Session, pats2[i].Session)
+	}
+}
+
+func TestPatternWritePatternsInvalid(t *testing.T) {
+	for _, pat := range []Pattern{
+		{Text: ""},
+		{Text: "# %msgtime%"},
+		{Text: "%@header% vfs root %action%"},
+		{Text: "%msgtime%\n%apphost%"},
+		{Text: "%msgtime%", Origin: "robot"},
+		{Text: "%msgtime%", Owner: "security\nteam"},
+		{Text: "%msgtime%", Comments: []string{"line one\nline two"}},
+		{Text: "%msgtime%", Examples: []string{"Jan 12\n06:49:42"}},
+		{Text: "%msgtime%", When: Condition{Field: "appname"}},
+		{Text: "%msgtime%", Match: "suffix"},
+	} {
+		var buf bytes.Buffer
+		require.Error(t, WritePatterns(&buf, Pattern{Text: "%msgtime% ok"}, pat), pat.Text)
+		require.Equal(t, 0, buf.Len())
+	}
+}
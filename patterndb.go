@@ -0,0 +1,656 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// PatternDBVersion is the version of the pattern database format written by
+	// this package. Databases of older versions are migrated when opened.
+	PatternDBVersion = 1
+
+	// PatternDBManifest is the name of the manifest file in a pattern database.
+	PatternDBManifest = "MANIFEST.json"
+
+	// PatternDBSignature is the name of the signature file in a signed pattern
+	// database, which holds the ed25519 signature of the manifest.
+	PatternDBSignature = "MANIFEST.sig"
+)
+
+// patternDBMigrations upgrade the manifest of a pattern database from the version
+// at the index to the next one. When the format changes, PatternDBVersion is
+// increased and a migration is added here, so older databases can still be read.
+var patternDBMigrations = []func(*PatternDB) error{
+	// 0 is not a version, databases start at version 1
+	nil,
+}
+
+// PatternDB is a directory of pattern files along with a manifest, which records
+// the version of the format and a checksum of each file, so a curated set of
+// pattern files can be distributed as a single bundle and verified before it's
+// used. The manifest is a json file named MANIFEST.json at the top of the
+// directory, for example:
+//
+//	{
+//	  "version": 1,
+//	  "created": "2015-02-23T15:14:04Z",
+//	  "files": [
+//	    {"path": "shared/syslog.txt", "size": 72, "sha256": "8f43..."},
+//	    {"path": "sshd.txt", "size": 1280, "sha256": "2c26..."}
+//	  ]
+//	}
+//
+// A database can be signed with an ed25519 private key, in which case the base64
+// encoded signature of the manifest is kept in MANIFEST.sig. Since the manifest
+// has the checksums of all the files, verifying the signature of the manifest and
+// then the checksums ensures none of the files have been changed.
+//
+// Like a plain directory of pattern files, the patterns of a database are read
+// from the files at the top of the directory. Files in subdirectories are only
+// read when they are included by one of those files.
+type PatternDB struct {
+	Dir     string          `json:"-"`       // Dir is the directory of the database.
+	Version int             `json:"version"` // Version is the version of the format.
+	Created time.Time       `json:"created"` // Created is when the database was created.
+	Files   []PatternDBFile `json:"files"`   // Files are the pattern files, sorted by path.
+
+	// manifest is the manifest as read or signed, signature is its signature
+	manifest  []byte
+	signature []byte
+}
+
+// PatternDBFile is a single file of a pattern database.
+type PatternDBFile struct {
+	Path   string `json:"path"`   // Path is the slash separated path of the file, relative to the directory.
+	Size   int64  `json:"size"`   // Size is the size of the file in bytes.
+	SHA256 string `json:"sha256"` // SHA256 is the hex encoded SHA-256 checksum of the file.
+}
+
+// NewPatternDB creates the manifest of a pattern database for all the files in
+// the directory and its subdirectories, except for hidden files and any existing
+// manifest. The manifest is not written until Save is called.
+func NewPatternDB(dir string) (*PatternDB, error) {
+	db := &PatternDB{
+		Dir:     dir,
+		Version: PatternDBVersion,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if file != dir && strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if rel == PatternDBManifest || rel == PatternDBSignature {
+			return nil
+		}
+
+		sum, err := checksumFile(file)
+		if err != nil {
+			return err
+		}
+
+		db.Files = append(db.Files, PatternDBFile{Path: rel, Size: fi.Size(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(patternDBFiles(db.Files))
+
+	return db, nil
+}
+
+// OpenPatternDB reads the manifest of the pattern database in the directory,
+// migrating it to the current version if needed, and verifies the checksums of
+// all the files.
+func OpenPatternDB(dir string) (*PatternDB, error) {
+	file := filepath.Join(dir, PatternDBManifest)
+
+	manifest, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &PatternDB{manifest: manifest}
+
+	if err := json.Unmarshal(manifest, db); err != nil {
+		return nil, fmt.Errorf("Error reading pattern database manifest %s: %v", file, err)
+	}
+
+	db.Dir = dir
+
+	if err := db.readSignature(); err != nil {
+		return nil, err
+	}
+
+	if err := db.migrate(); err != nil {
+		return nil, err
+	}
+
+	if err := db.Verify(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// IsPatternDB returns true if the directory contains a pattern database manifest.
+func IsPatternDB(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, PatternDBManifest))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (this *PatternDB) migrate() error {
+	if this.Version <= 0 || this.Version > PatternDBVersion {
+		return fmt.Errorf("Invalid pattern database version %d: expecting a version between 1 and %d", this.Version, PatternDBVersion)
+	}
+
+	for this.Version < PatternDBVersion {
+		if err := patternDBMigrations[this.Version](this); err != nil {
+			return fmt.Errorf("Error migrating pattern database from version %d: %v", this.Version, err)
+		}
+		this.Version++
+	}
+
+	return nil
+}
+
+// Verify checks that all the files in the manifest exist, and have the recorded
+// size and checksum.
+func (this *PatternDB) Verify() error {
+	for _, f := range this.Files {
+		if err := checkDBPath(f.Path); err != nil {
+			return err
+		}
+
+		file := filepath.Join(this.Dir, filepath.FromSlash(f.Path))
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		if fi.Size() != f.Size {
+			return fmt.Errorf("Invalid pattern database file %s: size is %d, expecting %d", f.Path, fi.Size(), f.Size)
+		}
+
+		sum, err := checksumFile(file)
+		if err != nil {
+			return err
+		}
+
+		if sum != f.SHA256 {
+			return fmt.Errorf("Invalid pattern database file %s: checksum is %s, expecting %s", f.Path, sum, f.SHA256)
+		}
+	}
+
+	return nil
+}
+
+// Save writes the manifest, and the signature if the database is signed, to the
+// directory of the database.
+func (this *PatternDB) Save() error {
+	manifest, err := this.manifestData()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(this.Dir, PatternDBManifest), manifest, 0644); err != nil {
+		return err
+	}
+
+	if this.signature == nil {
+		return nil
+	}
+
+	return ioutil.WriteFile(filepath.Join(this.Dir, PatternDBSignature), this.signatureData(), 0644)
+}
+
+// manifestData returns the manifest as it was read or signed, so the signature
+// still matches, or the current manifest otherwise.
+func (this *PatternDB) manifestData() ([]byte, error) {
+	if this.manifest != nil {
+		return this.manifest, nil
+	}
+
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+func (this *PatternDB) signatureData() []byte {
+	return []byte(base64.StdEncoding.EncodeToString(this.signature) + "\n")
+}
+
+// Patterns reads the patterns in the files at the top of the database directory,
+// in order of their paths.
+func (this *PatternDB) Patterns() ([]Pattern, error) {
+	var files []string
+
+	for _, f := range this.Files {
+		if !strings.Contains(f.Path, "/") {
+			files = append(files, filepath.Join(this.Dir, f.Path))
+		}
+	}
+
+	return ReadPatterns(files...)
+}
+
+// Pack writes the manifest and the files of the database to w as a gzipped tar
+// bundle, which can be unpacked with UnpackPatternDB.
+func (this *PatternDB) Pack(w io.Writer) error {
+	manifest, err := this.manifestData()
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := this.packData(tw, PatternDBManifest, manifest); err != nil {
+		return err
+	}
+
+	if this.signature != nil {
+		if err := this.packData(tw, PatternDBSignature, this.signatureData()); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range this.Files {
+		if err := this.packFile(tw, f); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func (this *PatternDB) packData(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: this.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(data)
+	return err
+}
+
+func (this *PatternDB) packFile(tw *tar.Writer, f PatternDBFile) error {
+	file, err := os.Open(filepath.Join(this.Dir, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hdr := &tar.Header{Name: f.Path, Mode: 0644, Size: f.Size, ModTime: this.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(tw, file, f.Size); err != nil {
+		return fmt.Errorf("Error packing pattern database file %s: %v", f.Path, err)
+	}
+
+	return nil
+}
+
+// UnpackPatternDB unpacks a bundle written by Pack into the directory, and opens
+// the database, which verifies the files against the manifest. The bundle is
+// unpacked into a temporary directory next to dir first, so a database that's
+// already in dir is only replaced once the new one has been verified. If dir
+// already exists, it must be a pattern database or an empty directory.
+//
+// If any keys are given, the bundle must also be signed by one of them.
+func UnpackPatternDB(r io.Reader, dir string, keys ...ed25519.PublicKey) (*PatternDB, error) {
+	if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 && !IsPatternDB(dir) {
+		return nil, fmt.Errorf("Invalid pattern database directory %s: directory is not empty", dir)
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(filepath.Clean(dir)), "."+filepath.Base(dir)+".")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := unpackBundle(r, tmp); err != nil {
+		return nil, err
+	}
+
+	db, err := OpenPatternDB(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		if err := db.VerifySignature(keys...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the files in the manifest are verified, so any other file in the bundle
+	// could have been added after it was packed
+	if n, err := countFiles(tmp); err != nil {
+		return nil, err
+	} else if n -= db.extraFiles(); n != len(db.Files) {
+		return nil, fmt.Errorf("Invalid pattern database bundle: bundle has %d files, manifest has %d", n, len(db.Files))
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, err
+	}
+
+	db.Dir = dir
+
+	return db, nil
+}
+
+// extraFiles returns the number of files in the database directory that are not
+// in the manifest, i.e., the manifest and the signature.
+func (this *PatternDB) extraFiles() int {
+	if this.signature != nil {
+		return 2
+	}
+	return 1
+}
+
+func unpackBundle(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("Invalid pattern database bundle: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Invalid pattern database bundle: %v", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("Invalid pattern database bundle entry %q: only regular files are supported", hdr.Name)
+		}
+
+		if err := checkDBPath(hdr.Name); err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+
+		if err != nil {
+			return fmt.Errorf("Error unpacking pattern database file %s: %v", hdr.Name, err)
+		}
+	}
+}
+
+// checkDBPath returns an error if the path isn't a clean relative path inside the
+// database directory.
+func checkDBPath(p string) error {
+	if p == "" || p == "." || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "\\") {
+		return fmt.Errorf("Invalid pattern database path %q", p)
+	}
+
+	return nil
+}
+
+func checksumFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func countFiles(dir string) (int, error) {
+	n := 0
+
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			n++
+		}
+		return err
+	})
+
+	return n, err
+}
+
+// Sign signs the manifest of the database with the private key. The files of the
+// database must not be changed after it's signed, since the signature only covers
+// the manifest as it is when signed.
+func (this *PatternDB) Sign(key ed25519.PrivateKey) error {
+	this.manifest = nil
+
+	manifest, err := this.manifestData()
+	if err != nil {
+		return err
+	}
+
+	this.manifest = manifest
+	this.signature = ed25519.Sign(key, manifest)
+
+	return nil
+}
+
+// Signed returns true if the database has a signature, which may not be valid.
+func (this *PatternDB) Signed() bool {
+	return this.signature != nil
+}
+
+// VerifySignature returns nil if the database is signed by one of the keys, or
+// an error if it's unsigned or signed by none of them.
+func (this *PatternDB) VerifySignature(keys ...ed25519.PublicKey) error {
+	if this.signature == nil {
+		return fmt.Errorf("Invalid pattern database %s: database is not signed", this.Dir)
+	}
+
+	manifest, err := this.manifestData()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key, manifest, this.signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Invalid pattern database %s: signature doesn't match any of the %d trusted keys", this.Dir, len(keys))
+}
+
+func (this *PatternDB) readSignature() error {
+	file := filepath.Join(this.Dir, PatternDBSignature)
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("Invalid pattern database signature %s", file)
+	}
+
+	this.signature = sig
+
+	return nil
+}
+
+// GenerateSigningKey generates a new ed25519 key pair, and returns the private
+// and public keys PEM encoded, so they can be saved and read back with
+// ReadSigningKey and ReadTrustedKeys.
+func GenerateSigningKey() (private, public []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privder, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubder, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privder}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubder}), nil
+}
+
+// ReadSigningKey reads a PEM encoded ed25519 private key from the file.
+func ReadSigningKey(file string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("Invalid signing key %s: expecting a PEM encoded private key", file)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signing key %s: %v", file, err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Invalid signing key %s: expecting an ed25519 key", file)
+	}
+
+	return priv, nil
+}
+
+// ReadTrustedKeys reads all the PEM encoded ed25519 public keys in the file.
+func ReadTrustedKeys(file string) ([]ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ed25519.PublicKey
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted key in %s: %v", file, err)
+		}
+
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("Invalid trusted key in %s: expecting an ed25519 key", file)
+		}
+
+		keys = append(keys, pub)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Invalid trusted keys %s: expecting one or more PEM encoded public keys", file)
+	}
+
+	return keys, nil
+}
+
+type patternDBFiles []PatternDBFile
+
+func (this patternDBFiles) Len() int           { return len(this) }
+func (this patternDBFiles) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this patternDBFiles) Less(i, j int) bool { return this[i].Path < this[j].Path }
@@ -0,0 +1,193 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePatternDBFiles(t *testing.T, dir string) {
+	for name, data := range includefiles {
+		file := filepath.Join(dir, filepath.FromSlash(name[len("patterns/"):]))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(data), 0644))
+	}
+}
+
+func TestPatternDBPackUnpack(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "patterndb")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	writePatternDBFiles(t, src)
+
+	db, err := NewPatternDB(src)
+	require.NoError(t, err)
+	require.Equal(t, PatternDBVersion, db.Version)
+	require.Equal(t, 3, len(db.Files))
+	require.Equal(t, "main.txt", db.Files[0].Path)
+	require.Equal(t, "shared/syslog.txt", db.Files[1].Path)
+	require.Equal(t, "sshd.txt", db.Files[2].Path)
+
+	var bundle bytes.Buffer
+	require.NoError(t, db.Pack(&bundle))
+
+	dst := filepath.Join(tmp, "dst")
+	db2, err := UnpackPatternDB(bytes.NewReader(bundle.Bytes()), dst)
+	require.NoError(t, err)
+	require.Equal(t, db.Files, db2.Files)
+	require.True(t, IsPatternDB(dst))
+
+	pats, err := db2.Patterns()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pats))
+
+	// Unpacking again replaces the existing database
+	_, err = UnpackPatternDB(bytes.NewReader(bundle.Bytes()), dst)
+	require.NoError(t, err)
+
+	_, err = OpenPatternDB(dst)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dst, "sshd.txt"), []byte("%msgtime% changed\n"), 0644))
+	_, err = OpenPatternDB(dst)
+	require.Error(t, err)
+
+	// A directory that isn't a pattern database is never replaced
+	_, err = UnpackPatternDB(bytes.NewReader(bundle.Bytes()), src)
+	require.Error(t, err)
+}
+
+func TestPatternDBOpenVersion(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "patterndb")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	for _, manifest := range []string{
+		`{"version": 0, "files": []}`,
+		`{"version": 99, "files": []}`,
+		`{"version": 1, "files": [{"path": "../sshd.txt"}]}`,
+		`not json`,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, PatternDBManifest), []byte(manifest), 0644))
+		_, err := OpenPatternDB(tmp)
+		require.Error(t, err, manifest)
+	}
+}
+
+func TestPatternDBUnpackInvalid(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "patterndb")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{"../escape.txt", "/abs.txt", "extra.txt"} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		for _, f := range []struct{ name, data string }{
+			{PatternDBManifest, `{"version": 1, "files": []}`},
+			{name, "%msgtime%\n"},
+		} {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}))
+			_, err := tw.Write([]byte(f.data))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+
+		_, err := UnpackPatternDB(&buf, filepath.Join(tmp, "dst"))
+		require.Error(t, err, name)
+	}
+
+	_, err = UnpackPatternDB(bytes.NewReader([]byte("not a bundle")), filepath.Join(tmp, "dst"))
+	require.Error(t, err)
+}
+
+func TestPatternDBSign(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "patterndb")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	priv, pub, err := GenerateSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, "key"), priv, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, "key.pub"), pub, 0644))
+
+	_, other, err := GenerateSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, "other.pub"), other, 0644))
+
+	key, err := ReadSigningKey(filepath.Join(tmp, "key"))
+	require.NoError(t, err)
+	keys, err := ReadTrustedKeys(filepath.Join(tmp, "key.pub"))
+	require.NoError(t, err)
+	otherkeys, err := ReadTrustedKeys(filepath.Join(tmp, "other.pub"))
+	require.NoError(t, err)
+
+	_, err = ReadTrustedKeys(filepath.Join(tmp, "key"))
+	require.Error(t, err)
+
+	src := filepath.Join(tmp, "src")
+	writePatternDBFiles(t, src)
+
+	db, err := NewPatternDB(src)
+	require.NoError(t, err)
+
+	var unsigned bytes.Buffer
+	require.NoError(t, db.Pack(&unsigned))
+
+	require.NoError(t, db.Sign(key))
+	require.NoError(t, db.VerifySignature(keys...))
+	require.Error(t, db.VerifySignature(otherkeys...))
+
+	var signed bytes.Buffer
+	require.NoError(t, db.Pack(&signed))
+
+	dst := filepath.Join(tmp, "dst")
+
+	_, err = UnpackPatternDB(bytes.NewReader(unsigned.Bytes()), dst, keys...)
+	require.Error(t, err)
+	_, err = UnpackPatternDB(bytes.NewReader(signed.Bytes()), dst, otherkeys...)
+	require.Error(t, err)
+	require.False(t, IsPatternDB(dst))
+
+	_, err = UnpackPatternDB(bytes.NewReader(signed.Bytes()), dst, keys...)
+	require.NoError(t, err)
+
+	db2, err := OpenPatternDB(dst)
+	require.NoError(t, err)
+	require.True(t, db2.Signed())
+	require.NoError(t, db2.VerifySignature(append(otherkeys, keys...)...))
+
+	// Changing the manifest invalidates the signature
+	data, err := ioutil.ReadFile(filepath.Join(dst, PatternDBManifest))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dst, PatternDBManifest), append(data, '\n'), 0644))
+
+	db2, err = OpenPatternDB(dst)
+	require.NoError(t, err)
+	require.Error(t, db2.VerifySignature(keys...))
+}
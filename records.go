@@ -0,0 +1,344 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	SeparatorNewline = "newline" // Each line is a record
+	SeparatorBlank   = "blank"   // Records are separated by one or more blank lines
+	SeparatorNUL     = "nul"     // Records are separated by NUL bytes
+	SeparatorOctet   = "octet"   // Records are prefixed by their length, as in RFC 6587 octet counting
+	SeparatorIndent  = "indent"  // Lines starting with a space or tab continue the record before them
+
+	SeparatorMySQLSlow = "mysql-slow" // Records are the entries of a MySQL slow query log
+
+	BinarySkip    = "skip"    // Binary bytes are removed from the record
+	BinaryReplace = "replace" // Binary bytes are replaced with the Unicode replacement character
+	BinaryHex     = "hex"     // Binary bytes are hex-encoded, e.g., \x00
+
+	// utf8BOM is the byte order mark some Windows programs write at the start of
+	// UTF-8 files.
+	utf8BOM = "\ufeff"
+)
+
+// SplitRecords returns a split function for bufio.Scanner that splits the input
+// into records using the separator. The separator is either one of SeparatorNewline,
+// SeparatorBlank, SeparatorNUL and SeparatorOctet, or a literal marker, e.g., "----",
+// that appears between records. An empty separator is the same as SeparatorNewline.
+//
+// SeparatorIndent reads records whose continuation lines are indented, such as the
+// multi-line statements in PostgreSQL logs or Java stack traces.
+//
+// SeparatorMySQLSlow reads the entries of a MySQL slow query log, see
+// splitMySQLSlow.
+//
+// SeparatorOctet reads records framed using the octet counting method of RFC 6587,
+// e.g., "17 <34>1 - host app -", as captured from syslog senders over TCP, so
+// records with embedded line breaks are not truncated. Line breaks between frames
+// are ignored.
+//
+// A UTF-8 byte order mark at the start of the input is removed, and so are the
+// carriage returns of CRLF line endings, so files produced on Windows read the
+// same as any other.
+//
+// Multi-line records, such as sar blocks or formatted reports, are returned as a
+// single record with the line breaks kept. The scanner treats the line breaks as
+// whitespace, so each record is tokenized as one message. Leading and trailing
+// line breaks are removed from each record.
+func SplitRecords(sep string) bufio.SplitFunc {
+	split := splitRecordsBy(sep)
+	first := true
+
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if first {
+			if len(data) < len(utf8BOM) && !atEOF {
+				// Request more data
+				return 0, nil, nil
+			}
+
+			first = false
+
+			if bytes.HasPrefix(data, []byte(utf8BOM)) {
+				return len(utf8BOM), nil, nil
+			}
+		}
+
+		return split(data, atEOF)
+	}
+}
+
+func splitRecordsBy(sep string) bufio.SplitFunc {
+	switch sep {
+	case "", SeparatorNewline:
+		return bufio.ScanLines
+
+	case SeparatorBlank:
+		return splitRecords(indexBlank)
+
+	case SeparatorNUL:
+		sep = "\x00"
+
+	case SeparatorOctet:
+		return splitOctets
+
+	case SeparatorIndent:
+		return splitRecords(indexUnindented)
+
+	case SeparatorMySQLSlow:
+		return splitMySQLSlow
+	}
+
+	marker := []byte(sep)
+
+	return splitRecords(func(data []byte) (int, int) {
+		return bytes.Index(data, marker), len(marker)
+	})
+}
+
+// splitRecords returns a split function that splits the input at the separators
+// found by index. index returns the position and length of the first separator in
+// data, or -1 if there's none.
+func splitRecords(index func([]byte) (int, int)) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if i, n := index(data); i != -1 {
+			return i + n, bytes.Trim(data[:i], "\r\n"), nil
+		}
+
+		if atEOF {
+			return len(data), bytes.Trim(data, "\r\n"), nil
+		}
+
+		// Request more data
+		return 0, nil, nil
+	}
+}
+
+// splitOctets is a split function that splits the input into octet counted frames,
+// i.e., the length of the record in bytes, a space, and then the record.
+func splitOctets(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+
+	if atEOF && start == len(data) {
+		return len(data), nil, nil
+	}
+
+	i := start
+	for i < len(data) && '0' <= data[i] && data[i] <= '9' && i-start < 10 {
+		i++
+	}
+
+	if i == len(data) && !atEOF {
+		// Request more data
+		return start, nil, nil
+	}
+
+	if i == start || i == len(data) || data[i] != ' ' {
+		return 0, nil, fmt.Errorf("Invalid octet counted frame at %q: expecting \"length message\"", truncate(data[start:], 20))
+	}
+
+	n, _ := strconv.Atoi(string(data[start:i]))
+	end := i + 1 + n
+
+	if end > len(data) {
+		if atEOF {
+			return 0, nil, fmt.Errorf("Invalid octet counted frame at %q: expecting %d bytes, got %d", truncate(data[start:], 20), n, len(data)-i-1)
+		}
+
+		// Request more data
+		return start, nil, nil
+	}
+
+	return end, data[i+1 : end], nil
+}
+
+func truncate(data []byte, n int) []byte {
+	if len(data) > n {
+		return data[:n]
+	}
+
+	return data
+}
+
+// indexBlank returns the position and length of the first run of blank lines in
+// data. Lines with only spaces or tabs are considered blank.
+func indexBlank(data []byte) (int, int) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\n' {
+			continue
+		}
+
+		end := -1
+
+		for k := i + 1; k < len(data); k++ {
+			if c := data[k]; c == '\n' {
+				end = k + 1
+			} else if c != ' ' && c != '\t' && c != '\r' {
+				break
+			}
+		}
+
+		if end != -1 {
+			return i, end - i
+		}
+	}
+
+	return -1, 0
+}
+
+// indexUnindented returns the position and length of the first line break in data
+// that's followed by a line that doesn't start with a space or tab.
+func indexUnindented(data []byte) (int, int) {
+	for i := 0; i+1 < len(data); i++ {
+		if data[i] == '\n' && data[i+1] != ' ' && data[i+1] != '\t' {
+			return i, 1
+		}
+	}
+
+	return -1, 0
+}
+
+// CleanBinary applies the policy, one of BinarySkip, BinaryReplace and BinaryHex,
+// to the NUL bytes and the bytes that are not valid UTF-8 in the record, so the
+// scanner only sees printable text. It returns the cleaned record and whether the
+// record contained any such bytes. Records without them are returned as is.
+func CleanBinary(data []byte, policy string) ([]byte, bool) {
+	if utf8.Valid(data) && bytes.IndexByte(data, 0) == -1 {
+		return data, false
+	}
+
+	buf := make([]byte, 0, len(data)+8)
+
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+
+		if data[i] != 0 && (r != utf8.RuneError || size != 1) {
+			buf = append(buf, data[i:i+size]...)
+			i += size
+			continue
+		}
+
+		switch policy {
+		case BinarySkip:
+		case BinaryHex:
+			buf = append(buf, fmt.Sprintf("\\x%02x", data[i])...)
+		default:
+			buf = append(buf, string(utf8.RuneError)...)
+		}
+
+		i++
+	}
+
+	return buf, true
+}
+
+// Position is the location of a record in its source.
+type Position struct {
+	Source string // Source is the name of the input, e.g., the file name.
+	Line   int    // Line is the line number the record starts on, starting at 1.
+	Offset int64  // Offset is the byte offset the record starts at, starting at 0.
+}
+
+// String returns the position in the format "source:line (offset n)", so a record
+// reported in an error message can be located quickly in a large input.
+func (this Position) String() string {
+	return fmt.Sprintf("%s:%d (offset %d)", this.Source, this.Line, this.Offset)
+}
+
+// RecordScanner reads the records of an input, split using SplitRecords and
+// cleaned using CleanBinary, and keeps track of the position of each record. It
+// embeds bufio.Scanner, so the records are read using Scan() and Text().
+type RecordScanner struct {
+	*bufio.Scanner
+
+	split    bufio.SplitFunc
+	policy   string
+	pos      Position // position of the current record
+	next     Position // position of the input not yet consumed
+	records  int
+	binaries int
+}
+
+// NewRecordScanner returns a RecordScanner that reads the records of r, named
+// source, using the record separator sep and the binary policy.
+func NewRecordScanner(r io.Reader, source, sep, policy string) *RecordScanner {
+	this := &RecordScanner{
+		Scanner: bufio.NewScanner(r),
+		split:   SplitRecords(sep),
+		policy:  policy,
+		next:    Position{Source: source, Line: 1},
+	}
+
+	this.Scanner.Split(this.splitRecord)
+
+	return this
+}
+
+// Position returns the position of the record last read by Scan().
+func (this *RecordScanner) Position() Position {
+	return this.pos
+}
+
+// Records returns the number of records read so far.
+func (this *RecordScanner) Records() int {
+	return this.records
+}
+
+// Binaries returns the number of records read so far that contained NUL or
+// invalid UTF-8 bytes.
+func (this *RecordScanner) Binaries() int {
+	return this.binaries
+}
+
+func (this *RecordScanner) splitRecord(data []byte, atEOF bool) (int, []byte, error) {
+	n, tok, err := this.split(data, atEOF)
+
+	if tok != nil {
+		this.records++
+
+		// The record is a slice of data, so the capacities tell where it starts
+		off := cap(data) - cap(tok)
+
+		this.pos = Position{
+			Source: this.next.Source,
+			Line:   this.next.Line + bytes.Count(data[:off], []byte("\n")),
+			Offset: this.next.Offset + int64(off),
+		}
+
+		var binary bool
+		if tok, binary = CleanBinary(tok, this.policy); binary {
+			this.binaries++
+		}
+	}
+
+	this.next.Line += bytes.Count(data[:n], []byte("\n"))
+	this.next.Offset += int64(n)
+
+	return n, tok, err
+}
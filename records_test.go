@@ -0,0 +1,154 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	recordtests = []struct {
+		sep     string
+		data    string
+		records []string
+	}{
+		{"", "line 1\nline 2\r\nline 3", []string{"line 1", "line 2", "line 3"}},
+		{"newline", "line 1\nline 2", []string{"line 1", "line 2"}},
+		{"newline", "\ufeff# comment\r\nline 1\r\n", []string{"# comment", "line 1"}},
+		{"blank", "\ufeffline 1\r\n\r\nline 2\r\n", []string{"line 1", "line 2"}},
+		{"blank", "10:00:01 CPU %user\n10:00:01 all 2.5\n\n10:00:02 CPU %user\r\n10:00:02 all 3.0\n \n\n",
+			[]string{"10:00:01 CPU %user\n10:00:01 all 2.5", "10:00:02 CPU %user\r\n10:00:02 all 3.0"}},
+		{"nul", "record 1\nmore\x00record 2\x00", []string{"record 1\nmore", "record 2"}},
+		{"----", "record 1\n----\nrecord 2\nmore\n----\n", []string{"record 1", "record 2\nmore"}},
+		{"octet", "18 <34>1 - host app -13 line 1\nline 2\n\r\n3 end\n", []string{"<34>1 - host app -", "line 1\nline 2", "end"}},
+		{"indent", "ERROR: failed\n\tat Main.run\n  at Main.main\nINFO: done\n", []string{"ERROR: failed\n\tat Main.run\n  at Main.main", "INFO: done"}},
+		{"mysql-slow", "/usr/sbin/mysqld, Version: 8.0.15. started with:\nTcp port: 3306  Unix socket: /tmp/mysql.sock\nTime                 Id Command    Argument\n" +
+			"# Time: 2019-01-07T15:04:05Z\n# User@Host: app[app] @ localhost []  Id: 42\nSELECT 1;\n# User@Host: app[app] @ localhost []  Id: 43\nSELECT\n2;\n",
+			[]string{"", "Time: 2019-01-07T15:04:05Z\nUser@Host: app[app] @ localhost []  Id: 42\nSELECT 1;", "User@Host: app[app] @ localhost []  Id: 43\nSELECT\n2;"}},
+	}
+
+	binarytests = []struct {
+		policy string
+		data   string
+		clean  string
+	}{
+		{BinarySkip, "user\x00 root\xff logged in", "user root logged in"},
+		{BinaryReplace, "user\x00 root\xff logged in", "user\ufffd root\ufffd logged in"},
+		{BinaryHex, "user\x00 root\xff logged in", "user\\x00 root\\xff logged in"},
+		{BinaryHex, "caf\xc3\xa9 \xc3", "caf\u00e9 \\xc3"},
+	}
+)
+
+func TestSplitRecords(t *testing.T) {
+	for _, tc := range recordtests {
+		s := bufio.NewScanner(strings.NewReader(tc.data))
+		s.Split(SplitRecords(tc.sep))
+
+		var records []string
+		for s.Scan() {
+			records = append(records, s.Text())
+		}
+
+		require.NoError(t, s.Err(), tc.sep)
+		require.Equal(t, tc.records, records, tc.sep)
+	}
+}
+
+func TestSplitRecordsOctet(t *testing.T) {
+	for _, data := range []string{"line 1\n", "12line 1", "20 line 1\n"} {
+		s := bufio.NewScanner(strings.NewReader(data))
+		s.Split(SplitRecords(SeparatorOctet))
+
+		for s.Scan() {
+		}
+
+		require.Error(t, s.Err(), data)
+	}
+}
+
+func TestCleanBinary(t *testing.T) {
+	for _, tc := range binarytests {
+		clean, ok := CleanBinary([]byte(tc.data), tc.policy)
+		require.True(t, ok, tc.data)
+		require.Equal(t, tc.clean, string(clean), tc.data)
+	}
+
+	clean, ok := CleanBinary([]byte("caf\u00e9 au lait"), BinaryHex)
+	require.False(t, ok)
+	require.Equal(t, "caf\u00e9 au lait", string(clean))
+}
+
+func TestRecordScannerPosition(t *testing.T) {
+	data := "\ufeffline 1\r\n\r\nline 3\nline\x00 4\n"
+
+	s := NewRecordScanner(strings.NewReader(data), "app.log", SeparatorNewline, BinaryHex)
+
+	var (
+		records []string
+		pos     []Position
+	)
+
+	for s.Scan() {
+		records = append(records, s.Text())
+		pos = append(pos, s.Position())
+	}
+
+	require.NoError(t, s.Err())
+	require.Equal(t, []string{"line 1", "", "line 3", "line\\x00 4"}, records)
+	require.Equal(t, []Position{
+		{"app.log", 1, 3},
+		{"app.log", 2, 11},
+		{"app.log", 3, 13},
+		{"app.log", 4, 20},
+	}, pos)
+	require.Equal(t, 1, s.Binaries())
+	require.Equal(t, 4, s.Records())
+	require.Equal(t, "app.log:3 (offset 13)", pos[2].String())
+
+	data = "record 1\n\n\nrecord 2\nmore\n\nrecord 3"
+
+	s = NewRecordScanner(strings.NewReader(data), "sar.log", SeparatorBlank, BinaryReplace)
+	pos = pos[:0]
+
+	for s.Scan() {
+		pos = append(pos, s.Position())
+	}
+
+	require.Equal(t, []Position{
+		{"sar.log", 1, 0},
+		{"sar.log", 4, 11},
+		{"sar.log", 7, 26},
+	}, pos)
+
+	data = "Tcp port: 3306  Unix socket: /tmp/mysql.sock\n# Time: 2019-01-07T15:04:05Z\n# User@Host: app[app] @ localhost []  Id: 42\nSELECT 1;\n" +
+		"# User@Host: app[app] @ localhost []  Id: 43\nSELECT 2;\n"
+
+	s = NewRecordScanner(strings.NewReader(data), "slow.log", SeparatorMySQLSlow, BinaryReplace)
+	pos = pos[:0]
+
+	for s.Scan() {
+		pos = append(pos, s.Position())
+	}
+
+	require.Equal(t, []Position{
+		{"slow.log", 1, 0},
+		{"slow.log", 2, 45},
+		{"slow.log", 5, 129},
+	}, pos)
+}
@@ -17,14 +17,20 @@ package sequence
 import (
 	"fmt"
 	"io"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/zhenjl/xparse/etld"
 )
 
 // Scanner is a sequential lexical analyzer that breaks a log message into a
 // sequence of tokens. It is sequential because it goes through log message
 // sequentially tokentizing each part of the message, without the use of regular
 // expressions. The scanner currently recognizes time stamps, IPv4 addresses, URLs,
-// MAC addresses, integers and floating point numbers.
+// IPv4 networks and address:port pairs, MAC addresses, host names, integers and
+// floating point numbers.
 //
 // For example, the following message
 //
@@ -108,23 +114,199 @@ import (
 type Scanner struct {
 	seq Sequence
 	msg *Message
+
+	// is the token at the same index in seq preceded by spaces?
+	spaced []bool
+
+	// should embedded SQL statements be joined into a single token, and should they
+	// be normalized?
+	joinsql bool
+	normsql bool
+
+	// should the text of the message around the tokens be kept for Reconstruct?
+	keep bool
+
+	// paths of the json fields to keep, split into keys, all fields if empty
+	jsonFields [][]string
+
+	// should the json fields not selected be kept as a single msgrest token?
+	jsonRest bool
+
+	// field names of W3C messages, from the last #Fields directive
+	w3cFields []string
+
+	// date of W3C messages, from the last #Date directive
+	w3cDate string
+
+	// checks are the literal checks, in the order they are tried, and matches is
+	// the number of literals found to be each token type, see TypeProfile
+	checks  []literalCheck
+	matches [token__END__]int
+}
+
+// literalCheck checks whether a literal token is of a more specific token type. A
+// literal can only match one of the checks, so their order only changes how fast
+// the literals are scanned.
+type literalCheck struct {
+	tt    TokenType
+	match func(string) bool
+}
+
+var literalChecks = []literalCheck{
+	{TokenHost, isHost},
+	{TokenIPPort, isHashIPPort},
+	{TokenUserAgent, isUserAgent},
+}
+
+// TypeProfile is the number of literal tokens found to be each token type, by the
+// name of the type, e.g., "host", including the literals that stayed literals. It
+// can be saved, e.g., as json, and merged across runs, to order the checks of the
+// token types of future scanners using SetTypeProfile.
+type TypeProfile map[string]int
+
+// Merge adds the counts of the other profile to the profile.
+func (this TypeProfile) Merge(other TypeProfile) {
+	for name, n := range other {
+		this[name] += n
+	}
 }
 
 func NewScanner() *Scanner {
 	return &Scanner{
-		seq: make(Sequence, 0, 20),
-		msg: &Message{},
+		seq:    make(Sequence, 0, 20),
+		msg:    &Message{punct: config.punctuation},
+		spaced: make([]bool, 0, 20),
+		checks: literalChecks,
+	}
+}
+
+// TypeProfile returns the number of literal tokens the scanner found to be each
+// token type so far.
+func (this *Scanner) TypeProfile() TypeProfile {
+	p := make(TypeProfile)
+
+	for _, tt := range append([]TokenType{TokenLiteral}, this.checkTypes()...) {
+		if n := this.matches[tt]; n > 0 {
+			p[tt.String()] = n
+		}
+	}
+
+	return p
+}
+
+// SetTypeProfile orders the checks of the token types that literal tokens can turn
+// out to be, e.g., host names, by the number of literals found to be each type in
+// the profile, most first, so sources where most literals are of one type don't
+// check the rarer types first. Types that are not in the profile keep their order,
+// after the types that are.
+func (this *Scanner) SetTypeProfile(p TypeProfile) {
+	this.checks = append([]literalCheck(nil), literalChecks...)
+	sort.Stable(literalChecksByProfile{this.checks, p})
+}
+
+// checkTypes returns the token types of the literal checks, in the order they are
+// tried.
+func (this *Scanner) checkTypes() []TokenType {
+	types := make([]TokenType, len(this.checks))
+	for i, c := range this.checks {
+		types[i] = c.tt
 	}
+	return types
+}
+
+type literalChecksByProfile struct {
+	checks  []literalCheck
+	profile TypeProfile
+}
+
+func (this literalChecksByProfile) Len() int { return len(this.checks) }
+func (this literalChecksByProfile) Swap(i, j int) {
+	this.checks[i], this.checks[j] = this.checks[j], this.checks[i]
+}
+func (this literalChecksByProfile) Less(i, j int) bool {
+	return this.profile[this.checks[i].tt.String()] > this.profile[this.checks[j].tt.String()]
+}
+
+// SetJoinSQL sets whether the SQL statements embedded in messages should be joined
+// into a single token, e.g., for database logs. They are not by default, since the
+// messages of other sources can have words that look like the start of a statement.
+func (this *Scanner) SetJoinSQL(join bool) {
+	this.joinsql = join
+}
+
+// SetNormalizeSQL sets whether the SQL statements embedded in messages should be
+// joined into a single token, and normalized using NormalizeSQL, so messages
+// cluster by the shape of the query instead of the values in it.
+func (this *Scanner) SetNormalizeSQL(normalize bool) {
+	this.normsql = normalize
+}
+
+// SetKeepText sets whether the text of the message around the tokens, e.g., spaces,
+// quotes and the JSON syntax, should be kept, so Sequence.Reconstruct can rebuild
+// the message from the tokens. It's not kept by default, since it's only needed to
+// reconstruct messages.
+func (this *Scanner) SetKeepText(keep bool) {
+	this.keep = keep
+}
+
+// SetPunctuation sets the punctuation characters that are always tokens of their
+// own, e.g., "/" so the HAProxy backend and server "static/srv1" are two literals
+// instead of one, rather than part of the literals around them. The default
+// is the punctuation of the config file, which is also used to scan the patterns
+// added to a Parser, so a Scanner set to other punctuation splits messages unlike
+// the patterns. Letters, digits and spaces can't be punctuation, and quotes are
+// always tokens.
+func (this *Scanner) SetPunctuation(chars string) error {
+	if err := validPunctuation(chars); err != nil {
+		return err
+	}
+
+	this.msg.punct = chars
+
+	return nil
+}
+
+// SetJsonFields sets the json fields ScanJson should turn into tokens, so very wide
+// json messages don't produce a token for every field. Each field is a JSONPath
+// style path, e.g., "$.userIdentity.type", "eventName" or "records[*].id", where a
+// "*" matches any key or array index, and a path to an object or array selects all
+// the fields in it. If rest is true, the fields that aren't selected are kept as a
+// single msgrest token of space separated key=value pairs at the end of the
+// Sequence, otherwise they are dropped. No fields means all the fields are kept.
+func (this *Scanner) SetJsonFields(fields []string, rest bool) error {
+	this.jsonFields = this.jsonFields[:0]
+	this.jsonRest = rest
+
+	for _, field := range fields {
+		path := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(field), "$"), ".")
+		path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+		keys := strings.Split(path, ".")
+		for _, key := range keys {
+			if key == "" {
+				return fmt.Errorf("Invalid json field %q: empty key", field)
+			}
+		}
+
+		this.jsonFields = append(this.jsonFields, keys)
+	}
+
+	return nil
 }
 
 // Scan returns a Sequence, or a list of tokens, for the data string supplied.
 // Scan is not concurrent-safe, and the returned Sequence is only valid until
 // the next time any Scan*() method is called. The best practice would be to
 // create one Scanner for each goroutine.
+//
+// A leading UTF-8 byte order mark and trailing carriage returns, as found in files
+// produced on Windows, are removed from the data string by all the Scan*() methods.
 func (this *Scanner) Scan(s string) (Sequence, error) {
+	s = trimInput(s)
 	this.msg.Data = s
 	this.msg.reset()
 	this.seq = this.seq[:0]
+	this.spaced = this.spaced[:0]
 
 	var (
 		err error
@@ -133,6 +315,7 @@ func (this *Scanner) Scan(s string) (Sequence, error) {
 
 	for tok, err = this.msg.Tokenize(); err == nil; tok, err = this.msg.Tokenize() {
 		this.insertToken(tok)
+		this.spaced = append(this.spaced, this.msg.state.spaced)
 
 		// special case for %r, or request, token in apache logs, which is comprised
 		// of method, url, and protocol like "GET http://blah HTTP/1.0"
@@ -144,6 +327,7 @@ func (this *Scanner) Scan(s string) (Sequence, error) {
 					Type:  TokenLiteral,
 					Value: s[this.msg.state.start : this.msg.state.start+l],
 				})
+				this.spaced = append(this.spaced, false)
 
 				this.msg.state.inquote = false
 				this.msg.state.nxquote = false
@@ -156,6 +340,457 @@ func (this *Scanner) Scan(s string) (Sequence, error) {
 		return nil, err
 	}
 
+	this.joinAddresses()
+	this.joinRequests()
+	if this.joinsql || this.normsql {
+		this.joinStatement()
+	}
+	this.markTraceContext()
+
+	if this.keep {
+		this.seq.keepText(s)
+	}
+
+	return this.seq, nil
+}
+
+// trimInput removes the UTF-8 byte order mark and the trailing carriage returns
+// from the data string.
+func trimInput(s string) string {
+	return strings.TrimRight(strings.TrimPrefix(s, utf8BOM), "\r")
+}
+
+// joinAddresses joins each IPv4 address that's immediately followed by "/" and a
+// prefix length, or ":" and a port, into a single TokenCIDR or TokenIPPort token,
+// so the address doesn't get split into three tokens. Since some firewalls log
+// ports as "a.b.c.d/port", the address is only considered a network if the host
+// bits are all zero, e.g., 10.1.2.0/24 but not 10.1.2.5/25.
+func (this *Scanner) joinAddresses() {
+	seq, spaced := this.seq, this.spaced
+	j := 0
+
+	for i := 0; i < len(seq); i++ {
+		if seq[i].Type == TokenIPv4 && i+2 < len(seq) && !spaced[i+1] && !spaced[i+2] &&
+			seq[i+1].Type == TokenLiteral && seq[i+2].Type == TokenInteger {
+
+			t := TokenUnknown
+			n, err := strconv.Atoi(seq[i+2].Value)
+
+			switch {
+			case err != nil:
+			case seq[i+1].Value == "/" && isNetwork(seq[i].Value, n):
+				t = TokenCIDR
+			case seq[i+1].Value == ":" && n <= 65535:
+				t = TokenIPPort
+			}
+
+			if t != TokenUnknown {
+				seq[j] = seq[i]
+				seq[j].Type = t
+				seq[j].Value += seq[i+1].Value + seq[i+2].Value
+				spaced[j] = spaced[i]
+				j++
+				i += 2
+				continue
+			}
+		}
+
+		seq[j], spaced[j] = seq[i], spaced[i]
+		j++
+	}
+
+	this.seq, this.spaced = seq[:j], spaced[:j]
+}
+
+// joinRequests joins each quoted HTTP request line, such as "GET /path HTTP/1.1",
+// into a single TokenRequest token, so the method, path and protocol don't need to
+// be matched separately in every pattern. The quotes are left as is.
+func (this *Scanner) joinRequests() {
+	seq, spaced := this.seq, this.spaced
+	j := 0
+
+	for i := 0; i < len(seq); i++ {
+		seq[j], spaced[j] = seq[i], spaced[i]
+		j++
+
+		if seq[i].Value != "\"" || i+4 >= len(seq) || !isRequestMethod(seq[i+1].Value) {
+			continue
+		}
+
+		// find the closing quote, the token before it must be the protocol
+		k := i + 3
+		for ; k < len(seq) && seq[k].Value != "\""; k++ {
+		}
+
+		if k == len(seq) || !strings.HasPrefix(strings.ToUpper(seq[k-1].Value), "HTTP/") {
+			continue
+		}
+
+		tok := Token{Tag: TagUnknown, Type: TokenRequest, Value: seq[i+1].Value + " " + seq[i+2].Value}
+		for m := i + 3; m < k-1; m++ {
+			if spaced[m] {
+				tok.Value += " "
+			}
+			tok.Value += seq[m].Value
+		}
+		tok.Value += " " + seq[k-1].Value
+
+		seq[j], spaced[j] = tok, spaced[i+1]
+		j++
+		i = k - 1
+	}
+
+	this.seq, this.spaced = seq[:j], spaced[:j]
+}
+
+func isRequestMethod(s string) bool {
+	return len(s) > 0 && matchRequestMethods(s+" ") == len(s)
+}
+
+// sqlVerbs are the keywords that start an SQL statement.
+var sqlVerbs = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "with": true,
+	"create": true, "alter": true, "drop": true, "truncate": true, "replace": true,
+	"merge": true,
+}
+
+// sqlObjects are the words that follow the keywords that start a DDL statement,
+// e.g., "CREATE TABLE" or "DROP INDEX".
+var sqlObjects = map[string]bool{
+	"table": true, "index": true, "view": true, "database": true, "schema": true,
+	"function": true, "procedure": true, "trigger": true, "sequence": true,
+	"user": true, "role": true, "unique": true, "or": true, "temporary": true,
+	"temp": true, "materialized": true,
+}
+
+// sqlIntroducers are the words that introduce an SQL statement, e.g., "query:",
+// "statement:" or the "execute <name>:" of PostgreSQL.
+var sqlIntroducers = map[string]bool{
+	"query": true, "statement": true, "sql": true, "execute": true,
+}
+
+// joinStatement joins an SQL statement embedded in the message, such as the one in
+// "executing query: SELECT * FROM users WHERE id = 5", into a single TokenString
+// token. A statement is recognized if it starts with an SQL keyword following a
+// ":", or one of the words "query", "statement" or "sql", or following a ";" if the
+// message also ends with one, as in MySQL slow query logs. It extends to the end of
+// the message, or to the closing quote if the statement is quoted.
+//
+// Unless the statement is introduced by one of the sqlIntroducers, e.g., "query:",
+// the keyword has to be followed by the rest of a statement, e.g., SELECT by a
+// FROM, UPDATE by a SET or DELETE by FROM, so messages such as "status: update
+// available for 3 packages" are not taken to be statements.
+func (this *Scanner) joinStatement() {
+	seq, spaced := this.seq, this.spaced
+
+	for i := 1; i < len(seq)-1; i++ {
+		if seq[i].Type != TokenLiteral || !sqlVerbs[strings.ToLower(seq[i].Value)] {
+			continue
+		}
+
+		end := len(seq)
+
+		switch strings.ToLower(seq[i-1].Value) {
+		case ":", "query", "statement", "sql":
+
+		case ";":
+			if seq[len(seq)-1].Value != ";" {
+				continue
+			}
+
+		case "\"":
+			for end = i + 1; end < len(seq) && seq[end].Value != "\""; end++ {
+			}
+
+		default:
+			continue
+		}
+
+		if !isIntroducedStatement(seq, i) && !isStatement(seq[i:end]) {
+			continue
+		}
+
+		tok := Token{Tag: TagUnknown, Type: TokenString, Value: seq[i].Value, isValue: true}
+		for k := i + 1; k < end; k++ {
+			if spaced[k] {
+				tok.Value += " "
+			}
+			tok.Value += seq[k].Value
+		}
+
+		if this.normsql {
+			tok.Value = NormalizeSQL(tok.Value)
+		}
+
+		seq[i] = tok
+		n := copy(seq[i+1:], seq[end:])
+		copy(spaced[i+1:], spaced[end:])
+		this.seq, this.spaced = seq[:i+1+n], spaced[:i+1+n]
+
+		return
+	}
+}
+
+// isIntroducedStatement returns true if the statement starting at seq[i] follows
+// one of the sqlIntroducers, e.g., "statement: SELECT 1" or, in PostgreSQL logs,
+// "execute <unnamed>: SELECT 1".
+func isIntroducedStatement(seq Sequence, i int) bool {
+	j := i - 1
+	if seq[j].Value == ":" {
+		j--
+	}
+
+	// the name of a prepared statement, e.g., "<unnamed>"
+	if j >= 2 && seq[j].Value == ">" && seq[j-2].Value == "<" {
+		j -= 3
+	}
+
+	return j >= 0 && sqlIntroducers[strings.ToLower(seq[j].Value)]
+}
+
+// isStatement returns true if the tokens look like an SQL statement, i.e., the
+// keyword it starts with is followed by the words that go with it.
+func isStatement(seq Sequence) bool {
+	next := func(words ...string) bool {
+		if len(seq) < 2 {
+			return false
+		}
+		for _, w := range words {
+			if strings.EqualFold(seq[1].Value, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	later := func(words ...string) bool {
+		for _, tok := range seq[1:] {
+			for _, w := range words {
+				if strings.EqualFold(tok.Value, w) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch strings.ToLower(seq[0].Value) {
+	case "select":
+		return later("from")
+
+	case "insert", "replace", "merge":
+		return next("into")
+
+	case "update":
+		return later("set")
+
+	case "delete":
+		return next("from")
+
+	case "with":
+		return later("select", "insert", "update", "delete")
+
+	case "truncate":
+		return next("table")
+
+	case "create", "alter", "drop":
+		return len(seq) > 1 && sqlObjects[strings.ToLower(seq[1].Value)]
+	}
+
+	return false
+}
+
+// NormalizeSQL replaces the literal values in the SQL statement, i.e., numbers and
+// quoted strings, with "?", and collapses lists of values such as "IN (?, ?, ?)"
+// into "IN (?)", so statements that only differ by their values become the same.
+func NormalizeSQL(stmt string) string {
+	buf := make([]byte, 0, len(stmt))
+
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+
+		switch {
+		case c == '\'':
+			// skip to the closing quote, '' is an escaped quote
+			for i++; i < len(stmt); i++ {
+				if stmt[i] == '\'' {
+					if i+1 < len(stmt) && stmt[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			buf = append(buf, '?')
+
+		case '0' <= c && c <= '9' && (len(buf) == 0 || !isIdentChar(buf[len(buf)-1])):
+			// a digit that follows an identifier is part of it, e.g., "t1"
+			for i+1 < len(stmt) && ('0' <= stmt[i+1] && stmt[i+1] <= '9' || stmt[i+1] == '.') {
+				i++
+			}
+			buf = append(buf, '?')
+
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	s := string(buf)
+	for {
+		t := strings.Replace(s, "?, ?", "?", -1)
+		t = strings.Replace(t, "?,?", "?", -1)
+		if t == s {
+			return s
+		}
+		s = t
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// ScanAuto scans the message using ScanJson if it looks like a json object, i.e.,
+// it starts with "{" and ends with "}", and using Scan otherwise. This is useful
+// for inputs that mix json and plain text messages, such as container logs. If
+// ScanJson fails, e.g., because the message is only wrapped in braces, the message
+// is scanned using Scan instead.
+func (this *Scanner) ScanAuto(s string) (Sequence, error) {
+	if t := strings.TrimSpace(trimInput(s)); len(t) > 1 && t[0] == '{' && t[len(t)-1] == '}' {
+		if seq, err := this.ScanJson(s); err == nil {
+			return seq, nil
+		}
+	}
+
+	return this.Scan(s)
+}
+
+// ScanKV is the same as Scan, except it also recognizes key=value islands inside
+// otherwise free-form messages, such as
+//
+//	Jan 12 06:49:42 kernel: nf_conntrack: dropping packet src=10.1.1.2 uid=1001 proto=TCP
+//
+// A key=value island is a literal key, immediately followed by "=" and then the
+// value, without any spaces in between. The value may be quoted. The key and the
+// value are marked as such, and if the key is the name of a tag, e.g., "srcip", or
+// a known key for one, e.g., "uid" for srcuid, and the value is of the right token
+// type, the value is tagged. The rest of the words are left as literals.
+func (this *Scanner) ScanKV(s string) (Sequence, error) {
+	if _, err := this.Scan(s); err != nil {
+		return nil, err
+	}
+
+	markTextKV(this.seq, this.spaced)
+
+	return this.seq, nil
+}
+
+// markTextKV marks the key=value islands in the sequence. spaced records whether
+// each token is preceded by a space in the original message.
+func markTextKV(seq Sequence, spaced []bool) {
+	l := len(seq)
+
+	for i := 1; i < l-1; i++ {
+		if seq[i].Value != "=" || seq[i].Type != TokenLiteral || spaced[i] || spaced[i+1] ||
+			seq[i-1].Type != TokenLiteral || seq[i-1].isKey || seq[i-1].isValue {
+			continue
+		}
+
+		ki, vi := i-1, i+1
+
+		if v := seq[vi].Value; v == "\"" || v == "'" {
+			vi++
+		}
+
+		if vi >= l || (seq[vi].Type == TokenLiteral && len(seq[vi].Value) == 1 && !isLiteral(rune(seq[vi].Value[0]))) {
+			continue
+		}
+
+		seq[ki].isKey = true
+		seq[vi].isValue = true
+
+		if seq[vi].Type == TokenLiteral {
+			seq[vi].Type = TokenString
+		}
+
+		if tag := kvTag(strings.ToLower(seq[ki].Value), seq[vi].Type); tag != TagUnknown {
+			seq[vi].Tag = tag
+			seq[vi].Type = tag.TokenType()
+		}
+		i = vi
+	}
+}
+
+// kvTag returns the tag for the value of the key, or TagUnknown if there isn't one
+// of the token type. Host names can be tagged as strings.
+func kvTag(key string, tt TokenType) TagType {
+	match := func(tag TagType) bool {
+		return tag.TokenType() == tt || (tt == TokenHost && tag.TokenType() == TokenString)
+	}
+
+	if tag, ok := config.tagIDs[key]; ok && tag != TagUnknown && match(tag) {
+		return tag
+	}
+
+	for _, tag := range keymaps.prekeys[key] {
+		if match(tag) {
+			return tag
+		}
+	}
+
+	return TagUnknown
+}
+
+// ScanColumns returns a Sequence, or a list of tokens, for a fixed-width message
+// that has no delimiters between its fields, using the column layout declared in
+// the columns section of the config file. A tagged column becomes a single token
+// with the tag, and an untagged column is tokenized as usual. Empty columns, and
+// columns past the end of the message, are skipped.
+func (this *Scanner) ScanColumns(s string) (Sequence, error) {
+	if len(config.columns) == 0 {
+		return nil, fmt.Errorf("Invalid column layout: no columns configured")
+	}
+
+	s = trimInput(s)
+
+	this.seq = this.seq[:0]
+
+	for i, pos := 0, 0; i < len(config.columns) && pos < len(s); i++ {
+		col := config.columns[i]
+
+		end := len(s)
+		if col.width > 0 && pos+col.width < end {
+			end = pos + col.width
+		}
+
+		v := strings.TrimSpace(s[pos:end])
+		pos = end
+
+		switch {
+		case v == "":
+
+		case col.tag != TagUnknown:
+			this.insertToken(Token{Tag: col.tag, Type: col.tag.TokenType(), Value: v})
+
+		default:
+			this.msg.Data = v
+			this.msg.reset()
+
+			tok, err := this.msg.Tokenize()
+			for ; err == nil; tok, err = this.msg.Tokenize() {
+				this.insertToken(tok)
+			}
+
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+
+	if this.keep {
+		this.seq.keepText(s)
+	}
+
 	return this.seq, nil
 }
 
@@ -193,7 +828,9 @@ const (
 //   - skips any key that has an empty value, so json strings like
 //   		"reference":""		or		"filterSet": {}
 //     will not show up in the Sequence
+//   - if fields are set using SetJsonFields, skips any key that isn't selected
 func (this *Scanner) ScanJson(s string) (Sequence, error) {
+	s = trimInput(s)
 	this.msg.Data = s
 	this.msg.reset()
 	this.seq = this.seq[:0]
@@ -482,10 +1119,82 @@ func (this *Scanner) ScanJson(s string) (Sequence, error) {
 		return nil, err
 	}
 
+	if len(this.jsonFields) > 0 {
+		this.selectJsonFields()
+	}
+
+	if this.keep {
+		this.seq.keepText(s)
+	}
+
 	return this.seq, nil
 }
 
+// selectJsonFields removes the key=value tokens of the json fields that aren't
+// selected from the sequence, and keeps them as a msgrest token if required.
+func (this *Scanner) selectJsonFields() {
+	var (
+		seq  = this.seq
+		rest []string
+		j    int
+	)
+
+	for i := 0; i < len(seq); i++ {
+		if seq[i].isKey && i+2 < len(seq) && seq[i+1].Value == "=" && !this.jsonSelected(seq[i].Value) {
+			if this.jsonRest {
+				rest = append(rest, seq[i].Value+"="+seq[i+2].Value)
+			}
+
+			i += 2
+			continue
+		}
+
+		seq[j] = seq[i]
+		j++
+	}
+
+	this.seq = seq[:j]
+
+	if len(rest) > 0 {
+		this.insertToken(Token{Tag: TagMsgRest, Type: TokenString, Value: strings.Join(rest, " "), isValue: true})
+	}
+}
+
+// jsonSelected returns true if the flattened json key, e.g., "userIdentity.type",
+// is selected by any of the json field paths.
+func (this *Scanner) jsonSelected(key string) bool {
+	keys := strings.Split(key, ".")
+
+LOOP:
+	for _, path := range this.jsonFields {
+		if len(path) > len(keys) {
+			continue
+		}
+
+		for i, k := range path {
+			if k != "*" && k != keys[i] {
+				continue LOOP
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
 func (this *Scanner) insertToken(tok Token) {
+	if tok.Type == TokenLiteral && !tok.isKey {
+		for _, c := range this.checks {
+			if c.match(tok.Value) {
+				tok.Type = c.tt
+				break
+			}
+		}
+
+		this.matches[tok.Type]++
+	}
+
 	// For some reason this is consistently slightly faster than just append
 	if len(this.seq) >= cap(this.seq) {
 		this.seq = append(this.seq, tok)
@@ -495,3 +1204,98 @@ func (this *Scanner) insertToken(tok Token) {
 		this.seq[i] = tok
 	}
 }
+
+// isHost returns true if s is a host name or FQDN in the form of label.label.tld,
+// optionally with a trailing dot, where tld is a known effective top level domain.
+// At least three labels are required, since two-label literals such as
+// "local4.info" or "sshd.service" are too often not host names, unless the name
+// has the trailing dot of a fully qualified DNS name, e.g., "example.com.".
+func isHost(s string) bool {
+	labels := strings.Split(strings.TrimSuffix(s, "."), ".")
+	if len(labels) < 2 || (len(labels) < 3 && !strings.HasSuffix(s, ".")) {
+		return false
+	}
+
+	for _, label := range labels {
+		if l := len(label); l == 0 || l > 63 || label[0] == '-' || label[l-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+
+	return etld.Match(strings.ToLower(strings.TrimSuffix(s, "."))) > 0
+}
+
+// isHashIPPort returns true if s is an IPv4 address and port separated by "#", as
+// logged by BIND, e.g., "10.1.1.5#53".
+func isHashIPPort(s string) bool {
+	i := strings.LastIndex(s, "#")
+	if i == -1 || net.ParseIP(s[:i]).To4() == nil || strings.Count(s[:i], ".") != 3 {
+		return false
+	}
+
+	n, err := strconv.Atoi(s[i+1:])
+	return err == nil && n >= 0 && n <= 65535
+}
+
+// isNetwork returns true if the ipv4 address is the network address for the
+// prefix length, i.e., all the host bits are zero.
+func isNetwork(ipv4 string, n int) bool {
+	ip := net.ParseIP(ipv4).To4()
+	if ip == nil || n < 0 || n > 32 {
+		return false
+	}
+
+	return ip.Equal(ip.Mask(net.CIDRMask(n, 32)))
+}
+
+// uaProducts are the products of user agents that are usually a single word, e.g.,
+// "curl/7.68.0". Other user agents must have comments or more products after the
+// first one, e.g., "Mozilla/5.0 (X11; Linux x86_64) ...", which, since it has
+// spaces, can only be a quoted string.
+var uaProducts = []string{
+	"curl", "Wget", "python-requests", "Go-http-client", "okhttp", "Java",
+	"libwww-perl", "Apache-HttpClient", "PostmanRuntime", "axios", "node-fetch",
+}
+
+// isUserAgent returns true if s looks like an HTTP user agent, i.e., it starts with
+// a product/version, such as "Mozilla/5.0".
+func isUserAgent(s string) bool {
+	product := s
+	if i := strings.IndexByte(s, ' '); i != -1 {
+		product = s[:i]
+	}
+
+	i := strings.IndexByte(product, '/')
+	if i <= 0 || i+1 == len(product) || product[i+1] < '0' || product[i+1] > '9' {
+		return false
+	}
+
+	name := product[:i]
+	if strings.EqualFold(name, "HTTP") {
+		return false
+	}
+
+	for j, r := range name {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || j > 0 && ('0' <= r && r <= '9' || r == '-' || r == '_' || r == '.')) {
+			return false
+		}
+	}
+
+	if len(product) < len(s) {
+		return true
+	}
+
+	for _, p := range uaProducts {
+		if name == p {
+			return true
+		}
+	}
+
+	return false
+}
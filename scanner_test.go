@@ -78,6 +78,538 @@ func TestMessageScanHexString(t *testing.T) {
 	}
 }
 
+func TestMessageNumberType(t *testing.T) {
+	for _, tc := range []struct {
+		data  string
+		ttype TokenType
+	}{
+		{"-7", TokenInteger},
+		{"+42", TokenInteger},
+		{"-33.8688", TokenFloat},
+		{"+2.5", TokenFloat},
+		{".5", TokenFloat},
+		{"1.5e-3", TokenFloat},
+		{"6.02E23", TokenFloat},
+		{"-1e5", TokenFloat},
+		{"22.", TokenUnknown},
+		{"1.2.3", TokenUnknown},
+		{"1e", TokenUnknown},
+		{"-", TokenUnknown},
+		{"e5", TokenUnknown},
+		{"-.", TokenUnknown},
+	} {
+		require.Equal(t, tc.ttype, numberType(tc.data), tc.data)
+	}
+}
+
+func TestScannerScanNumbers(t *testing.T) {
+	scanner := NewScanner()
+
+	data := "fix lat/lon 37.7749,-122.4194 alt=-12.5 err=1.5e-3"
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, "%float%,%float%=%float%=%float%", seq.Signature(), seq.PrintTokens())
+}
+
+func TestScannerScanCurrency(t *testing.T) {
+	scanner := NewScanner()
+
+	data := "order total $1,234.56 refund -$5 tax €99.00 discount 12.5% of 85% at $1,23"
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+
+	for _, tc := range []struct {
+		i     int
+		ttype TokenType
+		value string
+		n     float64
+	}{
+		{2, TokenCurrency, "$1,234.56", 1234.56},
+		{4, TokenCurrency, "-$5", -5},
+		{6, TokenCurrency, "€99.00", 99},
+		{8, TokenPercent, "12.5%", 12.5},
+		{10, TokenPercent, "85%", 85},
+		{12, TokenCurrency, "$1", 1},
+		{13, TokenLiteral, ",", 0},
+	} {
+		tok := seq[tc.i]
+		require.Equal(t, tc.ttype, tok.Type, seq.PrintTokens())
+		require.Equal(t, tc.value, tok.Value, seq.PrintTokens())
+
+		n, err := tok.Number()
+		if tc.ttype == TokenLiteral {
+			require.Error(t, err, tc.value)
+		} else {
+			require.NoError(t, err, tc.value)
+			require.Equal(t, tc.n, n, tc.value)
+		}
+	}
+}
+
+func TestScannerScanRequest(t *testing.T) {
+	scanner := NewScanner()
+
+	data := `1.2.3.4 - - [16/Jan/2003:21:22:59 -0500] "POST /api/v1/items?id=5&sort=asc HTTP/1.1" 201 15`
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TokenRequest, seq[7].Type, seq.PrintTokens())
+	require.Equal(t, "POST /api/v1/items?id=5&sort=asc HTTP/1.1", seq[7].Value, seq.PrintTokens())
+
+	method, path, proto, err := seq[7].SplitRequest()
+	require.NoError(t, err)
+	require.Equal(t, "POST", method)
+	require.Equal(t, "/api/v1/items?id=5&sort=asc", path)
+	require.Equal(t, "HTTP/1.1", proto)
+
+	_, _, _, err = seq[0].SplitRequest()
+	require.Error(t, err)
+}
+
+func TestScannerScanUserAgent(t *testing.T) {
+	scanner := NewScanner()
+
+	for _, tc := range []struct {
+		data, browser, os string
+	}{
+		{`"GET / HTTP/1.1" 200 15 "-" "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"`, "Chrome", "Windows"},
+		{`"GET / HTTP/1.1" 200 15 "-" "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1"`, "Safari", "iOS"},
+		{`"GET / HTTP/1.1" 200 15 "-" "Mozilla/5.0 (X11; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0"`, "Firefox", "Linux"},
+		{`"GET / HTTP/1.1" 200 15 "-" "curl/7.68.0"`, "curl", "Other"},
+	} {
+		seq, err := scanner.Scan(tc.data)
+		require.NoError(t, err, tc.data)
+
+		tok := seq[len(seq)-2]
+		require.Equal(t, TokenUserAgent, tok.Type, seq.PrintTokens())
+
+		browser, os, err := tok.UserAgent()
+		require.NoError(t, err, tc.data)
+		require.Equal(t, tc.browser, browser, tc.data)
+		require.Equal(t, tc.os, os, tc.data)
+	}
+
+	for _, data := range []string{"HTTP/1.1", "a/b", "ssh2", "curlish/7.1", "pam_unix(sshd:auth)"} {
+		require.False(t, isUserAgent(data), data)
+	}
+}
+
+func TestScannerTypeProfile(t *testing.T) {
+	scanner := NewScanner()
+	require.Equal(t, []TokenType{TokenHost, TokenIPPort, TokenUserAgent}, scanner.checkTypes())
+
+	data := `"GET / HTTP/1.1" 200 15 "-" "curl/7.68.0"`
+
+	for i := 0; i < 3; i++ {
+		seq, err := scanner.Scan(data)
+		require.NoError(t, err, data)
+		require.Equal(t, TokenUserAgent, seq[len(seq)-2].Type, seq.PrintTokens())
+	}
+
+	p := scanner.TypeProfile()
+	require.Equal(t, 3, p["useragent"])
+	require.Equal(t, 0, p["host"])
+
+	p.Merge(TypeProfile{"useragent": 1, "ipport": 2})
+	require.Equal(t, 4, p["useragent"])
+	require.Equal(t, 2, p["ipport"])
+
+	// The checks are ordered by the profile, and the types that are not in it keep
+	// their order after the ones that are
+	other := NewScanner()
+	other.SetTypeProfile(p)
+	require.Equal(t, []TokenType{TokenUserAgent, TokenIPPort, TokenHost}, other.checkTypes())
+
+	// The order doesn't change the result
+	seq, err := other.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TokenUserAgent, seq[len(seq)-2].Type, seq.PrintTokens())
+
+	// Other scanners keep the default order
+	require.Equal(t, []TokenType{TokenHost, TokenIPPort, TokenUserAgent}, NewScanner().checkTypes())
+}
+
+func TestScannerPunctuation(t *testing.T) {
+	values := func(seq Sequence) []string {
+		var v []string
+		for _, tok := range seq {
+			v = append(v, tok.Value)
+		}
+		return v
+	}
+
+	data := "haproxy[1]: %ASA-6-302013: 10/0/30/69/109 \"a/b\""
+
+	seq, err := NewScanner().Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, []string{"haproxy", "[", "1", "]", ":", "%ASA-6-302013", ":", "10/0/30/69/109", "\"", "a/b", "\""}, values(seq), seq.PrintTokens())
+
+	scanner := NewScanner()
+	scanner.SetKeepText(true)
+	require.NoError(t, scanner.SetPunctuation("/-"))
+
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, []string{"haproxy", "[", "1", "]", ":", "%ASA", "-", "6", "-", "302013", ":",
+		"10", "/", "0", "/", "30", "/", "69", "/", "109", "\"", "a", "/", "b", "\""}, values(seq), seq.PrintTokens())
+	require.Equal(t, TokenInteger, seq[11].Type)
+	require.Equal(t, data, seq.Reconstruct())
+
+	// Tag tokens in patterns aren't split
+	seq, err = scanner.Scan("%integer%/%integer%")
+	require.NoError(t, err)
+	require.Equal(t, []string{"%integer%", "/", "%integer%"}, values(seq), seq.PrintTokens())
+
+	for _, chars := range []string{"a", "1", " ", "\"", "<"} {
+		require.Error(t, scanner.SetPunctuation(chars), chars)
+	}
+
+	// The default is the punctuation of the config, which the patterns are scanned with
+	defer func(punct string) { config.punctuation = punct }(config.punctuation)
+	config.punctuation = "/"
+
+	parser := NewParser()
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%appname% : %integer%/%integer%"}))
+
+	seq, err = NewScanner().Scan("haproxy: 10/0")
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.NoError(t, err, seq.PrintTokens())
+}
+
+func TestScannerSplitTimers(t *testing.T) {
+	scanner := NewScanner()
+	scanner.SetKeepText(true)
+
+	for data, n := range map[string]int{
+		"10/0/30/69/109": 9,
+		"-1/-1/+3":       5,
+		"0/0":            1,
+		"1/2/3/4/5/6":    1,
+		"1//2":           1,
+		"10/a/30":        1,
+		"10/14/2015":     1,
+		"0/0/5007":       5,
+	} {
+		seq, err := scanner.ScanHAProxy(data)
+		require.NoError(t, err, data)
+		require.Equal(t, n, len(seq), seq.PrintTokens())
+		require.Equal(t, data, seq.Reconstruct())
+
+		if n > 1 {
+			require.Equal(t, TokenInteger, seq[0].Type, seq.PrintTokens())
+			require.Equal(t, "/", seq[1].Value, seq.PrintTokens())
+		}
+
+		// Other messages are scanned without splitting the timers
+		seq, err = scanner.Scan(data)
+		require.NoError(t, err, data)
+		require.Equal(t, 1, len(seq), seq.PrintTokens())
+	}
+}
+
+func TestScannerScanStatement(t *testing.T) {
+	scanner := NewScanner()
+
+	// Statements are only joined if the scanner is set to
+	data := "Jan 12 06:49:42 db1 app[12]: executing query: SELECT * FROM users WHERE id = 5 AND name = 'o''brien' AND t1.x IN (1, 2, 3)"
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TokenLiteral, seq[10].Type, seq.PrintTokens())
+
+	scanner.SetJoinSQL(true)
+
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 11, len(seq), seq.PrintTokens())
+	require.Equal(t, TokenString, seq[10].Type, seq.PrintTokens())
+	require.Equal(t, "SELECT * FROM users WHERE id = 5 AND name = 'o''brien' AND t1.x IN (1, 2, 3)", seq[10].Value)
+
+	scanner.SetNormalizeSQL(true)
+
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, "SELECT * FROM users WHERE id = ? AND name = ? AND t1.x IN (?)", seq[10].Value)
+
+	data = `Jan 12 06:49:42 db1 app[12]: slow sql="update orders set total = 12.5 where id = 7" took 5 ms`
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, "update orders set total = ? where id = ?", seq[11].Value, seq.PrintTokens())
+	require.Equal(t, "took", seq[13].Value, seq.PrintTokens())
+
+	data = "Jan 12 06:49:42 db1 app[12]: please select a user"
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TokenLiteral, seq[8].Type, seq.PrintTokens())
+
+	// Keywords that aren't followed by the rest of a statement are left alone
+	for _, data := range []string{
+		"yum[123]: Update: bash-4.2.46 x86_64",
+		"status: update available for 3 packages",
+		"action: delete file /tmp/x size 1234",
+		"job: create backup of /var/lib in 5 mins",
+		"step: select the records with id = 42",
+		"msg: drop connection from 10.0.0.1",
+		"reason: insert failed, disk full",
+	} {
+		seq, err = scanner.Scan(data)
+		require.NoError(t, err, data)
+
+		for _, tok := range seq {
+			require.False(t, strings.Contains(tok.Value, " "), seq.PrintTokens())
+		}
+	}
+
+	seq, err = scanner.Scan("action: delete file /tmp/x size 1234")
+	require.NoError(t, err)
+	require.Equal(t, TokenInteger, seq[6].Type, seq.PrintTokens())
+
+	// Statements introduced as such are joined whatever follows the keyword
+	for data, stmt := range map[string]string{
+		"query: SELECT 1":                           "SELECT ?",
+		"execute <unnamed>: SELECT 1":               "SELECT ?",
+		"ddl: CREATE TABLE t (id int)":              "CREATE TABLE t (id int)",
+		"cte: WITH x AS (SELECT 1) SELECT * FROM x": "WITH x AS (SELECT ?) SELECT * FROM x",
+	} {
+		seq, err = scanner.Scan(data)
+		require.NoError(t, err, data)
+		require.Equal(t, stmt, seq[len(seq)-1].Value, seq.PrintTokens())
+	}
+}
+
+func TestScannerScanColumns(t *testing.T) {
+	scanner := NewScanner()
+
+	_, err := scanner.ScanColumns("20150223ERR")
+	require.Error(t, err)
+
+	defer func(columns []column) { config.columns = columns }(config.columns)
+	config.columns = nil
+
+	for _, c := range []string{"8", "5:severity", "10:apphost", "0"} {
+		col, err := parseColumn(c)
+		require.NoError(t, err, c)
+		config.columns = append(config.columns, col)
+	}
+
+	for _, c := range []string{"x", "-1", "5:nosuchtag", "5:srcip:x"} {
+		_, err := parseColumn(c)
+		require.Error(t, err, c)
+	}
+
+	data := "20150223    3dbserver01Disk full on 10.1.1.1"
+	seq, err := scanner.ScanColumns(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 7, len(seq), seq.PrintTokens())
+
+	require.Equal(t, Token{Type: TokenInteger, Tag: TagUnknown, Value: "20150223"}, seq[0])
+	require.Equal(t, Token{Type: TokenInteger, Tag: TagSeverity, Value: "3"}, seq[1])
+	require.Equal(t, Token{Type: TokenString, Tag: TagAppHost, Value: "dbserver01"}, seq[2])
+	require.Equal(t, Token{Type: TokenLiteral, Tag: TagUnknown, Value: "Disk"}, seq[3])
+	require.Equal(t, Token{Type: TokenIPv4, Tag: TagUnknown, Value: "10.1.1.1"}, seq[6])
+
+	data = "20150223     dbserver01"
+	seq, err = scanner.ScanColumns(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 2, len(seq), seq.PrintTokens())
+}
+
+func TestScannerScanJsonFields(t *testing.T) {
+	scanner := NewScanner()
+
+	require.Error(t, scanner.SetJsonFields([]string{"userIdentity..type"}, false))
+
+	data := `{"eventName":"ConsoleLogin","userIdentity":{"type":"Root","arn":"arn:aws:iam::1:root"},"records":[{"id":"a1"},{"id":"b2"}],"region":"us-east-1"}`
+
+	require.NoError(t, scanner.SetJsonFields([]string{"$.eventName", "userIdentity.type", "records[*].id"}, false))
+
+	seq, err := scanner.ScanJson(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 12, len(seq), seq.PrintTokens())
+	require.Equal(t, "eventName", seq[0].Value)
+	require.Equal(t, "userIdentity.type", seq[3].Value)
+	require.Equal(t, "records.0.id", seq[6].Value)
+	require.Equal(t, "b2", seq[11].Value)
+
+	require.NoError(t, scanner.SetJsonFields([]string{"userIdentity"}, true))
+
+	seq, err = scanner.ScanJson(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 7, len(seq), seq.PrintTokens())
+	require.Equal(t, "userIdentity.arn", seq[3].Value)
+	require.Equal(t, TagMsgRest, seq[6].Tag)
+	require.Equal(t, "eventName=ConsoleLogin records.0.id=a1 records.1.id=b2 region=us-east-1", seq[6].Value)
+
+	require.NoError(t, scanner.SetJsonFields(nil, false))
+
+	seq, err = scanner.ScanJson(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 18, len(seq), seq.PrintTokens())
+}
+
+func TestScannerScanAuto(t *testing.T) {
+	scanner := NewScanner()
+
+	data := `{"level":"info","msg":"started"}`
+	seq, err := scanner.ScanAuto(data)
+	require.NoError(t, err, data)
+	require.Equal(t, 6, len(seq), seq.PrintTokens())
+	require.True(t, seq[0].isKey)
+	require.Equal(t, "level", seq[0].Value)
+
+	data = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err = scanner.ScanAuto(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TokenTime, seq[0].Type, seq.PrintTokens())
+
+	data = "{worker 3} stopped {ok}"
+	seq, err = scanner.ScanAuto(data)
+	require.NoError(t, err, data)
+	require.Equal(t, "{", seq[0].Value, seq.PrintTokens())
+	require.False(t, seq[1].isKey)
+}
+
+func TestScannerScanWindows(t *testing.T) {
+	scanner := NewScanner()
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+	sig := seq.Signature()
+
+	for _, data := range []string{"\ufeff" + msg, msg + "\r", "\ufeff" + msg + "\r\r"} {
+		seq, err := scanner.Scan(data)
+		require.NoError(t, err, data)
+		require.Equal(t, sig, seq.Signature(), data)
+		require.Equal(t, "Jan 12 06:49:42", seq[0].Value, data)
+		require.Equal(t, "ssh2", seq[len(seq)-1].Value, data)
+	}
+
+	seq, err = scanner.ScanJson("\ufeff{\"user\": \"root\"}\r")
+	require.NoError(t, err)
+	require.Equal(t, "root", seq[len(seq)-1].Value)
+}
+
+func TestSequenceVisit(t *testing.T) {
+	scanner := NewScanner()
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+
+	var ipv4 string
+	n := 0
+
+	require.False(t, seq.Visit(func(tok Token) bool {
+		n++
+		if tok.Type == TokenIPv4 {
+			ipv4 = tok.Value
+			return false
+		}
+		return true
+	}))
+	require.Equal(t, "218.161.81.238", ipv4)
+	require.Equal(t, 13, n)
+
+	view := seq.View()
+	require.Equal(t, len(seq), view.Len())
+	require.Equal(t, seq[3], view.At(3))
+	require.Equal(t, 2, view.Slice(3, 5).Len())
+	require.Equal(t, seq[4], view.Slice(3, 5).At(1))
+
+	n = 0
+	require.True(t, view.Visit(func(tok Token) bool { n++; return true }))
+	require.Equal(t, len(seq), n)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		view.Visit(func(tok Token) bool { return tok.Type != TokenIPv4 })
+	})
+	require.Equal(t, 0.0, allocs)
+}
+
+func TestSequenceOffsets(t *testing.T) {
+	scanner := NewScanner()
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+
+	offsets := seq.Offsets(msg)
+	require.Equal(t, len(seq), len(offsets))
+
+	for i, t1 := range seq {
+		require.Equal(t, t1.Value, msg[offsets[i]:offsets[i]+len(t1.Value)], seq.PrintTokens())
+	}
+	require.Equal(t, []int{0, 16, 20, 24, 25, 29, 30}, offsets[:7])
+
+	seq = append(seq[:2], NewToken(TokenLiteral, "normalized"), NewToken(TokenLiteral, "sshd"))
+	require.Equal(t, []int{0, 16, -1, 20}, seq.Offsets(msg))
+}
+
+func TestSequenceReconstruct(t *testing.T) {
+	scanner := NewScanner()
+	scanner.SetKeepText(true)
+
+	for _, msg := range []string{
+		"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		"  leading and trailing spaces  ",
+		"traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 done",
+	} {
+		seq, err := scanner.Scan(msg)
+		require.NoError(t, err, msg)
+		require.Equal(t, msg, seq.Reconstruct(), seq.PrintTokens())
+	}
+
+	msg := `{"user":"root","src":"10.1.1.1","n":3}`
+	seq, err := scanner.ScanJson(msg)
+	require.NoError(t, err, msg)
+	require.Equal(t, msg, seq.Reconstruct(), seq.PrintTokens())
+
+	// Values changed in place are written instead of the text of the message, except
+	// for changes in case, e.g., by the parser
+	msg = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err = scanner.Scan(msg)
+	require.NoError(t, err, msg)
+
+	for i := range seq {
+		switch seq[i].Type {
+		case TokenIPv4:
+			seq[i].Value = "x.x.x.x"
+		case TokenLiteral:
+			seq[i].Value = strings.ToLower(seq[i].Value)
+		}
+	}
+	require.Equal(t, "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from x.x.x.x port 4228 ssh2", seq.Reconstruct())
+
+	// Sequences that weren't scanned have their values joined with spaces
+	seq, err = NewSequence(NewToken(TokenLiteral, "a"), NewToken(TokenInteger, "1"))
+	require.NoError(t, err)
+	require.Equal(t, "a 1", seq.Reconstruct())
+
+	// As do those scanned without keeping the text, which is the default
+	seq, err = NewScanner().Scan(`user="root" n=1`)
+	require.NoError(t, err)
+	require.Equal(t, `user = " root " n = 1`, seq.Reconstruct())
+}
+
+func TestSequencePrintTokensStyle(t *testing.T) {
+	scanner := NewScanner()
+
+	msg := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	seq, err := scanner.Scan(msg)
+	require.NoError(t, err, msg)
+
+	require.Equal(t, seq.PrintTokens(), seq.PrintTokensStyle(PrintFull, false))
+	require.Equal(t, `"Jan 12 06:49:42"/time irc sshd [ 7034/integer ] : Failed password for root from 218.161.81.238/ipv4 port 4228/integer ssh2`,
+		seq.PrintTokensStyle(PrintCompact, false))
+	require.Equal(t, "\x1b[36m\"Jan 12 06:49:42\"/time\x1b[0m irc", seq[:2].PrintTokensStyle(PrintCompact, true))
+
+	seq[1].Tag = TagAppHost
+	require.Equal(t, "#  TAG       TYPE     VALUE\n0  funknown  time     Jan 12 06:49:42\n1  apphost   literal  irc",
+		seq[:2].PrintTokensStyle(PrintTable, false))
+	require.Equal(t, "irc/%apphost%", seq[1:2].PrintTokensStyle(PrintCompact, false))
+}
+
 func TestScannerSignature(t *testing.T) {
 	scanner := NewScanner()
 
@@ -92,6 +624,92 @@ func TestScannerScan(t *testing.T) {
 	runTestCases(t, scantests)
 }
 
+func TestScannerIsHost(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		host bool
+	}{
+		{"db-prod-03.example.com", true},
+		{"db-prod-03.example.com.", true},
+		{"mail.example.co.uk", true},
+		{"example.com", false},
+		{"example.com.", true},
+		{"local4.info", false},
+		{"localhost.", false},
+		{"some.file.txt1", false},
+		{"-bad.example.com", false},
+		{"two..dots.com", false},
+		{"user@mail.example.com", false},
+	} {
+		require.Equal(t, tc.host, isHost(tc.data), tc.data)
+	}
+}
+
+func TestScannerScanAddresses(t *testing.T) {
+	scanner := NewScanner()
+
+	data := "deny tcp 192.168.1.5:443 -> 10.1.2.0/24 via 10.1.2.5/25 and 10.1.1.1 : 22 from 10.1.1.5#53"
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+
+	for _, tc := range []struct {
+		i     int
+		ttype TokenType
+		value string
+		addr  string
+		n     int
+	}{
+		{2, TokenIPPort, "192.168.1.5:443", "192.168.1.5", 443},
+		{5, TokenCIDR, "10.1.2.0/24", "10.1.2.0", 24},
+		{7, TokenIPv4, "10.1.2.5", "", 0},
+		{11, TokenIPv4, "10.1.1.1", "", 0},
+		{15, TokenIPPort, "10.1.1.5#53", "10.1.1.5", 53},
+	} {
+		tok := seq[tc.i]
+		require.Equal(t, tc.ttype, tok.Type, seq.PrintTokens())
+		require.Equal(t, tc.value, tok.Value, seq.PrintTokens())
+
+		addr, n, err := tok.SplitAddress()
+		if tc.addr == "" {
+			require.Error(t, err, tc.value)
+		} else {
+			require.NoError(t, err, tc.value)
+			require.Equal(t, tc.addr, addr, tc.value)
+			require.Equal(t, tc.n, n, tc.value)
+		}
+	}
+}
+
+func TestScannerScanKV(t *testing.T) {
+	scanner := NewScanner()
+
+	data := `Jan 12 06:49:42 irc kernel: dropping packet srcip=10.1.1.2 uid=1001 user="root" a = b on eth0 srchost=db.example.com`
+	seq, err := scanner.ScanKV(data)
+	require.NoError(t, err, data)
+
+	for _, tc := range []struct {
+		i     int
+		tok   Token
+		isKey bool
+	}{
+		{2, Token{Type: TokenLiteral, Tag: TagUnknown, Value: "kernel"}, false},
+		{6, Token{Type: TokenLiteral, Tag: TagUnknown, Value: "srcip"}, true},
+		{8, Token{Type: TokenIPv4, Tag: TagSrcIP, Value: "10.1.1.2"}, false},
+		{11, Token{Type: TokenInteger, Tag: TagSrcUid, Value: "1001"}, false},
+		{15, Token{Type: TokenString, Tag: TagSrcUser, Value: "root"}, false},
+		{17, Token{Type: TokenLiteral, Tag: TagUnknown, Value: "a"}, false},
+		{19, Token{Type: TokenLiteral, Tag: TagUnknown, Value: "b"}, false},
+		{24, Token{Type: TokenString, Tag: TagSrcHost, Value: "db.example.com"}, false},
+	} {
+		tok := seq[tc.i]
+		require.Equal(t, tc.tok.Type, tok.Type, seq.PrintTokens())
+		require.Equal(t, tc.tok.Tag, tok.Tag, seq.PrintTokens())
+		require.Equal(t, tc.tok.Value, tok.Value, seq.PrintTokens())
+		require.Equal(t, tc.isKey, tok.isKey, seq.PrintTokens())
+		require.Equal(t, tc.tok.Tag != TagUnknown, tok.isValue, seq.PrintTokens())
+	}
+}
+
 func BenchmarkScannerScanGeneral(b *testing.B) {
 	benchmarkScanner(b, scantests[0].data, "general")
 }
@@ -266,7 +884,7 @@ var (
 		},
 		{
 			"jan 12 06:49:41 irc sshd[7034]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=218-161-81-238.hinet-ip.hinet.net  user=root",
-			"%time%[%integer%]:(:):;==%integer%=%integer%====",
+			"%time%[%integer%]:(:):;==%integer%=%integer%===%host%=",
 		},
 		{
 			"jan 12 06:49:42 irc sshd[7034]: failed password for root from 218.161.81.238 port 4228 ssh2",
@@ -274,11 +892,11 @@ var (
 		},
 		{
 			"9.26.157.45 - - [16/jan/2003:21:22:59 -0500] \"get /wssamples/ http/1.1\" 200 1576",
-			"%ipv4%--[%time%]\"\"%integer%%integer%",
+			"%ipv4%--[%time%]\"%request%\"%integer%%integer%",
 		},
 		{
 			"209.36.88.3 - - [03/may/2004:01:19:07 +0000] \"get http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectrange&dr=0month&so=relevance&st=nw&ss=afr&sf=article&rc=00&clspage=0&docid=fin0000000r0jl000d00 http/1.0\" 200 27981",
-			"%ipv4%--[%time%]\"%uri%\"%integer%%integer%",
+			"%ipv4%--[%time%]\"%request%\"%integer%%integer%",
 		},
 		{
 			"4/5/2012 17:55,172.23.1.101,1101,172.23.0.10,139, generic protocol command decode,3, [1:2100538:17] gpl netbios smb ipc$ unicode share access ,tcp ttl:128 tos:0x0 id:1643 iplen:20 dgmlen:122 df,***ap*** seq: 0xcef93f32  ack: 0xc40c0bb  n: 0xfc9c  tcplen: 20,",
@@ -298,7 +916,7 @@ var (
 		},
 		{
 			"9.26.157.44 - - [16/jan/2003:21:22:59 -0500] \"get http://wssamples http/1.1\" 301 315",
-			"%ipv4%--[%time%]\"%uri%\"%integer%%integer%",
+			"%ipv4%--[%time%]\"%request%\"%integer%%integer%",
 		},
 		{
 			"2012-04-05 17:51:26     local4.info     172.23.0.1      %asa-6-302016: teardown udp connection 1315632 for inside:172.23.0.2/514 to identity:172.23.0.1/514 duration 0:09:23 bytes 7999",
@@ -354,7 +972,7 @@ var (
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "="},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "rhost"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "="},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "218-161-81-238.hinet-ip.hinet.net"},
+				Token{Type: TokenHost, Tag: TagUnknown, Value: "218-161-81-238.hinet-ip.hinet.net"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "user"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "="},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "root"},
@@ -408,9 +1026,7 @@ var (
 				Token{Type: TokenTime, Tag: TagUnknown, Value: "16/Jan/2003:21:22:59 -0500"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenURI, Tag: TagUnknown, Value: "http://WSsamples"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.1"},
+				Token{Type: TokenRequest, Tag: TagUnknown, Value: "GET http://WSsamples HTTP/1.1"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "301"},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "315"},
@@ -427,9 +1043,7 @@ var (
 				Token{Type: TokenTime, Tag: TagUnknown, Value: "16/Jan/2003:21:22:59 -0500"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "/WSsamples/"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.1"},
+				Token{Type: TokenRequest, Tag: TagUnknown, Value: "GET /WSsamples/ HTTP/1.1"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "200"},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "1576"},
@@ -446,9 +1060,7 @@ var (
 				Token{Type: TokenTime, Tag: TagUnknown, Value: "03/May/2004:01:19:07 +0000"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenURI, Tag: TagUnknown, Value: "http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.0"},
+				Token{Type: TokenRequest, Tag: TagUnknown, Value: "GET http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00 HTTP/1.0"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "200"},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "27981"},
@@ -999,9 +1611,7 @@ var (
 				Token{Type: TokenTime, Tag: TagUnknown, Value: "16/Jan/2003:21:22:59 -0500"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenURI, Tag: TagUnknown, Value: "http://WSsamples"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.1"},
+				Token{Type: TokenRequest, Tag: TagUnknown, Value: "GET http://WSsamples HTTP/1.1"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "301"},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "315"},
@@ -1018,9 +1628,7 @@ var (
 				Token{Type: TokenTime, Tag: TagUnknown, Value: "03/May/2004:01:19:07 +0000"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenURI, Tag: TagUnknown, Value: "http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.0"},
+				Token{Type: TokenRequest, Tag: TagUnknown, Value: "GET http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00 HTTP/1.0"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "200"},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "27981"},
@@ -1037,9 +1645,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "12/Jul/2013:15:56:54 +0000", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "]", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "GET", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/organizations/exampleorg/data/firewall/nova_api", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "HTTP/1.1", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenRequest, Value: "GET /organizations/exampleorg/data/firewall/nova_api HTTP/1.1", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "200", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
@@ -1068,7 +1674,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "version=1.0", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "some_node.example.com", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenHost, Value: "some_node.example.com", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "2013-07-12T15:56:40Z", isKey: false, isValue: false},
@@ -1090,9 +1696,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "03/May/2004:01:00:04 +0000", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "]", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "GET", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenURI, Value: "http://www.toxzyyphvc.com/xray/peterson.asp?ProdID=00000&LastUpdate=00000000&Stocks=00:00000|00:000|00:0000|00:000|00:0000|00:0000|00:0000|00:0000|00:000|00:00000|00:000|00:000|00:000|00:0000|00:0000|00:000|00:000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:00000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000&UpdType=0", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "HTTP/1.0", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenRequest, Value: "GET http://www.toxzyyphvc.com/xray/peterson.asp?ProdID=00000&LastUpdate=00000000&Stocks=00:00000|00:000|00:0000|00:000|00:0000|00:0000|00:0000|00:0000|00:000|00:00000|00:000|00:000|00:000|00:0000|00:0000|00:000|00:000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000|00:00000|00:0000|00:0000|00:0000|00:0000|00:0000|00:0000&UpdType=0 HTTP/1.0", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "200", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "281", isKey: false, isValue: false},
@@ -1104,12 +1708,8 @@ var (
 			`2014-02-15T23:39:43.945958Z my-test-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/HTTP/1.1"`, Sequence{
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "2014-02-15T23:39:43.945958Z", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "my-test-loadbalancer", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenIPv4, Value: "192.168.131.39", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ":", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenInteger, Value: "2817", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenIPv4, Value: "10.0.0.1", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ":", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenInteger, Value: "80", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenIPPort, Value: "192.168.131.39:2817", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenIPPort, Value: "10.0.0.1:80", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenFloat, Value: "0.000073", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenFloat, Value: "0.001048", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenFloat, Value: "0.000057", isKey: false, isValue: false},
@@ -1174,7 +1774,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenIPv4, Value: "10.11.22.33", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.headers.host", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "itsman.staging.quinpress.com", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenHost, Value: "itsman.staging.quinpress.com", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.server-port", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "3030", isKey: false, isValue: true},
@@ -1192,7 +1792,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/ping", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.server-name", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "xxxx.staging.strace.io", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenHost, Value: "xxxx.staging.strace.io", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.query-string", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "null", isKey: false, isValue: true},
@@ -1287,7 +1887,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "2014-03-06T21:22:54Z", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "eventSource", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "ec2.amazonaws.com", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenHost, Value: "ec2.amazonaws.com", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "eventName", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "StartInstances", isKey: false, isValue: true},
@@ -1350,7 +1950,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenTime, Value: "2014-01-31T12:00:00Z", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "eventSource", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "ec2.amazonaws.com", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenHost, Value: "ec2.amazonaws.com", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "eventName", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "DescribeInstances", isKey: false, isValue: true},
@@ -1362,7 +1962,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenIPv4, Value: "11.111.111.111", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "userAgent", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "aws-sdk-ruby/1.33.0 ruby/1.9.3 x86_64-linux", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenUserAgent, Value: "aws-sdk-ruby/1.33.0 ruby/1.9.3 x86_64-linux", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "requestParameters.instancesSet.items.0.instanceId", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "i-01234567", isKey: false, isValue: true},
@@ -0,0 +1,184 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// schemaExamples is the number of distinct example values kept for each field
+	schemaExamples = 3
+
+	// schemaExampleLen is the maximum length of an example value
+	schemaExampleLen = 40
+)
+
+// Schema infers the union schema of a set of json messages, i.e., all the keys
+// found in any of the messages, along with the types of their values, how often
+// they are present and a few example values. It complements the Analyzer for
+// structured logs, where the keys, rather than the text, are the pattern.
+//
+// Keys of nested objects are joined with ".", and the elements of arrays are
+// merged into a single "[*]" key, e.g., "records[*].id", so the keys can be used
+// directly as json fields for Scanner.SetJsonFields.
+type Schema struct {
+	n      int
+	fields map[string]*SchemaField
+}
+
+// SchemaField is a single key of the json messages added to a Schema.
+type SchemaField struct {
+	Key      string   // Key is the flattened key, e.g., "userIdentity.type".
+	Types    []string // Types are the json types of the values, e.g., "string" or "integer", sorted.
+	Count    int      // Count is the number of messages the key is present in.
+	Presence float64  // Presence is the fraction of messages the key is present in.
+	Examples []string // Examples are the first few distinct values of the key.
+
+	seen int // seen is the number of the last message the key is present in.
+}
+
+func NewSchema() *Schema {
+	return &Schema{
+		fields: make(map[string]*SchemaField),
+	}
+}
+
+// Add adds the keys of a single json message to the schema.
+func (this *Schema) Add(s string) error {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+
+	var v interface{}
+
+	if err := d.Decode(&v); err != nil {
+		return fmt.Errorf("Invalid json message %q: %v", s, err)
+	}
+
+	if _, ok := v.(map[string]interface{}); !ok {
+		return fmt.Errorf("Invalid json message %q: expecting an object", s)
+	}
+
+	this.n++
+	this.walk("", v)
+
+	return nil
+}
+
+// Len returns the number of messages added to the schema.
+func (this *Schema) Len() int {
+	return this.n
+}
+
+// Fields returns the fields of the schema, sorted by key.
+func (this *Schema) Fields() []SchemaField {
+	fields := make([]SchemaField, 0, len(this.fields))
+
+	for _, f := range this.fields {
+		field := *f
+		field.Presence = float64(f.Count) / float64(this.n)
+		fields = append(fields, field)
+	}
+
+	sort.Sort(schemaFields(fields))
+
+	return fields
+}
+
+func (this *Schema) walk(key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && key != "" {
+			this.add(key, "object", "{}")
+		}
+
+		for k, vv := range v {
+			if key != "" {
+				k = key + "." + k
+			}
+			this.walk(k, vv)
+		}
+
+	case []interface{}:
+		if len(v) == 0 {
+			this.add(key, "array", "[]")
+		}
+
+		for _, vv := range v {
+			this.walk(key+"[*]", vv)
+		}
+
+	case string:
+		this.add(key, "string", v)
+
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			this.add(key, "integer", v.String())
+		} else {
+			this.add(key, "number", v.String())
+		}
+
+	case bool:
+		this.add(key, "boolean", fmt.Sprintf("%t", v))
+
+	case nil:
+		this.add(key, "null", "null")
+	}
+}
+
+func (this *Schema) add(key, typ, example string) {
+	f, ok := this.fields[key]
+	if !ok {
+		f = &SchemaField{Key: key}
+		this.fields[key] = f
+	}
+
+	if f.seen != this.n {
+		f.seen = this.n
+		f.Count++
+	}
+
+	i := sort.SearchStrings(f.Types, typ)
+	if i == len(f.Types) || f.Types[i] != typ {
+		f.Types = append(f.Types, "")
+		copy(f.Types[i+1:], f.Types[i:])
+		f.Types[i] = typ
+	}
+
+	if len(f.Examples) == schemaExamples {
+		return
+	}
+
+	if len(example) > schemaExampleLen {
+		example = example[:schemaExampleLen] + "..."
+	}
+
+	for _, e := range f.Examples {
+		if e == example {
+			return
+		}
+	}
+
+	f.Examples = append(f.Examples, example)
+}
+
+type schemaFields []SchemaField
+
+func (this schemaFields) Len() int           { return len(this) }
+func (this schemaFields) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this schemaFields) Less(i, j int) bool { return this[i].Key < this[j].Key }
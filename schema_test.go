@@ -0,0 +1,63 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	schematests = []string{
+		`{"eventName":"ConsoleLogin","userIdentity":{"type":"Root"},"records":[{"id":1},{"id":2}],"mfa":true}`,
+		`{"eventName":"ListBuckets","userIdentity":{"type":"IAMUser","name":"alice"},"records":[],"mfa":null}`,
+		`{"eventName":"ListBuckets","userIdentity":{"type":"IAMUser","name":"bob"},"latency":1.5}`,
+		`{"eventName":"GetObject","userIdentity":{"type":"IAMUser"},"records":[{"id":"a1"}],"latency":12}`,
+	}
+)
+
+func TestSchemaFields(t *testing.T) {
+	schema := NewSchema()
+
+	for _, msg := range schematests {
+		require.NoError(t, schema.Add(msg), msg)
+	}
+
+	require.Error(t, schema.Add(`{"eventName":`))
+	require.Error(t, schema.Add(`["eventName"]`))
+	require.Equal(t, 4, schema.Len())
+
+	fields := schema.Fields()
+
+	var keys []string
+	for _, f := range fields {
+		keys = append(keys, f.Key)
+	}
+	require.Equal(t, []string{"eventName", "latency", "mfa", "records", "records[*].id", "userIdentity.name", "userIdentity.type"}, keys)
+
+	require.Equal(t, []string{"string"}, fields[0].Types)
+	require.Equal(t, 1.0, fields[0].Presence)
+	require.Equal(t, []string{"ConsoleLogin", "ListBuckets", "GetObject"}, fields[0].Examples)
+
+	require.Equal(t, []string{"integer", "number"}, fields[1].Types)
+	require.Equal(t, []string{"boolean", "null"}, fields[2].Types)
+	require.Equal(t, []string{"array"}, fields[3].Types)
+
+	require.Equal(t, []string{"integer", "string"}, fields[4].Types)
+	require.Equal(t, 2, fields[4].Count)
+	require.Equal(t, 0.5, fields[4].Presence)
+	require.Equal(t, []string{"1", "2", "a1"}, fields[4].Examples)
+}
@@ -15,9 +15,11 @@
 package sequence
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strings"
+	"text/tabwriter"
 )
 
 //go:generate go run genmethods.go -- reqmethods.go
@@ -27,9 +29,123 @@ var (
 	ErrNoMatch = errors.New("sequence: no pattern matched for this message")
 )
 
+// PrintStyle is the layout of the tokens printed by PrintTokensStyle.
+type PrintStyle int
+
+const (
+	PrintFull    PrintStyle = iota // One token per line with all its fields, same as PrintTokens
+	PrintCompact                   // All the tokens on a single line, as value/type or value/tag
+	PrintTable                     // One token per line, in aligned tag, type and value columns
+)
+
+// tokenColors are the ANSI colors of the token types printed by PrintTokensStyle.
+// Literals and the types not listed are not colored.
+var tokenColors = map[TokenType]string{
+	TokenTime:      "\x1b[36m", // cyan
+	TokenIPv4:      "\x1b[32m", // green
+	TokenIPv6:      "\x1b[32m",
+	TokenCIDR:      "\x1b[32m",
+	TokenIPPort:    "\x1b[32m",
+	TokenMac:       "\x1b[32m",
+	TokenHost:      "\x1b[32m",
+	TokenInteger:   "\x1b[33m", // yellow
+	TokenFloat:     "\x1b[33m",
+	TokenCurrency:  "\x1b[33m",
+	TokenPercent:   "\x1b[33m",
+	TokenURI:       "\x1b[34m", // blue
+	TokenRequest:   "\x1b[34m",
+	TokenUserAgent: "\x1b[34m",
+	TokenString:    "\x1b[35m", // magenta
+}
+
+const colorReset = "\x1b[0m"
+
 // Sequence represents a list of tokens returned from the scanner, analyzer or parser.
 type Sequence []Token
 
+// NewToken returns a token of the type with the value. The tag of the token is
+// determined by the parser or analyzer.
+func NewToken(tt TokenType, value string) Token {
+	return Token{Type: tt, Tag: TagUnknown, Value: value}
+}
+
+// NewSequence returns a Sequence built from tokens supplied by the caller, e.g.,
+// a protocol decoder that already splits messages into fields, so the Sequence
+// can be used with the Parser and Analyzer without formatting it as a message
+// and scanning it again. Tokens of type TokenUnknown are treated as literals.
+// It returns an error if any of the tokens has an invalid type or no value.
+func NewSequence(tokens ...Token) (Sequence, error) {
+	seq := make(Sequence, len(tokens))
+
+	for i, tok := range tokens {
+		if tok.Type < TokenUnknown || tok.Type >= token__END__ {
+			return nil, fmt.Errorf("Invalid token type %d for token %d", tok.Type, i)
+		}
+
+		if tok.Tag < TagUnknown || int(tok.Tag) >= TagTypesCount {
+			return nil, fmt.Errorf("Invalid tag type %d for token %d", tok.Tag, i)
+		}
+
+		if tok.Value == "" {
+			return nil, fmt.Errorf("Invalid token %d: empty value", i)
+		}
+
+		if tok.Type == TokenUnknown {
+			tok.Type = TokenLiteral
+		}
+
+		seq[i] = Token{Type: tok.Type, Tag: tok.Tag, Value: tok.Value}
+	}
+
+	return seq, nil
+}
+
+// Visit calls fn for each token in the sequence, in order, until fn returns false.
+// It returns false if the visit was stopped by fn.
+func (this Sequence) Visit(fn func(Token) bool) bool {
+	for _, tok := range this {
+		if !fn(tok) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// View returns a read-only view of the sequence. The view shares the tokens of the
+// sequence, so it is only valid for as long as the sequence is, e.g., until the
+// next time the Scanner that returned the sequence is used.
+func (this Sequence) View() SequenceView {
+	return SequenceView{seq: this}
+}
+
+// SequenceView is a read-only view of a Sequence. It lets callers inspect tokens
+// without copying the sequence, and without being able to modify it.
+type SequenceView struct {
+	seq Sequence
+}
+
+// Len returns the number of tokens in the view.
+func (this SequenceView) Len() int {
+	return len(this.seq)
+}
+
+// At returns the i-th token in the view.
+func (this SequenceView) At(i int) Token {
+	return this.seq[i]
+}
+
+// Slice returns a view of the tokens from i up to, but not including, j.
+func (this SequenceView) Slice(i, j int) SequenceView {
+	return SequenceView{seq: this.seq[i:j]}
+}
+
+// Visit calls fn for each token in the view, in order, until fn returns false.
+// It returns false if the visit was stopped by fn.
+func (this SequenceView) Visit(fn func(Token) bool) bool {
+	return this.seq.Visit(fn)
+}
+
 // String returns a single line string that represents the pattern for the Sequence
 func (this Sequence) String() string {
 	var p string
@@ -108,3 +224,198 @@ func (this Sequence) PrintTokens() string {
 
 	return str[:len(str)-1]
 }
+
+// PrintTokensStyle returns the tokens of the sequence in the style, optionally with
+// the values colored by token type using ANSI escape codes, which is easier to read
+// when inspecting the tokens in a terminal.
+func (this Sequence) PrintTokensStyle(style PrintStyle, color bool) string {
+	paint := func(t Token, s string) string {
+		if c, ok := tokenColors[t.Type]; ok && color {
+			return c + s + colorReset
+		}
+		return s
+	}
+
+	switch style {
+	case PrintCompact:
+		parts := make([]string, len(this))
+
+		for i, t := range this {
+			v := t.Value
+			if strings.ContainsAny(v, " /") {
+				v = fmt.Sprintf("%q", v)
+			}
+
+			switch {
+			case t.Tag != TagUnknown:
+				v += "/%" + t.Tag.String() + "%"
+			case t.Type != TokenLiteral:
+				v += "/" + t.Type.String()
+			}
+
+			parts[i] = paint(t, v)
+		}
+
+		return strings.Join(parts, " ")
+
+	case PrintTable:
+		var buf bytes.Buffer
+
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "#\tTAG\tTYPE\tVALUE\n")
+
+		for i, t := range this {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i, t.Tag, t.Type, paint(t, t.Value))
+		}
+		w.Flush()
+
+		return strings.TrimRight(buf.String(), "\n")
+	}
+
+	if !color {
+		return this.PrintTokens()
+	}
+
+	var str string
+	for i, t := range this {
+		str += paint(t, fmt.Sprintf("# %3d: %s", i, t)) + "\n"
+	}
+
+	return strings.TrimRight(str, "\n")
+}
+
+// Offsets returns the byte offset of each token in the message the sequence was
+// scanned from, found by searching for the token values in order. The offset is -1
+// for tokens whose value doesn't appear as is in the message, e.g., normalized SQL
+// statements, or the trace ID and span ID of a traceparent.
+func (this Sequence) Offsets(msg string) []int {
+	offsets := make([]int, len(this))
+	pos := 0
+
+	for i, t := range this {
+		j := strings.Index(msg[pos:], t.Value)
+		if j == -1 || t.Value == "" {
+			offsets[i] = -1
+			continue
+		}
+
+		offsets[i] = pos + j
+		pos += j + len(t.Value)
+	}
+
+	return offsets
+}
+
+// Reconstruct returns the message the sequence was scanned from, rebuilt from the
+// values of the tokens and the text kept between them, e.g., spaces, quotes and
+// the JSON syntax, by a Scanner set to keep it with SetKeepText, so a message can
+// be redacted in place by changing the values of some of its tokens, or checked to
+// round-trip. The values that differ from the message only in case, e.g., the
+// literals lowercased by the Parser, are written as they are in the message. The
+// tokens whose value isn't in the message as is, e.g., normalized SQL statements,
+// are written as they are in the message, and changes to them are lost.
+//
+// The message is the one the Scanner tokenized, without the byte order mark and
+// the trailing carriage returns. Sequences that weren't returned by the Scanner,
+// e.g., those built with NewSequence or returned by the Parser or Analyzer, have no
+// text between their tokens, so their values are joined with spaces, as are those
+// scanned without keeping the text.
+func (this Sequence) Reconstruct() string {
+	kept := false
+
+	for _, t := range this {
+		if t.kept != nil {
+			kept = true
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+
+	for i, t := range this {
+		switch {
+		case !kept:
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(t.Value)
+
+		case t.kept == nil || t.kept.raw == "":
+
+		case strings.EqualFold(t.Value, t.kept.raw):
+			buf.WriteString(t.kept.before)
+			buf.WriteString(t.kept.raw)
+
+		default:
+			buf.WriteString(t.kept.before)
+			buf.WriteString(t.Value)
+		}
+
+		if i == len(this)-1 && t.kept != nil {
+			buf.WriteString(t.kept.after)
+		}
+	}
+
+	return buf.String()
+}
+
+// text returns the text of the message the tokens were scanned from, from the first
+// token to the end of the message, as it is in the message, e.g., with its quotes,
+// spacing and case, if the Scanner kept the text around the tokens, see
+// Scanner.SetKeepText. Otherwise, the values of the tokens are joined with spaces.
+func (this Sequence) text() string {
+	var buf bytes.Buffer
+
+	for i, t := range this {
+		if t.kept == nil {
+			buf.Reset()
+			break
+		}
+
+		// the text of a token whose value isn't in the message as is is part of
+		// the text before the next token
+		if i > 0 {
+			buf.WriteString(t.kept.before)
+		}
+		buf.WriteString(t.kept.raw)
+
+		if i == len(this)-1 {
+			buf.WriteString(t.kept.after)
+			return buf.String()
+		}
+	}
+
+	for i, t := range this {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(t.Value)
+	}
+
+	return buf.String()
+}
+
+// keepText keeps the text of the message between the tokens for Reconstruct. Like
+// Offsets, the tokens are found by searching for their values in order, and the
+// text of the tokens that aren't found is kept as part of the text between them.
+func (this Sequence) keepText(msg string) {
+	kept := make([]keptText, len(this))
+	pos := 0
+
+	for i, t := range this {
+		this[i].kept = &kept[i]
+
+		j := strings.Index(msg[pos:], t.Value)
+		if j == -1 || t.Value == "" {
+			continue
+		}
+
+		kept[i].before = msg[pos : pos+j]
+		kept[i].raw = msg[pos+j : pos+j+len(t.Value)]
+		pos += j + len(t.Value)
+	}
+
+	if len(this) > 0 {
+		kept[len(this)-1].after = msg[pos:]
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sessionizer assigns a session ID to related log messages, e.g., the messages
+// logged by the same process on the same host, so that multi-line transactions
+// can be joined downstream. Messages belong to the same session if the tokens
+// extracted for the key tags, e.g., apphost and sessionid, have the same values,
+// and the messages are no more than the window apart. A window of 0 means the
+// messages can be any time apart.
+//
+// Patterns can also mark where sessions start and end using the SessionOpen and
+// SessionClose metadata, e.g., for sshd connections, in which case a message that
+// matches an open pattern always starts a new session, and a message that matches
+// a close pattern is the last message of its session.
+//
+// The Sessionizer is not safe for concurrent use.
+type Sessionizer struct {
+	keys     []TagType
+	window   time.Duration
+	sessions map[string]*session
+	latest   time.Time
+	n        int
+}
+
+type session struct {
+	id   string
+	last time.Time
+}
+
+// sessionPruneEvery is the number of sessions created between each pruning of the
+// sessions that are past the window.
+const sessionPruneEvery = 1024
+
+// NewSessionizer returns a Sessionizer that groups messages by the key fields, e.g.,
+// "apphost" and "sessionid", within the window.
+func NewSessionizer(window time.Duration, keys ...string) (*Sessionizer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Invalid session keys: expecting at least one field")
+	}
+
+	tags := make([]TagType, len(keys))
+
+	for i, key := range keys {
+		if tags[i] = name2TagType(key); tags[i] == TagUnknown {
+			return nil, fmt.Errorf("Invalid session key %q: unknown field", key)
+		}
+	}
+
+	return &Sessionizer{
+		keys:     tags,
+		window:   window,
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// Sessionize returns the session ID for the parsed message sequence and the pattern
+// it matched, which can be nil, along with the sequence with the ID appended as a
+// flowid token. If the sequence doesn't have a token for each of the key tags, it's
+// returned as is with an empty ID.
+func (this *Sessionizer) Sessionize(seq Sequence, pat *Pattern) (Sequence, string) {
+	key, ok := this.key(seq)
+	if !ok {
+		return seq, ""
+	}
+
+	var t time.Time
+
+	for _, tok := range seq {
+		if tok.Tag == TagMsgTime {
+			t, _ = ParseTime(tok.Value)
+			break
+		}
+	}
+
+	if t.After(this.latest) {
+		this.latest = t
+	}
+
+	s, ok := this.sessions[key]
+
+	if !ok || (pat != nil && pat.Session == SessionOpen) || this.expired(s, t) {
+		this.n++
+		s = &session{id: strconv.Itoa(this.n)}
+		this.sessions[key] = s
+
+		if this.n%sessionPruneEvery == 0 {
+			this.prune()
+		}
+	}
+
+	if !t.IsZero() {
+		s.last = t
+	}
+
+	if pat != nil && pat.Session == SessionClose {
+		delete(this.sessions, key)
+	}
+
+	return append(seq, Token{Type: TokenString, Tag: TagFlowID, Value: s.id}), s.id
+}
+
+// Len returns the number of sessions that are currently open.
+func (this *Sessionizer) Len() int {
+	return len(this.sessions)
+}
+
+// key returns the values of the key tags in the sequence joined together, and
+// false if any of them is missing.
+func (this *Sessionizer) key(seq Sequence) (string, bool) {
+	values := make([]string, len(this.keys))
+
+LOOP:
+	for i, tag := range this.keys {
+		for _, tok := range seq {
+			if tok.Tag == tag {
+				values[i] = tok.Value
+				continue LOOP
+			}
+		}
+
+		return "", false
+	}
+
+	return strings.Join(values, "\x00"), true
+}
+
+// expired returns true if the message at time t is past the window of the session.
+// Messages without a time never expire a session.
+func (this *Sessionizer) expired(s *session, t time.Time) bool {
+	if this.window == 0 || t.IsZero() || s.last.IsZero() {
+		return false
+	}
+
+	return t.Sub(s.last) > this.window
+}
+
+// prune removes the sessions that are past the window of the latest message seen,
+// so long running sessionizers don't keep every session ever seen.
+func (this *Sessionizer) prune() {
+	if this.window == 0 || this.latest.IsZero() {
+		return
+	}
+
+	for key, s := range this.sessions {
+		if this.expired(s, this.latest) {
+			delete(this.sessions, key)
+		}
+	}
+}
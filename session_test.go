@@ -0,0 +1,126 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionizerSessionize(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pats := []Pattern{
+		{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : connection from %srcip% port %srcport%", Session: SessionOpen},
+		{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser%"},
+		{Text: "%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed", Session: SessionClose},
+		{Text: "%msgtime% %apphost% %appname% : %string:-%"},
+	}
+
+	for i := range pats {
+		require.NoError(t, parser.AddPattern(pats[i]))
+	}
+
+	_, err := NewSessionizer(time.Minute)
+	require.Error(t, err)
+
+	_, err = NewSessionizer(time.Minute, "apphost", "pid")
+	require.Error(t, err)
+
+	s, err := NewSessionizer(5*time.Minute, "apphost", "sessionid")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		msg string
+		id  string
+	}{
+		{"Jan 12 06:49:40 irc sshd[7034]: connection from 218.161.81.238 port 4228", "1"},
+		{"Jan 12 06:49:41 irc sshd[7035]: connection from 218.161.81.239 port 4229", "2"},
+		{"Jan 12 06:49:42 irc sshd[7034]: accepted password for root", "1"},
+		{"Jan 12 06:49:42 jlz sshd[7034]: accepted password for root", "3"},
+		{"Jan 12 06:49:43 irc sshd[7034]: connection closed", "1"},
+		{"Jan 12 06:49:44 irc sshd[7034]: accepted password for root", "4"},
+		{"Jan 12 06:49:45 irc sshd[7035]: connection from 218.161.81.239 port 4229", "5"},
+		{"Jan 12 07:49:45 irc sshd[7034]: accepted password for root", "6"},
+		{"Jan 12 07:49:46 irc cron: job started", ""},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, pat, err := parser.Match(seq)
+		require.NoError(t, err, tc.msg)
+
+		n := len(seq)
+		seq, id := s.Sessionize(seq, pat)
+		require.Equal(t, tc.id, id, tc.msg)
+
+		if tc.id == "" {
+			require.Equal(t, n, len(seq), tc.msg)
+		} else {
+			require.Equal(t, n+1, len(seq), tc.msg)
+			require.Equal(t, TagFlowID, seq[n].Tag, tc.msg)
+			require.Equal(t, tc.id, seq[n].Value, tc.msg)
+		}
+	}
+
+	require.Equal(t, 3, s.Len())
+}
+
+func TestSessionizerQueueID(t *testing.T) {
+	var pats []Pattern
+
+	for _, file := range []string{"patterns/postfix.txt", "patterns/sendmail.txt"} {
+		p, err := ReadPatterns(file)
+		require.NoError(t, err, file)
+		pats = append(pats, p...)
+	}
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	s, err := NewSessionizer(0, "apphost", "queueid")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		msg string
+		id  string
+	}{
+		{"Oct 14 15:04:05 mail postfix/smtpd[1234]: 4BCDE1A2B3: client=unknown[10.1.1.5]", "1"},
+		{"Oct 14 15:04:05 mail postfix/cleanup[1235]: 4BCDE1A2B3: message-id=<20151014150405.4BCDE1A2B3@mail.example.com>", "1"},
+		{"Oct 14 15:04:05 mail postfix/smtpd[1234]: 5CDEF2B3C4: client=unknown[10.1.1.6]", "2"},
+		{"Oct 14 15:04:05 mail postfix/qmgr[1236]: 4BCDE1A2B3: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)", "1"},
+		{"Oct 14 15:04:06 mail postfix/smtp[1237]: 4BCDE1A2B3: to=<bob@example.com>, relay=mx.example.com[10.2.2.2]:25, delay=0.51, delays=0.1/0.01/0.2/0.2, dsn=2.0.0, status=sent (250 2.0.0 OK 1444835046)", "1"},
+		{"Oct 14 15:04:06 mail postfix/qmgr[1236]: 4BCDE1A2B3: removed", "1"},
+		{"Oct 14 15:04:07 mail postfix/smtp[1238]: 5CDEF2B3C4: to=<carol@example.com>, relay=none, delay=1.2, delays=0.1/0/1.1/0, dsn=4.4.1, status=deferred (connect to mx.example.org[10.3.3.3]:25: Connection timed out)", "2"},
+		{"Oct 14 15:04:08 mail sendmail[2234]: t9EF45aB012345: from=<alice@example.com>, size=1234, class=0, nrcpts=1, msgid=<1@example.com>, proto=ESMTP, daemon=MTA, relay=localhost [127.0.0.1]", "3"},
+		{"Oct 14 15:04:09 mail sendmail[2235]: t9EF45aB012345: to=<bob@example.com>, delay=00:00:01, xdelay=00:00:01, mailer=esmtp, pri=120000, relay=mx.example.com. [10.2.2.2], dsn=2.0.0, stat=Sent (OK)", "3"},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, pat, err := parser.Match(seq)
+		require.NoError(t, err, tc.msg)
+
+		_, id := s.Sessionize(seq, pat)
+		require.Equal(t, tc.id, id, tc.msg)
+	}
+
+	require.Equal(t, 2, s.Len())
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+)
+
+var (
+	// mysqlSlowTime and mysqlSlowUser are the header lines that start the entries of
+	// a MySQL slow query log. The time is only logged when it changed since the last
+	// entry, so an entry starts at whichever comes first.
+	mysqlSlowTime = []byte("# Time:")
+	mysqlSlowUser = []byte("# User@Host:")
+
+	// mysqlSlowPreamble are the lines the server writes at the top of the log every
+	// time it starts, which aren't part of any entry
+	mysqlSlowPreamble = [][]byte{
+		[]byte("Tcp port:"),
+		[]byte("Time                 Id Command"),
+	}
+)
+
+// splitMySQLSlow is a split function that splits a MySQL slow query log into its
+// entries, e.g.,
+//
+//	# Time: 2019-01-07T15:04:05.123456Z
+//	# User@Host: app[app] @ localhost [127.0.0.1]  Id:    42
+//	# Query_time: 2.501234  Lock_time: 0.000120 Rows_sent: 1  Rows_examined: 500000
+//	SET timestamp=1546873445;
+//	SELECT * FROM orders WHERE customer_id = 42;
+//
+// The "# " in front of the header lines is removed, since records starting with
+// "#" are comments, and so are the preamble lines the server writes when it starts.
+func splitMySQLSlow(data []byte, atEOF bool) (int, []byte, error) {
+	n, tok, err := splitRecords(indexMySQLSlow)(data, atEOF)
+	if tok == nil {
+		return n, tok, err
+	}
+
+	// The record is cleaned in place, so it still starts where it was in data
+	clean := tok[:0]
+
+	for len(tok) > 0 {
+		line := tok
+		if i := bytes.IndexByte(tok, '\n'); i != -1 {
+			line, tok = tok[:i], tok[i+1:]
+		} else {
+			tok = nil
+		}
+
+		if isMySQLSlowPreamble(line) {
+			continue
+		}
+
+		if bytes.HasPrefix(line, []byte("# ")) {
+			line = line[2:]
+		}
+
+		if len(clean) > 0 {
+			clean = append(clean, '\n')
+		}
+		clean = append(clean, line...)
+	}
+
+	return n, clean, err
+}
+
+// indexMySQLSlow returns the position and length of the line break before the first
+// header line in data that starts an entry, other than at the start of data.
+func indexMySQLSlow(data []byte) (int, int) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\n' {
+			continue
+		}
+
+		next := data[i+1:]
+
+		// Request more data if the line isn't long enough to tell
+		for _, h := range [][]byte{mysqlSlowTime, mysqlSlowUser} {
+			if len(next) < len(h) && bytes.HasPrefix(h, next) {
+				return -1, 0
+			}
+		}
+
+		if bytes.HasPrefix(next, mysqlSlowTime) {
+			return i, 1
+		}
+
+		if bytes.HasPrefix(next, mysqlSlowUser) {
+			// The user line after a time line is part of the same entry
+			start := bytes.LastIndexByte(data[:i], '\n') + 1
+			if !bytes.HasPrefix(data[start:i], mysqlSlowTime) {
+				return i, 1
+			}
+		}
+	}
+
+	return -1, 0
+}
+
+// isMySQLSlowPreamble returns true if the line is one of the preamble lines, which
+// include the first line, e.g., "/usr/sbin/mysqld, Version: 8.0.15 ... started with:".
+func isMySQLSlowPreamble(line []byte) bool {
+	if len(line) > 0 && line[0] == '/' && bytes.Contains(line, []byte(", Version: ")) {
+		return true
+	}
+
+	for _, p := range mysqlSlowPreamble {
+		if bytes.HasPrefix(line, p) {
+			return true
+		}
+	}
+
+	return false
+}
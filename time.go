@@ -14,7 +14,12 @@
 
 package sequence
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type timeNode struct {
 	ntype    int
@@ -38,12 +43,33 @@ const (
 var (
 	timeFsmRoot   *timeNode
 	minTimeLength int = 1000
+
+	// weekDateShapes are the shapes of the ISO 8601 week dates, which time.Parse
+	// doesn't support, so they are only used to recognize time tokens, and parsed
+	// by parseWeekDate.
+	weekDateShapes = []string{
+		"2006W011",
+		"2006-W01-1",
+		"2006-W01-1T15:04:05",
+		"2006-W01-1T15:04:05Z",
+		"2006-W01-1T15:04:05Z07:00",
+		"2006-W01-1T15:04:05.000Z",
+		"2006-W01-1T15:04:05.000Z07:00",
+	}
+)
+
+const (
+	// WeekDateLayout and WeekDateBasicLayout are the layouts returned by
+	// Token.TimeLayout for ISO 8601 week dates, e.g., "2015-W05-3" and "2015W053".
+	// If the week date has a time, the layout of the time is appended after a "T".
+	WeekDateLayout      = "YYYY-Www-D"
+	WeekDateBasicLayout = "YYYYWwwD"
 )
 
 func buildTimeFSM(fmts []string) *timeNode {
 	root := &timeNode{ntype: timeNodeRoot}
 
-	for i, f := range fmts {
+	for i, f := range append(fmts[:len(fmts):len(fmts)], weekDateShapes...) {
 		f = strings.ToLower(f)
 		if len(f) < minTimeLength {
 			minTimeLength = len(f)
@@ -118,3 +144,176 @@ func timeStep(r rune, cur *timeNode) *timeNode {
 
 	return nil
 }
+
+// ParseTime converts the value of a TokenTime token into a time.Time by trying
+// each of the time formats listed in the configuration file, in order. Since
+// many log formats omit the year, the returned time may have a year of 0, which
+// can be inferred using a YearInferrer.
+//
+// Times with a time zone abbreviation, e.g., IST, are in the IANA time zone that's
+// configured for it in the timeZones table of the configuration file, if any.
+//
+// Leap seconds, e.g., 23:59:60, are accepted and returned as the first second of
+// the next minute, and ISO 8601 week dates, e.g., 2015-W05-3, are accepted even
+// though they are not time formats.
+func ParseTime(s string) (time.Time, error) {
+	t, _, err := parseTime(s)
+	return t, err
+}
+
+// parseTime returns the time, and the layout it was parsed with.
+func parseTime(s string) (time.Time, string, error) {
+	if t, layout, ok := matchTime(s); ok {
+		return t, layout, nil
+	}
+
+	// time.Parse rejects the 60th second, so it's parsed as the 59th and moved on
+	if i := strings.LastIndex(s, ":60"); i >= 5 && s[i-3] == ':' && (i+3 == len(s) || s[i+3] < '0' || s[i+3] > '9') {
+		if t, layout, ok := matchTime(s[:i] + ":59" + s[i+3:]); ok {
+			return t.Add(time.Second), layout, nil
+		}
+	}
+
+	return time.Time{}, "", fmt.Errorf("Invalid time %q: no matching time format", s)
+}
+
+func matchTime(s string) (time.Time, string, bool) {
+	for _, f := range config.timeFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return inTimeZone(t, f), f, true
+		}
+	}
+
+	return parseWeekDate(s)
+}
+
+// inTimeZone returns the time parsed with the layout in the IANA time zone that's
+// configured for its time zone abbreviation, if any. time.Parse doesn't know the
+// offset of most abbreviations, so it returns times with a fabricated location
+// that has a zero offset.
+func inTimeZone(t time.Time, layout string) time.Time {
+	if !strings.Contains(layout, "MST") {
+		return t
+	}
+
+	abbr, _ := t.Zone()
+
+	loc, ok := config.timeZones[abbr]
+	if !ok {
+		return t
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// parseWeekDate parses an ISO 8601 week date, e.g., "2015-W05-3" or "2015W053",
+// which can be followed by a "T" and a time, e.g., "2015-W05-3T10:15:00Z".
+func parseWeekDate(s string) (time.Time, string, bool) {
+	date, clock := s, ""
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		date, clock = s[:i], s[i+1:]
+	}
+
+	var y, w, d, layout string
+
+	switch {
+	case len(date) == 10 && date[4] == '-' && date[5] == 'W' && date[8] == '-':
+		y, w, d, layout = date[:4], date[6:8], date[9:], WeekDateLayout
+	case len(date) == 8 && date[4] == 'W':
+		y, w, d, layout = date[:4], date[5:7], date[7:], WeekDateBasicLayout
+	default:
+		return time.Time{}, "", false
+	}
+
+	year, err1 := strconv.Atoi(y)
+	week, err2 := strconv.Atoi(w)
+	day, err3 := strconv.Atoi(d)
+	if err1 != nil || err2 != nil || err3 != nil || week < 1 || week > 53 || day < 1 || day > 7 {
+		return time.Time{}, "", false
+	}
+
+	// Week 1 is the week with January 4th in it, and weeks start on Monday
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	t := jan4.AddDate(0, 0, (week-1)*7+day-1-(int(jan4.Weekday())+6)%7)
+
+	// Only some years have a week 53
+	if _, n := t.ISOWeek(); n != week {
+		return time.Time{}, "", false
+	}
+
+	if clock == "" {
+		return t, layout, true
+	}
+
+	for _, f := range []string{"15:04:05Z07:00", "15:04:05.999999999Z07:00", "15:04:05", "15:04:05.999999999"} {
+		if c, err := time.Parse(f, clock); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), c.Hour(), c.Minute(), c.Second(), c.Nanosecond(), c.Location()), layout + "T" + f, true
+		}
+	}
+
+	return time.Time{}, "", false
+}
+
+// YearInferrer infers the year of the times parsed from time formats without a
+// year, such as classic syslog timestamps, which ParseTime returns with a year of
+// 0. The year of the first time is the latest one that doesn't put it after the
+// reference time, e.g., the modification time of the file the messages are read
+// from, and later times are kept close to the previous ones, so the year rolls
+// over when the messages go from December to January.
+//
+// The YearInferrer is not safe for concurrent use.
+type YearInferrer struct {
+	ref  time.Time
+	last time.Time
+}
+
+const (
+	// yearSlack is how far the first time can be after the reference time and still
+	// be in the year of the reference time, to allow for clock skew and time zones.
+	yearSlack = 24 * time.Hour
+
+	// yearRollover is how far a time has to be before the previous time to be taken
+	// to be in the next year, or after it to be taken to be in the previous year.
+	yearRollover = 183 * 24 * time.Hour
+)
+
+// NewYearInferrer returns a YearInferrer that infers the years relative to the
+// reference time, which should be no earlier than the newest message.
+func NewYearInferrer(ref time.Time) *YearInferrer {
+	return &YearInferrer{ref: ref}
+}
+
+// Infer returns the time with the inferred year if it has a year of 0, or as is
+// otherwise. Either way, the time is used to infer the year of the next one.
+func (this *YearInferrer) Infer(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	if t.Year() != 0 {
+		this.last = t
+		return t
+	}
+
+	if this.last.IsZero() {
+		t = withYear(t, this.ref.Year())
+		if t.Sub(this.ref) > yearSlack {
+			t = withYear(t, this.ref.Year()-1)
+		}
+	} else {
+		t = withYear(t, this.last.Year())
+		if d := t.Sub(this.last); d < -yearRollover {
+			t = withYear(t, this.last.Year()+1)
+		} else if d > yearRollover {
+			t = withYear(t, this.last.Year()-1)
+		}
+	}
+
+	this.last = t
+
+	return t
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
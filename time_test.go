@@ -0,0 +1,130 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	parsetimetests = []struct {
+		data string
+		t    time.Time
+	}{
+		{"Jan 12 06:49:42", time.Date(0, time.January, 12, 6, 49, 42, 0, time.UTC)},
+		{"may  5 18:07:27", time.Date(0, time.May, 5, 18, 7, 27, 0, time.UTC)},
+		{"2005-03-18 14:01:46", time.Date(2005, time.March, 18, 14, 1, 46, 0, time.UTC)},
+		{"2014-01-31T12:00:00Z", time.Date(2014, time.January, 31, 12, 0, 0, 0, time.UTC)},
+		{"2016-12-31 23:59:60", time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"Dec 31 23:59:60", time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"2015-032T10:15:00Z", time.Date(2015, time.February, 1, 10, 15, 0, 0, time.UTC)},
+		{"2015-W05-3", time.Date(2015, time.January, 28, 0, 0, 0, 0, time.UTC)},
+		{"2015W053", time.Date(2015, time.January, 28, 0, 0, 0, 0, time.UTC)},
+		{"2015-W05-3T10:15:00Z", time.Date(2015, time.January, 28, 10, 15, 0, 0, time.UTC)},
+		{"2009-W01-1", time.Date(2008, time.December, 29, 0, 0, 0, 0, time.UTC)},
+		{"2015-W53-7", time.Date(2016, time.January, 3, 0, 0, 0, 0, time.UTC)},
+	}
+)
+
+func TestParseTime(t *testing.T) {
+	for _, tc := range parsetimetests {
+		tm, err := ParseTime(tc.data)
+		require.NoError(t, err, tc.data)
+		require.True(t, tc.t.Equal(tm), tc.data+" != "+tm.String())
+	}
+
+	for _, data := range []string{"not a time", "2014-W53-1", "2015-W05-8", "12:60:00"} {
+		_, err := ParseTime(data)
+		require.Error(t, err, data)
+	}
+}
+
+func TestTokenTimeLayout(t *testing.T) {
+	scanner := NewScanner()
+
+	for _, tc := range []struct {
+		data, layout string
+	}{
+		{"Jan 12 06:49:42 irc sshd[7034]: started", "Jan _2 15:04:05"},
+		{"2016-12-31 23:59:60 leap second", "2006-01-02 15:04:05"},
+		{"2015-032T10:15:00Z started", "2006-002T15:04:05Z07:00"},
+		{"2015-W05-3 started", WeekDateLayout},
+		{"2015-W05-3T10:15:00Z started", WeekDateLayout + "T15:04:05Z07:00"},
+	} {
+		seq, err := scanner.Scan(tc.data)
+		require.NoError(t, err, tc.data)
+		require.Equal(t, TokenTime, seq[0].Type, seq.PrintTokens())
+
+		layout, err := seq[0].TimeLayout()
+		require.NoError(t, err, tc.data)
+		require.Equal(t, tc.layout, layout, tc.data)
+	}
+
+	_, err := Token{Type: TokenLiteral, Value: "started"}.TimeLayout()
+	require.Error(t, err)
+}
+
+func TestYearInferrerInfer(t *testing.T) {
+	ref := time.Date(2015, time.January, 2, 8, 0, 0, 0, time.UTC)
+	years := NewYearInferrer(ref)
+
+	for _, tc := range []struct {
+		t    time.Time
+		year int
+	}{
+		{time.Date(0, time.December, 30, 23, 59, 58, 0, time.UTC), 2014},
+		{time.Date(0, time.December, 31, 23, 59, 59, 0, time.UTC), 2014},
+		{time.Date(0, time.December, 31, 23, 59, 57, 0, time.UTC), 2014},
+		{time.Date(0, time.January, 1, 0, 0, 1, 0, time.UTC), 2015},
+		{time.Date(0, time.January, 1, 0, 0, 2, 0, time.UTC), 2015},
+		{time.Date(2005, time.March, 18, 14, 1, 46, 0, time.UTC), 2005},
+		{time.Date(0, time.March, 18, 14, 1, 47, 0, time.UTC), 2005},
+	} {
+		tm := years.Infer(tc.t)
+		require.Equal(t, tc.year, tm.Year(), tc.t.String())
+		require.Equal(t, tc.t.Month(), tm.Month(), tc.t.String())
+		require.Equal(t, tc.t.Day(), tm.Day(), tc.t.String())
+	}
+
+	// The first time is in the year of the reference time, unless that puts it after
+	years = NewYearInferrer(ref)
+	require.Equal(t, 2015, years.Infer(time.Date(0, time.January, 2, 7, 0, 0, 0, time.UTC)).Year())
+
+	years = NewYearInferrer(ref)
+	require.Equal(t, 2014, years.Infer(time.Date(0, time.January, 5, 7, 0, 0, 0, time.UTC)).Year())
+
+	require.True(t, years.Infer(time.Time{}).IsZero())
+}
+
+func TestParseTimeZones(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	defer func(zones map[string]*time.Location) { config.timeZones = zones }(config.timeZones)
+	config.timeZones = map[string]*time.Location{"IST": kolkata}
+
+	tm, err := ParseTime("Mon Jan  2 15:04:05 IST 2006")
+	require.NoError(t, err)
+	require.True(t, time.Date(2006, time.January, 2, 9, 34, 5, 0, time.UTC).Equal(tm), tm.String())
+
+	// Abbreviations that are not configured keep a zero offset
+	tm, err = ParseTime("Mon Jan  2 15:04:05 XYZ 2006")
+	require.NoError(t, err)
+	_, offset := tm.Zone()
+	require.Equal(t, 0, offset)
+}
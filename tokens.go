@@ -14,7 +14,11 @@
 
 package sequence
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type (
 	// TagType is the semantic representation of a token.
@@ -26,9 +30,11 @@ type (
 
 // Token is a piece of information extracted from a log message. The Scanner will do
 // its best to determine the TokenType which could be a time stamp, IPv4 or IPv6
-// address, a URL, a mac address, an integer or a floating point number. In addition,
-// if the Scanner finds a token that's surrounded by %, e.g., %srcuser%, it will
-// try to determine the correct tag type the token represents.
+// address, an IPv4 network or address and port, a URL, an HTTP request line or user
+// agent, a mac address, a host name, an integer or a floating point number, a
+// currency amount or a percentage. In addition, if the Scanner finds a token that's
+// surrounded by %, e.g., %srcuser%, it will try to determine the correct tag type
+// the token represents.
 type Token struct {
 	Type  TokenType // Type is the type of token the Value represents.
 	Tag   TagType   // Tag determines which tag the Value should be.
@@ -42,10 +48,25 @@ type Token struct {
 	star  bool // For parser, should this token consume zero or more tokens
 
 	until string // For parser, consume all tokens until, but not including, this string
+
+	kept *keptText // For Reconstruct, the text of the message around the token, if kept
+}
+
+// keptText is the text of the message a token was scanned from, which is kept by
+// Scanners set to keep it, see Scanner.SetKeepText.
+type keptText struct {
+	// before is the text between the previous token and this one, raw is the text
+	// of this token in the message, empty if its value isn't in the message as is,
+	// and, for the last token, after is the text after it
+	before, raw, after string
 }
 
 func (this Token) String() string {
-	return fmt.Sprintf("{ Tag=%q, Type=%q, Value=%q, isKey=%t, isValue=%t, minus=%t, plus=%t, star=%t }", this.Tag, this.Type, this.Value, this.isKey, this.isValue, this.minus, this.plus, this.star)
+	return this.format(this.Tag.String())
+}
+
+func (this Token) format(tag string) string {
+	return fmt.Sprintf("{ Tag=%q, Type=%q, Value=%q, isKey=%t, isValue=%t, minus=%t, plus=%t, star=%t }", tag, this.Type, this.Value, this.isKey, this.isValue, this.minus, this.plus, this.star)
 }
 
 const (
@@ -54,13 +75,19 @@ const (
 	TokenTime                       // Token is a timestamp, in the format listed in TimeFormats
 	TokenIPv4                       // Token is an IPv4 address, in the form of a.b.c.d
 	TokenIPv6                       // Token is an IPv6 address
+	TokenCIDR                       // Token is an IPv4 network, in the form of a.b.c.d/n
+	TokenIPPort                     // Token is an IPv4 address and port, in the form of a.b.c.d:port or a.b.c.d#port
 	TokenInteger                    // Token is an integer number
 	TokenFloat                      // Token is a floating point number
+	TokenCurrency                   // Token is a currency amount, such as $1,234.56 or €99.00
+	TokenPercent                    // Token is a percentage, such as 85% or 12.5%
 	TokenURI                        // Token is an URL, in the form of http://... or https://...
+	TokenRequest                    // Token is an HTTP request line, in the form of GET /path HTTP/1.1
+	TokenUserAgent                  // Token is an HTTP user agent, such as Mozilla/5.0 (...) ...
 	TokenMac                        // Token is a mac address
+	TokenHost                       // Token is a host name or FQDN, in the form of label.label.tld
 	TokenString                     // Token is a string that reprensents multiple possible values
 	token__END__                    // All tag types must be inserted before this one
-	token__host__                   // Token is a host name
 	token__email__                  // Token is an email address
 )
 
@@ -72,13 +99,19 @@ var tokens = [...]struct {
 	{"time"},
 	{"ipv4"},
 	{"ipv6"},
+	{"cidr"},
+	{"ipport"},
 	{"integer"},
 	{"float"},
+	{"currency"},
+	{"percent"},
 	{"uri"},
+	{"request"},
+	{"useragent"},
 	{"mac"},
+	{"host"},
 	{"string"},
 	{"token__END__"},
-	{"token__host__"},
 	{"token__email__"},
 }
 
@@ -86,6 +119,131 @@ func (this TokenType) String() string {
 	return tokens[this].label
 }
 
+// SplitAddress returns the IPv4 address, and the prefix length or the port, of a
+// TokenCIDR or TokenIPPort token.
+func (this Token) SplitAddress() (string, int, error) {
+	var sep string
+
+	switch this.Type {
+	case TokenCIDR:
+		sep = "/"
+	case TokenIPPort:
+		sep = ":#"
+	default:
+		return "", 0, fmt.Errorf("Invalid token type %q: expecting cidr or ipport", this.Type)
+	}
+
+	i := strings.LastIndexAny(this.Value, sep)
+	if i == -1 {
+		return "", 0, fmt.Errorf("Invalid %s token %q: missing %q", this.Type, this.Value, sep)
+	}
+
+	n, err := strconv.Atoi(this.Value[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid %s token %q: %v", this.Type, this.Value, err)
+	}
+
+	return this.Value[:i], n, nil
+}
+
+// SplitRequest returns the method, path and protocol of a TokenRequest token.
+func (this Token) SplitRequest() (method, path, proto string, err error) {
+	if this.Type != TokenRequest {
+		return "", "", "", fmt.Errorf("Invalid token type %q: expecting request", this.Type)
+	}
+
+	i, j := strings.Index(this.Value, " "), strings.LastIndex(this.Value, " ")
+	if i == -1 || i == j {
+		return "", "", "", fmt.Errorf("Invalid request token %q: expecting \"method path protocol\"", this.Value)
+	}
+
+	return this.Value[:i], this.Value[i+1 : j], this.Value[j+1:], nil
+}
+
+// UserAgent returns a lightweight classification of the browser, e.g., "Chrome",
+// and the operating system, e.g., "Windows", of a TokenUserAgent token. Either is
+// "Other" if it's not recognized.
+func (this Token) UserAgent() (browser, os string, err error) {
+	if this.Type != TokenUserAgent {
+		return "", "", fmt.Errorf("Invalid token type %q: expecting useragent", this.Type)
+	}
+
+	return classifyUserAgent(this.Value, uaBrowsers), classifyUserAgent(this.Value, uaSystems), nil
+}
+
+// uaBrowsers and uaSystems map substrings of user agents to the browser and the
+// operating system. Order matters, e.g., Chrome user agents also include "Safari/".
+var (
+	uaBrowsers = [][2]string{
+		{"Edg/", "Edge"}, {"Edge/", "Edge"}, {"OPR/", "Opera"}, {"Opera", "Opera"},
+		{"Chrome/", "Chrome"}, {"CriOS/", "Chrome"}, {"Firefox/", "Firefox"},
+		{"Safari/", "Safari"}, {"MSIE ", "IE"}, {"Trident/", "IE"},
+		{"bot", "Bot"}, {"Bot", "Bot"}, {"spider", "Bot"}, {"crawler", "Bot"},
+		{"curl/", "curl"}, {"Wget/", "Wget"},
+	}
+
+	uaSystems = [][2]string{
+		{"Windows", "Windows"}, {"Android", "Android"}, {"iPhone", "iOS"},
+		{"iPad", "iOS"}, {"CrOS", "ChromeOS"}, {"Mac OS X", "macOS"},
+		{"Macintosh", "macOS"}, {"Linux", "Linux"},
+	}
+)
+
+func classifyUserAgent(ua string, classes [][2]string) string {
+	for _, c := range classes {
+		if strings.Contains(ua, c[0]) {
+			return c[1]
+		}
+	}
+
+	return "Other"
+}
+
+// TimeLayout returns the time format the value of a TokenTime token is parsed
+// with, e.g., "Jan _2 15:04:05", or WeekDateLayout for ISO 8601 week dates.
+func (this Token) TimeLayout() (string, error) {
+	if this.Type != TokenTime {
+		return "", fmt.Errorf("Invalid token type %q: expecting time", this.Type)
+	}
+
+	_, layout, err := parseTime(this.Value)
+	return layout, err
+}
+
+// Number returns the numeric value of a TokenInteger, TokenFloat, TokenCurrency or
+// TokenPercent token. The value of a currency token excludes the currency symbol
+// and the thousands separators, and the value of a percentage token is in percent,
+// e.g., 85 for "85%".
+func (this Token) Number() (float64, error) {
+	v := this.Value
+
+	switch this.Type {
+	case TokenInteger, TokenFloat:
+
+	case TokenCurrency:
+		neg := strings.HasPrefix(v, "-")
+		v = strings.Replace(strings.TrimLeftFunc(v, func(r rune) bool {
+			return r == '-' || !('0' <= r && r <= '9')
+		}), ",", "", -1)
+		if neg {
+			v = "-" + v
+		}
+
+	case TokenPercent:
+		v = strings.TrimSuffix(v, "%")
+
+	default:
+		return 0, fmt.Errorf("Invalid token type %q: expecting a number", this.Type)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s token %q: %v", this.Type, this.Value, err)
+	}
+
+	return n, nil
+}
+
 func (this TagType) String() string {
 	return config.tagNames[this]
 }
@@ -110,20 +268,32 @@ func name2TokenType(s string) TokenType {
 		return TokenIPv4
 	case "ipv6":
 		return TokenIPv6
+	case "cidr":
+		return TokenCIDR
+	case "ipport":
+		return TokenIPPort
 	case "integer":
 		return TokenInteger
 	case "float":
 		return TokenFloat
+	case "currency":
+		return TokenCurrency
+	case "percent":
+		return TokenPercent
 	case "url":
 		return TokenURI
+	case "request":
+		return TokenRequest
+	case "useragent":
+		return TokenUserAgent
 	case "mac":
 		return TokenMac
+	case "host":
+		return TokenHost
 	case "string":
 		return TokenString
 	case "token__END__":
 		return token__END__
-	case "token__host__":
-		return token__host__
 	case "token__email__":
 		return token__email__
 	}
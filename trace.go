@@ -0,0 +1,108 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import "strings"
+
+// markTraceContext promotes the distributed trace context found in the message to
+// the traceid and spanid tags, so parsed messages can be correlated with traces.
+// Two forms are recognized:
+//
+//   - a W3C traceparent, e.g., 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01,
+//     which is replaced by a traceid token and a spanid token, dropping the version
+//     and the flags
+//   - the value of a trace key, e.g., trace_id=4bf92f3577b34da6a3ce929d0e0e4736 or
+//     span_id: 00f067aa0ba902b7, where the keys are the prekeys of the traceid and
+//     spanid tags in the config file, and the value is a hex or decimal ID
+func (this *Scanner) markTraceContext() {
+	for i := 0; i < len(this.seq); i++ {
+		tok := this.seq[i]
+		if tok.Type != TokenLiteral {
+			continue
+		}
+
+		if traceid, spanid, ok := parseTraceParent(tok.Value); ok {
+			this.seq[i] = Token{Tag: TagTraceID, Type: TokenString, Value: traceid, isValue: true}
+
+			this.seq = append(this.seq, Token{})
+			copy(this.seq[i+2:], this.seq[i+1:])
+			this.seq[i+1] = Token{Tag: TagSpanID, Type: TokenString, Value: spanid, isValue: true}
+
+			if i < len(this.spaced) {
+				this.spaced = append(this.spaced, false)
+				copy(this.spaced[i+2:], this.spaced[i+1:])
+				this.spaced[i+1] = false
+			}
+
+			i++
+			continue
+		}
+
+		vi := i + 2
+		if vi >= len(this.seq) || (this.seq[i+1].Value != "=" && this.seq[i+1].Value != ":") {
+			continue
+		}
+
+		if v := this.seq[vi].Value; (v == "\"" || v == "'") && vi+1 < len(this.seq) {
+			vi++
+		}
+
+		val := this.seq[vi]
+		if (val.Type != TokenLiteral && val.Type != TokenInteger) || !isTraceID(val.Value) {
+			continue
+		}
+
+		if tag := kvTag(strings.ToLower(tok.Value), TokenString); tag == TagTraceID || tag == TagSpanID {
+			this.seq[vi].Tag = tag
+			this.seq[vi].Type = TokenString
+			this.seq[vi].isValue = true
+			i = vi
+		}
+	}
+}
+
+// parseTraceParent returns the trace ID and the span ID of a W3C traceparent, which
+// is of the format "version-traceid-spanid-flags", all in hex.
+func parseTraceParent(s string) (string, string, bool) {
+	if len(s) != 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" {
+		return "", "", false
+	}
+
+	if !isHexString(s[:2]) || !isHexString(s[3:35]) || !isHexString(s[36:52]) || !isHexString(s[53:]) {
+		return "", "", false
+	}
+
+	return s[3:35], s[36:52], true
+}
+
+// isTraceID returns true if s looks like a trace or span ID, i.e., 8 to 32 hex
+// digits, or a decimal number as used by some tracers for 64-bit IDs.
+func isTraceID(s string) bool {
+	if len(s) < 8 || len(s) > 32 {
+		return false
+	}
+
+	return isHexString(s)
+}
+
+func isHexString(s string) bool {
+	for _, r := range s {
+		if !isHex(r) {
+			return false
+		}
+	}
+
+	return true
+}
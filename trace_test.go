@@ -0,0 +1,57 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannerTraceContext(t *testing.T) {
+	scanner := NewScanner()
+
+	data := "Jan 12 06:49:42 web1 app[12]: request done trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id: \"00f067aa0ba902b7\" id=12345678"
+	seq, err := scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TagTraceID, seq[11].Tag, seq.PrintTokens())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", seq[11].Value)
+	require.Equal(t, TagSpanID, seq[15].Tag, seq.PrintTokens())
+	require.Equal(t, TagUnknown, seq[19].Tag, seq.PrintTokens())
+
+	data = "Jan 12 06:49:42 web1 app[12]: GET /cart traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 took 12 ms"
+	seq, err = scanner.Scan(data)
+	require.NoError(t, err, data)
+	require.Equal(t, TagTraceID, seq[11].Tag, seq.PrintTokens())
+	require.Equal(t, TagSpanID, seq[12].Tag, seq.PrintTokens())
+	require.Equal(t, "00f067aa0ba902b7", seq[12].Value)
+	require.Equal(t, "took", seq[13].Value)
+
+	parser := NewParser()
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%msgtime% %apphost% %appname% [ %msgid:integer% ] : %method% %object% traceparent = %traceid% %spanid% took %duration% ms"}))
+
+	pseq, err := parser.Parse(seq)
+	require.NoError(t, err, seq.PrintTokens())
+	require.Equal(t, TagSpanID, pseq[12].Tag)
+
+	for _, s := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, _, ok := parseTraceParent(s)
+		require.False(t, ok, s)
+	}
+}
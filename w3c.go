@@ -0,0 +1,203 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// w3cFieldTags maps the W3C extended log file format (ELFF) field names, as used by
+// Blue Coat ProxySG and other proxies, to the tags of their values.
+var w3cFieldTags = map[string]string{
+	"date":            "msgtime",
+	"time":            "msgtime",
+	"time-taken":      "duration",
+	"c-ip":            "srcip",
+	"s-ip":            "appip",
+	"s-computername":  "apphost",
+	"s-sitename":      "appname",
+	"sc-status":       "status",
+	"s-action":        "action",
+	"sc-bytes":        "bytesrecv",
+	"cs-bytes":        "bytessent",
+	"cs-method":       "method",
+	"cs-uri-scheme":   "protocol",
+	"cs-host":         "dsthost",
+	"cs-uri-port":     "dstport",
+	"cs-uri":          "object",
+	"cs-uri-path":     "object",
+	"cs-uri-stem":     "object",
+	"s-port":          "dstport",
+	"sc-win32-status": "reason",
+	"cs-username":     "srcuser",
+	"cs-auth-group":   "srcgroup",
+	"cs-categories":   "category",
+	"x-exception-id":  "reason",
+	"s-supplier-ip":   "dstip",
+	"s-supplier-name": "dsthost",
+}
+
+const (
+	// w3cFieldsDirective is the directive that names the fields of the messages that
+	// follow it in a W3C ELFF log.
+	w3cFieldsDirective = "#Fields:"
+
+	// w3cDateDirective is the directive that has the date and time the log, or the
+	// part of it that follows, was started.
+	w3cDateDirective = "#Date:"
+)
+
+// ScanW3C returns a Sequence, or a list of tokens, for a message in the W3C extended
+// log file format (ELFF), as written by Blue Coat ProxySG and IIS. The fields of the
+// message are named by the last #Fields directive scanned, e.g.,
+//
+//	#Fields: date time time-taken c-ip sc-status s-action cs-method cs-uri
+//
+// The field list can change mid-file, e.g., when IIS restarts, and each #Fields
+// directive applies to the messages up to the next one. Directives, and any other
+// lines starting with "#", return an empty Sequence.
+//
+// Fields are separated by spaces, and values with spaces are quoted. A field with
+// a known name, e.g., c-ip, or the name of a tag, e.g., srcip, becomes a single
+// token with the tag. Quoted values with spaces become a single token, e.g., a user
+// agent, and the rest of the fields are tokenized as usual. A date field that's
+// immediately followed by a time field is joined with it into a msgtime token. A
+// time field without a date, as logged by IIS, is joined with the date of the last
+// #Date directive instead.
+func (this *Scanner) ScanW3C(s string) (Sequence, error) {
+	s = trimInput(s)
+
+	this.seq = this.seq[:0]
+
+	if strings.HasPrefix(s, "#") {
+		switch {
+		case strings.HasPrefix(s, w3cFieldsDirective):
+			this.w3cFields = strings.Fields(s[len(w3cFieldsDirective):])
+
+		case strings.HasPrefix(s, w3cDateDirective):
+			if fs := strings.Fields(s[len(w3cDateDirective):]); len(fs) > 0 {
+				this.w3cDate = fs[0]
+			}
+		}
+
+		return this.seq, nil
+	}
+
+	if len(this.w3cFields) == 0 {
+		return nil, fmt.Errorf("Invalid W3C message: no %s directive before the message", w3cFieldsDirective)
+	}
+
+	values, err := splitW3C(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(values) && i < len(this.w3cFields); i++ {
+		name, v := this.w3cFields[i], values[i]
+		tag := w3cFieldTag(name)
+
+		switch {
+		case name == "date" && i+1 < len(values) && i+1 < len(this.w3cFields) && this.w3cFields[i+1] == "time":
+			i++
+			v = v + " " + values[i]
+
+		case name == "time" && this.w3cDate != "":
+			v = this.w3cDate + " " + v
+		}
+
+		switch {
+		case v == "":
+
+		case tag != TagUnknown:
+			this.insertToken(Token{Tag: tag, Type: tag.TokenType(), Value: v, isValue: true})
+
+		case strings.ContainsAny(v, " \t"):
+			this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: v})
+
+		default:
+			this.msg.Data = v
+			this.msg.reset()
+
+			tok, err := this.msg.Tokenize()
+			for ; err == nil; tok, err = this.msg.Tokenize() {
+				this.insertToken(tok)
+			}
+
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+
+	return this.seq, nil
+}
+
+// w3cFieldTag returns the tag for the W3C field name, or TagUnknown if there isn't
+// one. The field name can also be the name of a tag.
+func w3cFieldTag(name string) TagType {
+	if tag, ok := w3cFieldTags[strings.ToLower(name)]; ok {
+		return name2TagType(tag)
+	}
+
+	return name2TagType(name)
+}
+
+// splitW3C splits the W3C message into its field values. Values are separated by
+// spaces or tabs, and quoted values can contain spaces and doubled quotes.
+func splitW3C(s string) ([]string, error) {
+	var values []string
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case ' ', '\t':
+			i++
+
+		case '"':
+			var v []byte
+
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, fmt.Errorf("Invalid W3C message %q: missing closing quote", s)
+				}
+
+				if s[i] == '"' {
+					if i+1 < len(s) && s[i+1] == '"' {
+						i++
+					} else {
+						i++
+						break
+					}
+				}
+
+				v = append(v, s[i])
+			}
+
+			values = append(values, string(v))
+
+		default:
+			j := strings.IndexAny(s[i:], " \t")
+			if j == -1 {
+				j = len(s) - i
+			}
+
+			values = append(values, s[i:i+j])
+			i += j
+		}
+	}
+
+	return values, nil
+}
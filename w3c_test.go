@@ -0,0 +1,161 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	bluecoattests = []string{
+		"#Software: SGOS 6.5.1.1",
+		"#Version: 1.0",
+		"#Fields: date time time-taken c-ip sc-status s-action sc-bytes cs-bytes cs-method cs-uri-scheme cs-host cs-uri-port cs-uri-path cs-uri-query cs-username s-hierarchy cs(User-Agent) cs-categories s-ip",
+		`2015-10-14 15:04:05 125 10.1.1.5 200 TCP_NC_MISS 4233 512 GET http www.example.com 80 /index.html - jsmith DIRECT "Mozilla/5.0 (Windows NT 10.0; Win64; x64)" "Technology/Internet" 10.1.1.1`,
+	}
+)
+
+func TestScannerScanW3C(t *testing.T) {
+	scanner := NewScanner()
+
+	_, err := scanner.ScanW3C(bluecoattests[3])
+	require.Error(t, err)
+
+	for _, msg := range bluecoattests[:3] {
+		seq, err := scanner.ScanW3C(msg)
+		require.NoError(t, err, msg)
+		require.Equal(t, 0, len(seq), msg)
+	}
+
+	seq, err := scanner.ScanW3C(bluecoattests[3])
+	require.NoError(t, err)
+
+	tags := make(map[TagType]string)
+	for _, tok := range seq {
+		if tok.Tag != TagUnknown {
+			tags[tok.Tag] = tok.Value
+		}
+	}
+
+	require.Equal(t, "2015-10-14 15:04:05", tags[TagMsgTime])
+	require.Equal(t, "125", tags[TagDuration])
+	require.Equal(t, "10.1.1.5", tags[TagSrcIP])
+	require.Equal(t, "TCP_NC_MISS", tags[TagAction])
+	require.Equal(t, "www.example.com", tags[TagDstHost])
+	require.Equal(t, "/index.html", tags[TagObject])
+	require.Equal(t, "jsmith", tags[TagSrcUser])
+	require.Equal(t, "Technology/Internet", tags[TagCategory])
+	require.Equal(t, "10.1.1.1", tags[TagAppIP])
+
+	var agent bool
+	for _, tok := range seq {
+		agent = agent || tok.Type == TokenUserAgent
+	}
+	require.True(t, agent)
+
+	seq, err = scanner.ScanW3C("#Fields: c-ip srcuser x-note")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(seq))
+
+	seq, err = scanner.ScanW3C(`10.1.1.6 "j ""the"" smith" ""`)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(seq))
+	require.Equal(t, TagSrcUser, seq[1].Tag)
+	require.Equal(t, `j "the" smith`, seq[1].Value)
+
+	_, err = scanner.ScanW3C(`10.1.1.6 "jsmith`)
+	require.Error(t, err)
+}
+
+func TestParserParseSquid(t *testing.T) {
+	pats, err := ReadPatterns("patterns/squid.txt")
+	require.NoError(t, err)
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		srcip  string
+		status string
+	}{
+		{"1286536309.586    921 192.168.0.68 TCP_MISS/200 507 POST http://rcv.example.com/x?y=1 - DIRECT/10.0.0.1 application/xml", "192.168.0.68", "tcp_miss/200"},
+		{"1286536309.586      0 192.168.0.69 TCP_DENIED/403 3617 CONNECT www.example.com:443 jsmith HIER_NONE/- text/html", "192.168.0.69", "tcp_denied/403"},
+		{`192.168.0.70 - jsmith [10/Oct/2010:13:55:36 -0700] "GET http://www.example.com/index.html HTTP/1.1" 200 2326 TCP_MISS:HIER_DIRECT`, "192.168.0.70", "tcp_miss"},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		tags := make(map[TagType]string)
+		for _, tok := range seq {
+			tags[tok.Tag] = tok.Value
+		}
+
+		require.Equal(t, tc.srcip, tags[TagSrcIP], tc.msg)
+		require.Equal(t, tc.status, tags[TagStatus], tc.msg)
+	}
+}
+
+var (
+	iistests = []string{
+		"#Software: Microsoft Internet Information Services 8.5",
+		"#Version: 1.0",
+		"#Date: 2015-10-14 15:04:05",
+		"#Fields: time s-ip cs-method cs-uri-stem cs-uri-query s-port c-ip sc-status",
+		"15:04:05 10.0.0.1 GET /default.htm - 80 10.1.1.5 200",
+		"#Date: 2015-10-15 00:00:00",
+		"#Fields: time c-ip cs-method cs-uri-stem sc-status time-taken",
+		"00:00:01 10.1.1.6 POST /login.aspx 302 15",
+	}
+)
+
+func TestScannerScanW3CDirectives(t *testing.T) {
+	scanner := NewScanner()
+
+	var seqs []Sequence
+
+	for _, msg := range iistests {
+		seq, err := scanner.ScanW3C(msg)
+		require.NoError(t, err, msg)
+
+		if len(seq) > 0 {
+			seqs = append(seqs, append(Sequence(nil), seq...))
+		}
+	}
+
+	require.Equal(t, 2, len(seqs))
+
+	require.Equal(t, 8, len(seqs[0]))
+	require.Equal(t, Token{Tag: TagMsgTime, Type: TokenTime, Value: "2015-10-14 15:04:05", isValue: true}, seqs[0][0])
+	require.Equal(t, TagAppIP, seqs[0][1].Tag)
+	require.Equal(t, TagObject, seqs[0][3].Tag)
+	require.Equal(t, TagDstPort, seqs[0][5].Tag)
+	require.Equal(t, TagSrcIP, seqs[0][6].Tag)
+
+	require.Equal(t, 6, len(seqs[1]))
+	require.Equal(t, "2015-10-15 00:00:01", seqs[1][0].Value)
+	require.Equal(t, TagSrcIP, seqs[1][1].Tag)
+	require.Equal(t, "10.1.1.6", seqs[1][1].Value)
+	require.Equal(t, TagStatus, seqs[1][4].Tag)
+	require.Equal(t, TagDuration, seqs[1][5].Tag)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	ProviderSecurityAuditing = "Microsoft-Windows-Security-Auditing"
+	ProviderEventlog         = "Microsoft-Windows-Eventlog"
+)
+
+// WindowsEvent is the action and category of a well-known Windows event, e.g.,
+// event 4624 from the Microsoft-Windows-Security-Auditing provider is a logon.
+type WindowsEvent struct {
+	Provider string // Provider is the provider that logs the event.
+	ID       int    // ID is the event ID, e.g., 4624.
+	Action   string // Action is the action the event records, e.g., "logon".
+	Category string // Category is the task category of the event, e.g., "logon".
+}
+
+var windowsEvents = []WindowsEvent{
+	{ProviderEventlog, 1102, "audit log cleared", "log clear"},
+	{ProviderSecurityAuditing, 4624, "logon", "logon"},
+	{ProviderSecurityAuditing, 4625, "logon failed", "logon"},
+	{ProviderSecurityAuditing, 4634, "logoff", "logoff"},
+	{ProviderSecurityAuditing, 4647, "logoff", "logoff"},
+	{ProviderSecurityAuditing, 4648, "explicit logon", "logon"},
+	{ProviderSecurityAuditing, 4672, "special privileges assigned", "special logon"},
+	{ProviderSecurityAuditing, 4688, "process created", "process creation"},
+	{ProviderSecurityAuditing, 4689, "process exited", "process termination"},
+	{ProviderSecurityAuditing, 4697, "service installed", "security system extension"},
+	{ProviderSecurityAuditing, 4698, "scheduled task created", "other object access events"},
+	{ProviderSecurityAuditing, 4719, "audit policy changed", "audit policy change"},
+	{ProviderSecurityAuditing, 4720, "user account created", "user account management"},
+	{ProviderSecurityAuditing, 4722, "user account enabled", "user account management"},
+	{ProviderSecurityAuditing, 4723, "password change attempted", "user account management"},
+	{ProviderSecurityAuditing, 4724, "password reset attempted", "user account management"},
+	{ProviderSecurityAuditing, 4725, "user account disabled", "user account management"},
+	{ProviderSecurityAuditing, 4726, "user account deleted", "user account management"},
+	{ProviderSecurityAuditing, 4728, "group member added", "security group management"},
+	{ProviderSecurityAuditing, 4732, "group member added", "security group management"},
+	{ProviderSecurityAuditing, 4738, "user account changed", "user account management"},
+	{ProviderSecurityAuditing, 4740, "user account locked out", "user account management"},
+	{ProviderSecurityAuditing, 4756, "group member added", "security group management"},
+	{ProviderSecurityAuditing, 4767, "user account unlocked", "user account management"},
+	{ProviderSecurityAuditing, 4768, "kerberos ticket requested", "kerberos authentication service"},
+	{ProviderSecurityAuditing, 4769, "kerberos service ticket requested", "kerberos service ticket operations"},
+	{ProviderSecurityAuditing, 4771, "kerberos pre-authentication failed", "kerberos authentication service"},
+	{ProviderSecurityAuditing, 4776, "credentials validated", "credential validation"},
+}
+
+// WindowsEvents returns the well-known Windows events, ordered by event ID.
+func WindowsEvents() []WindowsEvent {
+	return append([]WindowsEvent(nil), windowsEvents...)
+}
+
+// LookupWindowsEvent returns the well-known Windows event with the ID logged by the
+// provider. The provider is compared ignoring case and punctuation, so both
+// "Microsoft-Windows-Security-Auditing" and "Microsoft Windows security auditing."
+// match. An empty provider matches any provider.
+func LookupWindowsEvent(provider string, id int) (WindowsEvent, bool) {
+	provider = normalizeProvider(provider)
+
+	for _, e := range windowsEvents {
+		if e.ID == id && (provider == "" || provider == normalizeProvider(e.Provider)) {
+			return e, true
+		}
+	}
+
+	return WindowsEvent{}, false
+}
+
+// EnrichWindowsEvent appends the action and category tokens of the Windows event
+// to the parsed message sequence, if its msgid token is the ID of a well-known
+// event. The appname token, if any, is used as the provider. Tokens for tags the
+// sequence already has are not appended.
+func EnrichWindowsEvent(seq Sequence) Sequence {
+	var (
+		id       = -1
+		provider string
+		hasTag   = make(map[TagType]bool)
+	)
+
+	for _, tok := range seq {
+		switch tok.Tag {
+		case TagMsgId:
+			if n, err := strconv.Atoi(tok.Value); err == nil {
+				id = n
+			}
+
+		case TagAppName:
+			provider = tok.Value
+		}
+
+		hasTag[tok.Tag] = true
+	}
+
+	e, ok := LookupWindowsEvent(provider, id)
+	if !ok {
+		return seq
+	}
+
+	if !hasTag[TagAction] {
+		seq = append(seq, Token{Type: TokenString, Tag: TagAction, Value: e.Action})
+	}
+
+	if !hasTag[TagCategory] {
+		seq = append(seq, Token{Type: TokenString, Tag: TagCategory, Value: e.Category})
+	}
+
+	return seq
+}
+
+// normalizeProvider returns the provider in lower case with everything but letters
+// and digits removed.
+func normalizeProvider(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowsLookupWindowsEvent(t *testing.T) {
+	e, ok := LookupWindowsEvent("Microsoft Windows security auditing.", 4625)
+	require.True(t, ok)
+	require.Equal(t, "logon failed", e.Action)
+	require.Equal(t, "logon", e.Category)
+
+	e, ok = LookupWindowsEvent("", 1102)
+	require.True(t, ok)
+	require.Equal(t, ProviderEventlog, e.Provider)
+
+	_, ok = LookupWindowsEvent(ProviderSecurityAuditing, 1102)
+	require.False(t, ok)
+
+	_, ok = LookupWindowsEvent("", 9999)
+	require.False(t, ok)
+}
+
+func TestWindowsEnrichWindowsEvent(t *testing.T) {
+	pats, err := ReadPatterns("patterns/windows.txt")
+	require.NoError(t, err)
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	for _, pat := range pats {
+		require.NoError(t, parser.AddPattern(pat))
+	}
+
+	require.NoError(t, parser.AddPattern(Pattern{Text: "%appname% %msgid:integer% %string:-%"}))
+
+	for _, tc := range []struct {
+		msg      string
+		action   string
+		category string
+	}{
+		{`Audit Success,10/14/2015 3:04:05 PM,Microsoft-Windows-Security-Auditing,4624,Logon,"An account was successfully logged on."`, "logon", "logon"},
+		{`Audit Success,10/14/2015 3:04:06 PM,Microsoft-Windows-Security-Auditing,4688,Process Creation,"A new process has been created."`, "process created", "process creation"},
+		{`Microsoft-Windows-Security-Auditing 4740 A user account was locked out.`, "user account locked out", "user account management"},
+		{`Microsoft-Windows-Security-Auditing 1102 The audit log was cleared.`, "", ""},
+	} {
+		seq, err := scanner.Scan(tc.msg)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		var action, category string
+
+		for _, tok := range EnrichWindowsEvent(seq) {
+			switch tok.Tag {
+			case TagAction:
+				action = tok.Value
+			case TagCategory:
+				category = tok.Value
+			}
+		}
+
+		require.Equal(t, tc.action, action, tc.msg)
+		require.Equal(t, tc.category, category, tc.msg)
+	}
+}